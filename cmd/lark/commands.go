@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/bmatsuo/lark/project"
 	"github.com/codegangsta/cli"
 	"github.com/yuin/gopher-lua"
 )
@@ -14,6 +15,9 @@ var Commands = []cli.Command{
 	CommandList,
 	CommandREPL,
 	CommandLua,
+	CommandMod,
+	CommandModules,
+	CommandConfig,
 }
 
 // Command is a helper for creating a cli.Command that relies on a Context for
@@ -30,7 +34,23 @@ type Context struct {
 	*cli.Context
 	Lua         *lua.LState
 	verbose     *bool
+	keepGoing   bool
 	disableDocs bool
+
+	// overrides contains global variable values given on the command line.
+	overrides map[string]string
+
+	// config contains the effective configuration of the project.
+	config *project.Config
+
+	// root is the project root directory.  invocationDir is the working
+	// directory lark was invoked from, before changing to root.
+	root          string
+	invocationDir string
+
+	// subprojects maps the root directory of each loaded subproject to its
+	// context.  The map is shared by all subprojects.
+	subprojects map[string]*Context
 }
 
 // Verbose returns true if verbose output has been enabled.
@@ -38,6 +58,14 @@ func (c *Context) Verbose() bool {
 	return c.verbose != nil && *c.verbose
 }
 
+// layout returns the project layout configured by c.config.
+func (c *Context) layout() *project.Layout {
+	if c.config == nil {
+		return project.DefaultLayout()
+	}
+	return c.config.Layout()
+}
+
 // Action returns a function usable as the action for a cli.Command.
 func (c *Context) Action(fn func(*Context)) func(*cli.Context) {
 	return func(_c *cli.Context) {
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/bmatsuo/lark/project"
+	"github.com/codegangsta/cli"
+)
+
+// CommandConfig implements the "config" command which prints the effective
+// configuration of the project.
+var CommandConfig = Command(func(lark *Context, cmd *cli.Command) {
+	cmd.Name = "config"
+	cmd.Usage = "Show the effective project configuration"
+	cmd.Description = `
+    Print the value of each setting and its source.  Settings are read from the
+    user configuration file (~/.config/lark/config.toml or config.json, or the
+    file named by LARK_CONFIG), then the project configuration file
+    (.lark.toml or lark.json in the project root), then environment variables.
+    Command line flags take precedence over all configured values.
+
+        # .lark.toml
+        parallel = 4
+        color = "never"
+        task_dir = "tasks"`
+	cmd.Action = lark.Action(Config)
+})
+
+// Config prints the effective configuration of the project.
+func Config(c *Context) {
+	err := ChdirRoot(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, s := range project.ConfigSettings {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, c.config.Value(s.Name), c.config.Source(s.Name))
+	}
+	w.Flush()
+}
@@ -1,12 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"os"
 
-	"github.com/bmatsuo/lark/gluamodule"
-	"github.com/bmatsuo/lark/lib"
-	"github.com/bmatsuo/lark/lib/doc"
+	"github.com/bmatsuo/lark/lib/lark/core"
 	"github.com/bmatsuo/lark/project"
+	"github.com/bmatsuo/lark/runner"
 	"github.com/yuin/gopher-lua"
 )
 
@@ -32,7 +33,15 @@ func FindTaskFiles(dir string) ([]string, error) {
 
 // LuaConfig contains options for a new Lua virtual machine.
 type LuaConfig struct {
+	// PackagePath is the raw value of package.path.  When empty the
+	// project.PackagePath for Dir is used.
 	PackagePath string
+	// Dir is the project root directory.  When empty the working directory is
+	// used.
+	Dir string
+	// Layout locates the module directory in Dir.  When nil
+	// project.DefaultLayout is used.
+	Layout *project.Layout
 }
 
 // LoadVM creates a lua.State from conf and returns it.
@@ -42,77 +51,140 @@ func LoadVM(conf *LuaConfig) (s *lua.LState, err error) {
 		if err != nil {
 			log.Print(err)
 			s.Close()
+			s = nil
 		}
 	}()
 
 	if conf != nil {
 		var err error
 		if conf.PackagePath == "" {
-			err = project.SetPackagePath(s, ".")
+			dir := conf.Dir
+			if dir == "" {
+				dir = "."
+			}
+			layout := conf.Layout
+			if layout == nil {
+				layout = project.DefaultLayout()
+			}
+			err = layout.SetPackagePath(s, dir)
 		} else {
 			err = project.SetPackagePathRaw(s, conf.PackagePath)
 		}
 		if err != nil {
-			return nil, err
+			return s, err
 		}
 	}
 
 	return s, nil
 }
 
-// InitLark initializes the lark library and loads files.
-func InitLark(c *Context, files []string) error {
-	for _, mod := range lib.Modules {
-		gluamodule.Preload(c.Lua, mod)
+// FindProject changes the working directory to the project root and locates
+// the project task files.  If no project root can be found the working
+// directory is not changed.  If the project has a module lock file the
+// vendored modules are verified against it.
+func FindProject(c *Context) ([]string, error) {
+	err := ChdirRoot(c)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := c.layout()
+	lock, err := project.ReadModLock(".")
+	if err == nil {
+		err = layout.VerifyModules(".", lock)
+		if err != nil {
+			return nil, fmt.Errorf("%v (run ``lark mod vendor'' to restore them)", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return layout.FindTaskFiles(".")
+}
+
+// ChdirRoot reads configuration files and changes the working directory to
+// the project root.  If no project root can be found the working directory is
+// not changed.  The user configuration file is read before locating the
+// project root and the project configuration file is read after.
+func ChdirRoot(c *Context) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
 	}
+	c.invocationDir = wd
 
-	trace := c.Lua.NewFunction(errTraceback)
-	require := c.Lua.GetGlobal("require")
+	conf := project.NewConfig()
+	_, err = conf.ReadFirstFile(project.UserConfigFiles())
+	if err != nil {
+		return err
+	}
 
-	if c.disableDocs {
-		err := doc.Disable(c.Lua, nil)
+	root, err := conf.Layout().FindRoot(wd)
+	if err == project.ErrNoRoot {
+		root = wd
+	} else if err != nil {
+		return err
+	}
+	if root != wd {
+		err = os.Chdir(root)
 		if err != nil {
 			return err
 		}
 	}
+	c.root = root
 
-	c.Lua.Push(require)
-	c.Lua.Push(lua.LString("lark"))
-	err := c.Lua.PCall(1, 1, trace)
+	_, err = conf.ReadFirstFile(project.ConfigFiles(root))
 	if err != nil {
 		return err
 	}
-	lark := c.Lua.Get(-1)
-	c.Lua.Pop(1)
-	c.Lua.SetGlobal("lark", lark)
+	conf.ReadEnv()
+	c.config = conf
+	ApplyConfig(c)
 
-	if c.disableDocs {
-		doc.Disable(c.Lua, c.Lua.NewClosure(func(l *lua.LState) int {
-			msg := l.NewTable()
-			msg.Append(lua.LString("documentation is disabled"))
-			msg.RawSetString("color", lua.LString("yellow"))
-			l.Push(l.GetField(lark, "log"))
-			l.Push(msg)
-			l.Call(1, 0)
-			return 0
-		}, lark))
+	if c.Verbose() && root != wd {
+		log.Printf("project root: %s", root)
 	}
-	c.Lua.SetField(lark, "verbose", lua.LBool(c.Verbose()))
+	return nil
+}
 
-	// Load files after lark has been loaded with require().
-	if c.Verbose() && len(files) > 0 {
-		log.Printf("loading files: %v", files)
+// ApplyConfig sets options of c that were not given as command line flags
+// using c.config.
+func ApplyConfig(c *Context) {
+	conf := c.config
+	if c.Context == nil || !c.IsSet("v") {
+		*c.verbose = conf.Bool("verbose")
+	}
+	c.disableDocs = !conf.Bool("docs")
+	switch conf.String("color") {
+	case "always":
+		core.SetColor(true)
+	case "never":
+		core.SetColor(false)
 	}
-	return LoadFiles(c.Lua, files)
 }
 
-// LoadFiles loads the given files into state
-func LoadFiles(state *lua.LState, files []string) error {
-	for _, file := range files {
-		err := state.DoFile(file)
+// InitLark initializes the lark library and loads files.
+func InitLark(c *Context, files []string) error {
+	opt := &runner.Options{
+		Overrides:     c.overrides,
+		InvocationDir: c.invocationDir,
+		Verbose:       c.Verbose(),
+		KeepGoing:     c.keepGoing,
+		DisableDocs:   c.disableDocs,
+		Layout:        c.layout(),
+		Chdir:         true,
+	}
+	if c.config != nil {
+		opt.Plugins = c.config.Strings("plugins")
+	}
+	if c.Verbose() && len(files) > 0 {
+		log.Printf("loading files: %v", files)
+	}
+	return runner.Init(c.Lua, c.root, files, opt, func(dir string) (*lua.LState, error) {
+		sub, err := Subproject(c, dir)
 		if err != nil {
-			return err
+			return nil, err
 		}
-	}
-	return nil
+		return sub.Lua, nil
+	})
 }
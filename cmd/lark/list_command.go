@@ -1,10 +1,14 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"sort"
+	"strings"
 
-	"github.com/bmatsuo/lark/project"
+	"github.com/bmatsuo/lark/lib/fs"
 	"github.com/codegangsta/cli"
+	"github.com/yuin/gopher-lua"
 )
 
 // CommandList implements the "list" action and prints available tasks to
@@ -17,25 +21,77 @@ var CommandList = Command(func(lark *Context, cmd *cli.Command) {
 
 // List loads a lua vm and prints all defined tasks to standard output.
 func List(c *Context) {
-	luaFiles, err := project.FindTaskFiles(".")
+	luaFiles, err := FindProject(c)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	luaConfig := &LuaConfig{}
+	luaConfig := &LuaConfig{Dir: c.root, Layout: c.layout()}
 	c.Lua, err = LoadVM(luaConfig)
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		exit(c, 1)
 	}
 	defer c.Lua.Close()
+	defer CloseSubprojects(c)
+	defer fs.Cleanup(c.Lua)
 
 	err = InitLark(c, luaFiles)
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		exit(c, 1)
 	}
 
 	err = c.Lua.DoString(`require('lark.task').dump()`)
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		exit(c, 1)
+	}
+
+	printVars(c)
+}
+
+// printVars prints the variables declared with lark.var() in sorted order.
+func printVars(c *Context) {
+	vars, ok := c.Lua.GetField(c.Lua.GetGlobal("lark"), "vars").(*lua.LTable)
+	if !ok {
+		return
+	}
+	var names []string
+	vars.ForEach(func(k, _ lua.LValue) {
+		names = append(names, k.String())
+	})
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+
+	fmt.Println()
+	fmt.Println("variables:")
+	for _, name := range names {
+		decl := vars.RawGetString(name)
+		value := luaVarString(c.Lua, c.Lua.GetField(decl, "value"))
+		desc := c.Lua.GetField(decl, "desc")
+		if desc == lua.LNil {
+			fmt.Printf("-\t%s = %s\n", name, value)
+		} else {
+			fmt.Printf("-\t%s = %s\t%s\n", name, value, desc)
+		}
+	}
+}
+
+// luaVarString formats a variable value for display.
+func luaVarString(l *lua.LState, lv lua.LValue) string {
+	switch lv := lv.(type) {
+	case lua.LString:
+		return fmt.Sprintf("%q", string(lv))
+	case *lua.LTable:
+		var items []string
+		for i := 1; i <= lv.Len(); i++ {
+			items = append(items, luaVarString(l, lv.RawGetInt(i)))
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	default:
+		return lv.String()
 	}
 }
@@ -4,9 +4,11 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/bmatsuo/lark/larkmeta"
-	"github.com/bmatsuo/lark/project"
+	"github.com/bmatsuo/lark/lib/fs"
+	"github.com/bmatsuo/lark/runner"
 	"github.com/codegangsta/cli"
 	"github.com/yuin/gopher-lua"
 )
@@ -28,26 +30,31 @@ var CommandLua = Command(func(lark *Context, cmd *cli.Command) {
 // Lua loads a lua vm with the lark library and executes Lua scripts or
 // expressions.
 func Lua(c *Context) {
-	luaFiles, err := project.FindTaskFiles(".")
+	luaFiles, err := FindProject(c)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	luaConfig := &LuaConfig{}
+	luaConfig := &LuaConfig{Dir: c.root, Layout: c.layout()}
 	c.Lua, err = LoadVM(luaConfig)
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		exit(c, 1)
 	}
 	defer c.Lua.Close()
+	defer CloseSubprojects(c)
+	defer fs.Cleanup(c.Lua)
 
 	err = InitLark(c, luaFiles)
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		exit(c, 1)
 	}
 
 	err = RunLua(c)
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		exit(c, 1)
 	}
 }
 
@@ -64,7 +71,7 @@ func RunLua(c *Context) error {
 		for _, arg := range args {
 			c.Lua.Push(lua.LString(arg))
 		}
-		return c.Lua.PCall(len(args), 0, c.Lua.NewFunction(errTraceback))
+		return c.Lua.PCall(len(args), 0, c.Lua.NewFunction(runner.Traceback))
 	}
 
 	args := c.Args()
@@ -80,7 +87,12 @@ func RunLua(c *Context) error {
 		luaName = "stdin"
 		luaReader = os.Stdin
 	} else {
-		f, err := os.Open(args[0])
+		// the working directory was changed to the project root.
+		path := args[0]
+		if c.invocationDir != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(c.invocationDir, path)
+		}
+		f, err := os.Open(path)
 		if err != nil {
 			return err
 		}
@@ -101,7 +113,7 @@ func RunLua(c *Context) error {
 		c.Lua.Push(lua.LString(arg))
 	}
 
-	return c.Lua.PCall(len(luaArgs), 0, c.Lua.NewFunction(errTraceback))
+	return c.Lua.PCall(len(luaArgs), 0, c.Lua.NewFunction(runner.Traceback))
 }
 
 // LuaInteractive runs an interactive interpreter for the embedded Lua
@@ -3,8 +3,10 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
@@ -48,6 +50,10 @@ func TestLua(t *testing.T) {
 	rec := testLogging(t, true)
 	defer rec.Reset()
 
+	// keep lark from loading the lark.lua file of the lark repository.
+	os.Setenv("LARK_ROOT", ".")
+	defer os.Setenv("LARK_ROOT", "")
+
 	app := Init(cli.NewApp())
 	app.Run([]string{"lark", "lua", "-c", "lark.log('testok')"})
 
@@ -58,6 +64,51 @@ func TestLua(t *testing.T) {
 	}
 }
 
+func TestLua_script(t *testing.T) {
+	rec := testLogging(t, true)
+	defer rec.Reset()
+
+	root, err := ioutil.TempDir("", "lark-lua-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	sub := filepath.Join(root, "sub")
+	err = os.Mkdir(sub, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(root, "lark.lua"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(sub, "script.lua"), []byte("lark.log('scriptok')"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	err = os.Chdir(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("LARK_ROOT", root)
+	defer os.Setenv("LARK_ROOT", "")
+
+	app := Init(cli.NewApp())
+	app.Run([]string{"lark", "lua", "script.lua"})
+
+	output := rec.Output()
+	testString := " scriptok\n"
+	if !strings.Contains(output, testString) {
+		t.Errorf("output:\n\t%q\n\tdoes not contain\n\t%q", output, testString)
+	}
+}
+
 func testLogging(t *testing.T, rec bool) *testLoggerOutput {
 	r := &testLoggerOutput{t, nil}
 	if rec {
@@ -9,9 +9,14 @@ As of the current release the embedded Lua interpreter is compliant with
 Lua5.1.
 
 The lark command locates tasks defined in the ./lark.lua file or otherwise
-directly under the directory ./lark_tasks/.  Tasks can have names (either
-explicitly given or otherwise inferred) or patterns.  Pattern matching tasks
-will match a set of names defined by a regular expression.
+under the directory ./lark_tasks/ and its subdirectories.  Subdirectories of
+./lark_tasks/, and files within them, with names beginning with "_" or "." are
+not loaded.  When the working directory does not contain a lark.lua file its
+parent directories are searched and lark changes its working directory to the
+first one containing lark.lua (the project root).  The environment variable
+LARK_ROOT overrides the search.  Tasks can have names (either explicitly given
+or otherwise inferred) or patterns.  Pattern matching tasks will match a set of
+names defined by a regular expression.
 
 Names are matched against available tasks with a strict precedence.  Explicitly
 named tasks will match the same name with the highest priority.  Any task with
@@ -19,6 +24,22 @@ an inferred name will match the same name with the second highest priority.
 Pattern matching tasks have the lowest priority and will match names in the
 order they were defined.
 
+Tasks may be grouped into namespaces using the lua function
+require('lark.task').namespace().  Setting the variable file_namespaces in the
+"lark.task" module to true in lark.lua places the tasks of each file in
+./lark_tasks/ in a namespace named after the file.  Setting the variable
+dir_namespaces instead places the tasks of files in a subdirectory of
+./lark_tasks/ in a namespace named after the subdirectory.  Namespaced tasks are run
+using a qualified name.
+
+	lark run release:publish
+
+A task in a nested lark project (a subproject) can be run by prefixing its name
+with the subproject directory.  Subprojects can also be run from lua using the
+function lark.subproject().
+
+	lark run svc/a:build
+
 Tasks can be executed by calling the lua function lark.run() in a script, using
 the lark subcommand "run".  When given no arguments, run will execute the first
 named task that was defined, or a task specified by setting the "default"
@@ -36,6 +57,29 @@ The above script will print a line containing text "task1" followed by a line
 containing "task2" and finally a line containing "task1" again.
 
 
+Configuration
+
+Default flag values and project layout settings can be configured in the file
+.lark.toml (or lark.json) in the project root and in a per-user configuration
+file.  Command line flags take precedence over configured values.  The "config"
+subcommand displays the effective configuration and where each value came from.
+
+	lark config
+
+
+Plugins
+
+Modules implemented in Go can be loaded from Go plugins listed in the
+"plugins" setting.  A plugin is a main package built with
+"go build -buildmode=plugin" which exports the lark version it was built
+against and the modules it provides.
+
+	var LarkVersion = larkmeta.Version
+	var Modules = []gluamodule.Module{mymodule.Module}
+
+Plugins are only supported on platforms supported by the Go plugin package.
+
+
 Command Reference
 
 Command reference documentation is available through the "help" subcommand.
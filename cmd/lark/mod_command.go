@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/bmatsuo/lark/project"
+	"github.com/codegangsta/cli"
+)
+
+// CommandMod implements the "mod" command family which manages vendored
+// third-party modules.
+var CommandMod = Command(func(lark *Context, cmd *cli.Command) {
+	cmd.Name = "mod"
+	cmd.Usage = "Manage vendored third-party modules"
+	cmd.Subcommands = []cli.Command{
+		{
+			Name:   "vendor",
+			Usage:  "Copy modules from lark_modules.json into lark_modules/ and write lark_modules.lock",
+			Action: lark.Action(ModVendor),
+			Description: `
+    Third-party modules are listed in the file lark_modules.json in the project
+    root.  Each module has a name, which is passed to require(), and a source
+    which is the local path of a directory, a lua file, a tarball, or a git
+    repository.
+
+        {
+            "modules": [
+                {"name": "shared", "source": "../shared/lua"},
+                {"name": "json", "source": "vendor/json-1.0.tar.gz", "path": "src"},
+                {"name": "util", "source": "../util.git", "ref": "v1.2.0"}
+            ]
+        }
+
+    Vendored modules are copied into lark_modules/ and their content hashes are
+    recorded in the file lark_modules.lock.  When the lock file exists lark
+    verifies the vendored modules before loading a project.`,
+		},
+		{
+			Name:   "verify",
+			Usage:  "Verify vendored modules against lark_modules.lock",
+			Action: lark.Action(ModVerify),
+		},
+	}
+})
+
+// ModVendor vendors the modules in the project module manifest and writes the
+// module lock file.
+func ModVendor(c *Context) {
+	err := ChdirRoot(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	m, err := project.ReadModManifest(".")
+	if err != nil {
+		log.Fatal(err)
+	}
+	lock, err := c.layout().Vendor(".", m)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = project.WriteModLock(".", lock)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, locked := range lock.Modules {
+		log.Printf("vendored %s (%s)", locked.Name, locked.Path)
+	}
+}
+
+// ModVerify verifies vendored modules against the project module lock file.
+func ModVerify(c *Context) {
+	err := ChdirRoot(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	lock, err := project.ReadModLock(".")
+	if os.IsNotExist(err) {
+		log.Fatalf("%s not found", project.ModLockFile)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = c.layout().VerifyModules(".", lock)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bmatsuo/lark/internal/textutil"
+	"github.com/bmatsuo/lark/lib/lark/core"
+	"github.com/bmatsuo/lark/project"
+	"github.com/codegangsta/cli"
+	"github.com/yuin/gopher-lua"
+)
+
+// CommandModules implements the "modules" command which lists and validates
+// the modules in the project lark_modules/ directory.
+var CommandModules = Command(func(lark *Context, cmd *cli.Command) {
+	cmd.Name = "modules"
+	cmd.Usage = "List and validate project modules"
+	cmd.Description = `
+    Print the name, file, and synopsis of each module in lark_modules/ that can
+    be loaded with require().  Problems are reported for an init.lua file
+    directly under lark_modules/, for modules defined by multiple files (e.g.
+    foo.lua and foo/init.lua), and for modules that fail to compile.  Modules
+    are compiled but not run, and the synopsis is the first sentence of the
+    comment at the start of the module file.  The command exits with a
+    non-zero status if any problem is found.`
+	cmd.Action = lark.Action(Modules)
+})
+
+// Modules compiles and prints the modules available to the project.
+func Modules(c *Context) {
+	err := ChdirRoot(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	files, err := c.layout().FindModuleFiles(".")
+	if err != nil {
+		log.Fatal(err)
+	}
+	problems := project.ModuleProblems(files)
+	count := make(map[string]int)
+	for _, f := range files {
+		count[f.Name]++
+	}
+
+	l := lua.NewState()
+	defer l.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, f := range files {
+		if f.Name == "" || count[f.Name] > 1 {
+			continue
+		}
+		synopsis, err := moduleSynopsis(l, f)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Name, f.Path, synopsis)
+	}
+	w.Flush()
+
+	if len(problems) > 0 {
+		opt := &core.LogOpt{Color: "red"}
+		for _, err := range problems {
+			core.Log(err.Error(), opt)
+		}
+		os.Exit(1)
+	}
+}
+
+// moduleSynopsis compiles the module in f without running it and returns the
+// first sentence of the comment at the start of the file.
+func moduleSynopsis(l *lua.LState, f *project.ModuleFile) (string, error) {
+	_, err := l.LoadFile(f.Path)
+	if err != nil {
+		return "", fmt.Errorf("module %s does not compile: %v", f.Name, err)
+	}
+	src, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return "", err
+	}
+	return textutil.Synopsis(leadingComment(string(src))), nil
+}
+
+// leadingComment returns the text of the comments at the start of the Lua
+// source src, ignoring a "#!" line.  Line comments and long comments are
+// recognized.  The lines of long comments are unindented.
+func leadingComment(src string) string {
+	if strings.HasPrefix(src, "#!") {
+		src = afterLine(src)
+	}
+	var lines []string
+	for {
+		src = strings.TrimLeft(src, " \t\r\n")
+		if !strings.HasPrefix(src, "--") {
+			break
+		}
+		src = src[2:]
+		if level, ok := longBracket(src); ok {
+			end := "]" + strings.Repeat("=", level) + "]"
+			src = src[level+2:]
+			i := strings.Index(src, end)
+			if i < 0 {
+				break
+			}
+			lines = append(lines, strings.TrimSpace(textutil.Unindent(strings.Trim(src[:i], "\r\n"))))
+			src = src[i+len(end):]
+			continue
+		}
+		i := strings.Index(src, "\n")
+		if i < 0 {
+			i = len(src)
+		}
+		lines = append(lines, strings.TrimSpace(strings.TrimLeft(src[:i], "-")))
+		src = afterLine(src)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// longBracket returns the level of the opening long bracket at the start of
+// s.
+func longBracket(s string) (level int, ok bool) {
+	if !strings.HasPrefix(s, "[") {
+		return 0, false
+	}
+	level = len(s[1:]) - len(strings.TrimLeft(s[1:], "="))
+	if !strings.HasPrefix(s[1+level:], "[") {
+		return 0, false
+	}
+	return level, true
+}
+
+// afterLine returns s after its first newline.
+func afterLine(s string) string {
+	i := strings.Index(s, "\n")
+	if i < 0 {
+		return ""
+	}
+	return s[i+1:]
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bmatsuo/lark/project"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestLeadingComment(t *testing.T) {
+	for _, test := range []struct {
+		src     string
+		comment string
+	}{
+		{"", ""},
+		{"local M = {}\n-- not a doc comment\n", ""},
+		{"-- Module foo does things.\n-- More text.\nlocal M = {}\n", "Module foo does things.\nMore text."},
+		{"#!/usr/bin/env lua\n--- Script.\nprint()\n", "Script."},
+		{"--[[\n    Module bar does things.\n\n    More text.\n]]\nlocal M = {}\n", "Module bar does things.\n\nMore text."},
+		{"--[==[ Nested ]] brackets. ]==]\n", "Nested ]] brackets."},
+		{"--[[ Unterminated", ""},
+	} {
+		comment := leadingComment(test.src)
+		if comment != test.comment {
+			t.Errorf("source %q: comment %q (!= %q)", test.src, comment, test.comment)
+		}
+	}
+}
+
+func TestModuleSynopsis(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lark-modules-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	good := filepath.Join(dir, "good.lua")
+	bad := filepath.Join(dir, "bad.lua")
+	ioutil.WriteFile(good, []byte("-- Good is a module.  It is not run.\nerror('ran')\n"), 0644)
+	ioutil.WriteFile(bad, []byte("-- Bad does not compile.\nlocal = 1\n"), 0644)
+
+	l := lua.NewState()
+	defer l.Close()
+	synopsis, err := moduleSynopsis(l, &project.ModuleFile{Name: "good", Path: good})
+	if err != nil {
+		t.Error(err)
+	} else if synopsis != "Good is a module." {
+		t.Errorf("synopsis: %q", synopsis)
+	}
+	_, err = moduleSynopsis(l, &project.ModuleFile{Name: "bad", Path: bad})
+	if err == nil {
+		t.Errorf("no error for a module that does not compile")
+	}
+}
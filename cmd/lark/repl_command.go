@@ -9,7 +9,7 @@ import (
 	"strings"
 
 	"github.com/bmatsuo/lark/lib"
-	"github.com/bmatsuo/lark/project"
+	"github.com/bmatsuo/lark/lib/fs"
 	"github.com/chzyer/readline"
 	"github.com/codegangsta/cli"
 	"github.com/fatih/color"
@@ -33,26 +33,31 @@ func REPL(c *Context) {
 	log.Print(msg)
 	log.Println()
 
-	luaFiles, err := project.FindTaskFiles(".")
+	luaFiles, err := FindProject(c)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	luaConfig := &LuaConfig{}
+	luaConfig := &LuaConfig{Dir: c.root, Layout: c.layout()}
 	c.Lua, err = LoadVM(luaConfig)
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		exit(c, 1)
 	}
 	defer c.Lua.Close()
+	defer CloseSubprojects(c)
+	defer fs.Cleanup(c.Lua)
 
 	err = InitLark(c, luaFiles)
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		exit(c, 1)
 	}
 
 	err = LuaInteractive(c)
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		exit(c, 1)
 	}
 }
 
@@ -128,7 +133,7 @@ documentation may be inspected
 func RunREPL(state *lua.LState) error {
 	rl, err := readline.New("> ")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer rl.Close()
 
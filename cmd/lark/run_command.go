@@ -6,12 +6,14 @@ import (
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"regexp"
 	"strings"
 	"unicode"
 
+	"github.com/bmatsuo/lark/lib/fs"
 	"github.com/bmatsuo/lark/lib/lark/core"
-	"github.com/bmatsuo/lark/project"
+	"github.com/bmatsuo/lark/runner"
 	"github.com/codegangsta/cli"
 	"github.com/yuin/gopher-lua"
 )
@@ -23,18 +25,48 @@ var CommandRun = Command(func(lark *Context, cmd *cli.Command) {
 	cmd.Usage = "Run lark project task(s)"
 	cmd.ArgsUsage = `task ...
 
-    The arguments are the names of tasks from lark.lua.`
+    The arguments are the names of tasks from lark.lua.  A task name prefixed
+    by the directory of a nested project and a colon (e.g. svc/a:build) runs
+    the task in that subproject.`
+	cmd.Description = `
+    Run the named tasks, or the default task if none are named.  The exit
+    status indicates the reason lark failed.
+
+        1    A command failed (see -x)
+        2    A lua script failed to load or raised an error
+        3    A named task does not exist
+        4    The project could not be found or loaded
+        64   The command line is invalid
+        130  Lark was interrupted
+
+    When a task fails the command that caused the failure, its exit status,
+    and the stack of running tasks are logged in a summary.`
 	cmd.Flags = []cli.Flag{
 		cli.StringFlag{
 			Name:   "C",
 			Usage:  "Change the working directory before loading files and running tasks",
 			EnvVar: "LARK_RUN_DIRECTORY",
 		},
+		cli.StringSliceFlag{
+			Name:  "D",
+			Usage: "Set a global variable after loading files (e.g. -D CC=clang).",
+			Value: &cli.StringSlice{},
+		},
 		cli.IntFlag{
 			Name:   "j",
 			Usage:  "Number of parallel processes.",
 			EnvVar: "LARK_RUN_PARALLEL",
 		},
+		cli.BoolFlag{
+			Name:   "k",
+			Usage:  "Keep going after a task fails and report all failures at exit.",
+			EnvVar: "LARK_RUN_KEEP_GOING",
+		},
+		cli.BoolFlag{
+			Name:   "x",
+			Usage:  "Exit with the status of the command that caused the first failure.",
+			EnvVar: "LARK_RUN_EXIT_STATUS",
+		},
 		cli.BoolFlag{
 			Name:        "v",
 			Usage:       "Enable verbose reporting of errors.",
@@ -47,22 +79,50 @@ var CommandRun = Command(func(lark *Context, cmd *cli.Command) {
 
 // Run loads a lua vm and runs tasks specified in the command line.
 func Run(c *Context) {
+	var err error
 	chdir := c.String("C")
 	if chdir != "" {
 		err := os.Chdir(chdir)
 		if err != nil {
-			log.Fatal(err)
+			log.Print(err)
+			exit(c, ExitUsage)
 		}
 	}
 
-	core.InitModule(os.Stderr, c.Int("j"))
+	c.overrides, err = ParseOverrides(c.StringSlice("D"))
+	if err != nil {
+		log.Print(err)
+		exit(c, ExitUsage)
+	}
+
+	luaFiles, err := FindProject(c)
+	if err != nil {
+		log.Print(err)
+		exit(c, ExitProjectError)
+	}
+
+	parallel := c.config.Int("parallel")
+	if c.IsSet("j") {
+		parallel = c.Int("j")
+	}
+	core.InitModule(os.Stderr, parallel)
+	c.keepGoing = c.config.Bool("keep_going")
+	if c.IsSet("k") {
+		c.keepGoing = c.Bool("k")
+	}
+
+	interrupts := make(chan os.Signal, 2)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go handleInterrupts(interrupts)
 
 	args := c.Args()
 	var tasks []*Task
 	for {
 		t, n, err := ParseTask(args)
 		if err != nil {
-			log.Fatalf("task %d: %v", len(tasks), err)
+			log.Printf("task %d: %v", len(tasks), err)
+			exit(c, ExitUsage)
 		}
 		if n == 0 {
 			break
@@ -74,27 +134,195 @@ func Run(c *Context) {
 		tasks = []*Task{{}}
 	}
 
-	luaFiles, err := project.FindTaskFiles("")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	luaConfig := &LuaConfig{}
+	luaConfig := &LuaConfig{Dir: c.root, Layout: c.layout()}
 	c.Lua, err = LoadVM(luaConfig)
 	if err != nil {
-		log.Fatal(err)
+		// LoadVM logs the error.
+		exit(c, ExitProjectError)
 	}
 	defer c.Lua.Close()
+	defer CloseSubprojects(c)
+	defer fs.Cleanup(c.Lua)
 
 	err = InitLark(c, luaFiles)
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		exit(c, ExitScriptError)
 	}
 
-	for _, task := range tasks {
-		err := RunTask(c, task)
+	// resolve the state and local name of each task before running any.
+	contexts := make([]*Context, len(tasks))
+	local := make([]*Task, len(tasks))
+	for i, task := range tasks {
+		tc, t := c, task
+		dir, name := SplitSubproject(c, task.Name)
+		if dir != "" {
+			tc, err = Subproject(c, dir)
+			if err != nil {
+				log.Print(err)
+				exit(c, ExitScriptError)
+			}
+			t = &Task{Name: name, Params: task.Params}
+		}
+		err = checkTask(tc, t)
 		if err != nil {
-			os.Exit(1)
+			log.Print(err)
+			exit(c, ExitUnknownTask)
+		}
+		contexts[i], local[i] = tc, t
+	}
+
+	failures := runTasks(tasks, contexts, local, c.keepGoing)
+	if len(failures) > 0 {
+		logFailureSummary(failures)
+		exit(c, exitCode(failures, c.Bool("x")))
+	}
+}
+
+// runTasks runs each task in tasks using the corresponding context and local
+// task and returns the failures.  Unless keepGoing is true no task is run
+// after a task fails.  No task is run after lark is interrupted.
+func runTasks(tasks []*Task, contexts []*Context, local []*Task, keepGoing bool) []*TaskFailure {
+	var failures []*TaskFailure
+	for i, task := range tasks {
+		ncmd := len(core.Failures())
+		err := RunTask(contexts[i], local[i])
+		if err == nil {
+			continue
+		}
+		f := &TaskFailure{
+			Task:        task,
+			Err:         err,
+			Interrupted: core.Interrupted(),
+		}
+		cmds := core.Failures()
+		if len(cmds) > ncmd {
+			f.Command = cmds[ncmd]
+		}
+		failures = append(failures, f)
+		if !keepGoing || f.Interrupted {
+			break
+		}
+	}
+	return failures
+}
+
+// exit removes temporary files created by the lua states of c and exits with
+// code.
+func exit(c *Context, code int) {
+	CloseSubprojects(c)
+	if c.Lua != nil {
+		fs.Cleanup(c.Lua)
+	}
+	os.Exit(code)
+}
+
+// Exit codes of the run command.
+const (
+	ExitFailure      = 1
+	ExitScriptError  = 2
+	ExitUnknownTask  = 3
+	ExitProjectError = 4
+	ExitUsage        = 64
+	ExitInterrupted  = 130
+)
+
+// exitCode returns the exit code for failures.  If passthrough is true and the
+// first failure was caused by a command the command's exit status is
+// returned.
+func exitCode(failures []*TaskFailure, passthrough bool) int {
+	for _, f := range failures {
+		if f.Interrupted {
+			return ExitInterrupted
+		}
+	}
+	f := failures[0]
+	switch {
+	case f.Command == nil:
+		return ExitScriptError
+	case passthrough && f.Command.Status > 0:
+		return f.Command.Status
+	default:
+		return ExitFailure
+	}
+}
+
+// checkTask returns an error if task is not defined in the state of c.
+func checkTask(c *Context, task *Task) error {
+	l := c.Lua
+	l.Push(l.GetGlobal("require"))
+	l.Push(lua.LString("lark.task"))
+	err := l.PCall(1, 1, nil)
+	if err != nil {
+		return err
+	}
+	mod := l.Get(-1)
+	l.Pop(1)
+
+	l.Push(l.GetField(mod, "find"))
+	if task.Name != "" {
+		l.Push(lua.LString(task.Name))
+	}
+	err = l.PCall(l.GetTop()-1, 1, nil)
+	if apierr, ok := err.(*lua.ApiError); ok {
+		return fmt.Errorf("%s", trimLoc(lua.LVAsString(apierr.Object)))
+	}
+	if err != nil {
+		return err
+	}
+	found := l.Get(-1) != lua.LNil
+	l.Pop(1)
+	if !found && task.Name == "" {
+		return fmt.Errorf("no default task")
+	}
+	if !found {
+		return fmt.Errorf("no task matching name: %s", task.Name)
+	}
+	return nil
+}
+
+// handleInterrupts fails the running task after the first interrupt so that
+// task hooks can clean up.  A second interrupt removes temporary directories
+// and terminates the process immediately.
+func handleInterrupts(interrupts <-chan os.Signal) {
+	<-interrupts
+	core.Log("interrupted: waiting for tasks to clean up", &core.LogOpt{
+		Color: "yellow",
+	})
+	core.Interrupt()
+	<-interrupts
+	fs.CleanupAll()
+	os.Exit(ExitInterrupted)
+}
+
+// TaskFailure is a task invocation from the command line that did not
+// complete successfully.
+type TaskFailure struct {
+	Task *Task
+	Err  error
+	// Command is the first command that failed while the task was running,
+	// or nil if the task failed because of a lua error.
+	Command     *core.Failure
+	Interrupted bool
+}
+
+func logFailureSummary(failures []*TaskFailure) {
+	opt := &core.LogOpt{Color: "red"}
+	core.Log(fmt.Sprintf("%d task(s) failed:", len(failures)), opt)
+	for _, f := range failures {
+		name := f.Task.Name
+		if name == "" {
+			name = "(default)"
+		}
+		msg := strings.SplitN(trimLoc(f.Err.Error()), "\n", 2)[0]
+		core.Log(fmt.Sprintf("    %s: %s", name, msg), opt)
+		if f.Command != nil {
+			core.Log(fmt.Sprintf("        command: %s", f.Command.Command), opt)
+			core.Log(fmt.Sprintf("        exit status: %d", f.Command.Status), opt)
+			if len(f.Command.Tasks) > 0 {
+				stack := strings.Join(f.Command.Tasks, " > ")
+				core.Log(fmt.Sprintf("        tasks: %s", stack), opt)
+			}
 		}
 	}
 }
@@ -111,11 +339,20 @@ func normTasks(args []string) ([]string, error) {
 	return args, nil
 }
 
-// RunTask calls lark.run in state to execute task.
+// RunTask calls lark.run in state to execute task.  The working directory is
+// changed to the project root of c while the task runs.
 func RunTask(c *Context, task *Task) error {
+	if c.root != "" {
+		restore, err := runner.Chdir(c.root)
+		if err != nil {
+			return err
+		}
+		defer restore()
+	}
+
 	lark := c.Lua.GetGlobal("lark")
 	run := c.Lua.GetField(lark, "run")
-	trace := c.Lua.NewFunction(errTraceback)
+	trace := c.Lua.NewFunction(runner.Traceback)
 
 	narg := 1
 	c.Lua.Push(run)
@@ -223,6 +460,26 @@ func ParseTask(args []string) (*Task, int, error) {
 	return t, 1 + len(t.Params), nil
 }
 
+// ParseOverrides parses global variable overrides given as NAME=value.
+func ParseOverrides(defs []string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	for _, def := range defs {
+		pieces := strings.SplitN(def, "=", 2)
+		if len(pieces) == 1 {
+			return nil, fmt.Errorf("variable %q: missing value", def)
+		}
+		err := sanitizeParam(pieces[0])
+		if err != nil {
+			return nil, fmt.Errorf("variable %q: %v", pieces[0], err)
+		}
+		if unicode.IsDigit(rune(pieces[0][0])) {
+			return nil, fmt.Errorf("variable %q: name begins with a digit", pieces[0])
+		}
+		overrides[pieces[0]] = pieces[1]
+	}
+	return overrides, nil
+}
+
 func sanitizeParam(name string) error {
 	if len(name) == 0 {
 		return fmt.Errorf("missing param name")
@@ -241,13 +498,3 @@ var reLoc = regexp.MustCompile(`^[^:]+:\d+:\s*`)
 func trimLoc(msg string) string {
 	return reLoc.ReplaceAllString(msg, "")
 }
-
-func errTraceback(L *lua.LState) int {
-	msg := L.Get(1)
-	L.SetTop(0)
-	L.Push(L.GetField(L.GetGlobal("debug"), "traceback"))
-	L.Push(msg)
-	L.Push(lua.LNumber(2))
-	L.Call(2, 1)
-	return 1
-}
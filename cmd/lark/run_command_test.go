@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/lark/lib/lark/core"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestExitCode(t *testing.T) {
+	err := errors.New("failed")
+	cmd := &TaskFailure{Err: err, Command: &core.Failure{Status: 7}}
+	script := &TaskFailure{Err: err}
+	signaled := &TaskFailure{Err: err, Command: &core.Failure{Status: -1}}
+	interrupted := &TaskFailure{Err: err, Interrupted: true}
+
+	for i, test := range []struct {
+		failures    []*TaskFailure
+		passthrough bool
+		code        int
+	}{
+		{[]*TaskFailure{cmd}, false, ExitFailure},
+		{[]*TaskFailure{cmd}, true, 7},
+		{[]*TaskFailure{signaled}, true, ExitFailure},
+		{[]*TaskFailure{script, cmd}, true, ExitScriptError},
+		{[]*TaskFailure{cmd, interrupted}, true, ExitInterrupted},
+	} {
+		code := exitCode(test.failures, test.passthrough)
+		if code != test.code {
+			t.Errorf("test %d: exit code %d (!= %d)", i, code, test.code)
+		}
+	}
+}
+
+// testContext returns a Context with a lua state that has loaded a lark.lua
+// file containing src.
+func testContext(t *testing.T, src string) (*Context, func()) {
+	root, err := ioutil.TempDir("", "lark-run-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(root, "lark.lua")
+	err = ioutil.WriteFile(path, []byte(src), 0644)
+	if err != nil {
+		os.RemoveAll(root)
+		t.Fatal(err)
+	}
+	c := &Context{root: root}
+	c.Lua, err = LoadVM(&LuaConfig{Dir: root})
+	if err != nil {
+		os.RemoveAll(root)
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		c.Lua.Close()
+		os.RemoveAll(root)
+	}
+	err = InitLark(c, []string{path})
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return c, cleanup
+}
+
+func TestRunTask_hooksFailure(t *testing.T) {
+	rec := testLogging(t, true)
+	defer rec.Reset()
+
+	c, cleanup := testContext(t, `
+local task = require('lark.task')
+
+f = task.hooks{before = function() end} .. task .. function()
+	lark.exec('false')
+end
+`)
+	defer cleanup()
+
+	task := &Task{Name: "f"}
+	err := checkTask(c, task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- RunTask(c, task) }()
+	select {
+	case err = <-errc:
+	case <-time.After(10 * time.Second):
+		t.Fatal("task did not return")
+	}
+	if err == nil {
+		t.Fatal("task did not fail")
+	}
+	if n := strings.Count(err.Error(), "stack traceback"); n != 1 {
+		t.Errorf("error has %d tracebacks: %v", n, err)
+	}
+}
+
+func TestRunTasks_keepGoing(t *testing.T) {
+	rec := testLogging(t, false)
+	defer rec.Reset()
+
+	for _, keepGoing := range []bool{false, true} {
+		c, cleanup := testContext(t, `
+local task = require('lark.task')
+
+a = task .. function()
+	lark.start('false', {group='a'})
+	lark.wait('a')
+	a_finished = true
+end
+
+b = task .. function()
+	b_finished = true
+end
+`)
+		tasks := []*Task{{Name: "a"}, {Name: "b"}}
+		failures := runTasks(tasks, []*Context{c, c}, tasks, keepGoing)
+		if len(failures) != 1 || failures[0].Task != tasks[0] {
+			t.Errorf("keep going %v: failures %v", keepGoing, failures)
+		}
+		if c.Lua.GetGlobal("a_finished") != lua.LNil {
+			t.Errorf("keep going %v: failed task was not aborted", keepGoing)
+		}
+		if lua.LVAsBool(c.Lua.GetGlobal("b_finished")) != keepGoing {
+			t.Errorf("keep going %v: b_finished %v", keepGoing, c.Lua.GetGlobal("b_finished"))
+		}
+		cleanup()
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatsuo/lark/lib/fs"
+	"github.com/bmatsuo/lark/project"
+	"github.com/bmatsuo/lark/runner"
+)
+
+// SubprojectSep separates a subproject directory from a task name on the
+// command line (e.g. "svc/a:build").
+const SubprojectSep = ":"
+
+// Subproject returns the context for the project rooted at dir, a path
+// relative to the root of c.  Subprojects are loaded into an isolated
+// lua.LState with their own module path and configuration, and share the
+// lark.core module (and its scheduler) and the variable overrides of c.  A
+// subproject is only loaded once.  The working directory is changed to the
+// subproject root while its files are loaded, and RunTask changes it while the
+// subproject's tasks run, so relative paths are resolved as if lark were run
+// in the subproject.
+func Subproject(c *Context, dir string) (*Context, error) {
+	root := dir
+	if !filepath.IsAbs(root) {
+		root = filepath.Join(c.root, dir)
+	}
+	root = filepath.Clean(root)
+
+	if c.subprojects == nil {
+		c.subprojects = make(map[string]*Context)
+	}
+	sub, ok := c.subprojects[root]
+	if ok {
+		return sub, nil
+	}
+
+	conf, err := subprojectConfig(root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", dir, err)
+	}
+	if conf == nil {
+		return nil, fmt.Errorf("%s: not a lark project", dir)
+	}
+
+	sub = &Context{
+		Context:       c.Context,
+		verbose:       c.verbose,
+		keepGoing:     c.keepGoing,
+		disableDocs:   c.disableDocs,
+		overrides:     c.overrides,
+		config:        conf,
+		root:          root,
+		invocationDir: c.invocationDir,
+		subprojects:   c.subprojects,
+	}
+	luaFiles, err := sub.layout().FindTaskFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	sub.Lua, err = LoadVM(&LuaConfig{Dir: root, Layout: sub.layout()})
+	if err != nil {
+		return nil, err
+	}
+	c.subprojects[root] = sub
+
+	restore, err := runner.Chdir(root)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+	err = InitLark(sub, luaFiles)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", dir, err)
+	}
+	return sub, nil
+}
+
+// subprojectConfig returns the configuration of the project in root, read
+// with project.LoadConfig.  If root is not the root of a project nil is
+// returned.
+func subprojectConfig(root string) (*project.Config, error) {
+	conf, err := project.LoadConfig(root)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := conf.Layout().IsRoot(root)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// CloseSubprojects closes the lua.LState of every subproject loaded by c.
+func CloseSubprojects(c *Context) {
+	for root, sub := range c.subprojects {
+		fs.Cleanup(sub.Lua)
+		sub.Lua.Close()
+		delete(c.subprojects, root)
+	}
+}
+
+// SplitSubproject separates a task name given on the command line into a
+// subproject directory and a task name.  If name is not prefixed by the
+// directory of a project an empty directory is returned.
+func SplitSubproject(c *Context, name string) (dir, task string) {
+	i := strings.Index(name, SubprojectSep)
+	if i <= 0 {
+		return "", name
+	}
+	dir = name[:i]
+	conf, err := subprojectConfig(filepath.Join(c.root, dir))
+	if err == nil && conf == nil {
+		return "", name
+	}
+	return dir, name[i+len(SubprojectSep):]
+}
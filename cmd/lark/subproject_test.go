@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestSubproject(t *testing.T) {
+	rec := testLogging(t, false)
+	defer rec.Reset()
+
+	c, cleanup := testContext(t, "")
+	defer cleanup()
+	c.overrides = map[string]string{"greeting": "hi"}
+
+	sub := filepath.Join(c.root, "sub")
+	err := os.Mkdir(sub, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(sub, "lark.lua"), []byte(`
+local task = require('lark.task')
+
+greeting = lark.var('greeting', 'hello')
+
+build = task .. function()
+	lark.exec{'sh', '-c', 'echo ' .. greeting .. ' > out.txt'}
+	local f = io.open('marker.txt')
+	found_marker = f ~= nil
+	if f then
+		f:close()
+	end
+end
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(sub, "marker.txt"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the subproject configuration sets its task directory.
+	err = os.Mkdir(filepath.Join(sub, "tasks"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(sub, ".lark.toml"), []byte(`task_dir = "tasks"`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(sub, "tasks", "extra.lua"), []byte(`extra_loaded = true`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	err = os.Chdir(c.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Lua.DoString(`lark.subproject('sub').run('build')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subc := c.subprojects[sub]
+	if subc == nil {
+		t.Fatalf("subproject was not loaded")
+	}
+	defer CloseSubprojects(c)
+
+	// commands run in the subproject root and see the parent's overrides.
+	out, err := ioutil.ReadFile(filepath.Join(sub, "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "hi\n" {
+		t.Errorf("output: %q", out)
+	}
+	if subc.Lua.GetGlobal("extra_loaded") != lua.LTrue {
+		t.Errorf("subproject configuration was not read")
+	}
+	// other relative paths are resolved against the subproject root.
+	if subc.Lua.GetGlobal("found_marker").String() != "true" {
+		t.Errorf("relative path was not resolved against the subproject root")
+	}
+
+	// tasks given on the command line (e.g. sub:build) run the same way.
+	subc.Lua.SetGlobal("found_marker", lua.LNil)
+	err = RunTask(subc, &Task{Name: "build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subc.Lua.GetGlobal("found_marker").String() != "true" {
+		t.Errorf("relative path was not resolved against the subproject root")
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cwd != c.root {
+		t.Errorf("working directory was not restored: %s", cwd)
+	}
+}
@@ -97,6 +97,9 @@ func (m *simpleModule) Loader(l *lua.LState) int {
 }
 
 func (m *simpleModule) Deps() []Module {
+	if m.deps == nil {
+		return nil
+	}
 	return m.deps()
 }
 
@@ -74,6 +74,14 @@ func TestResolve(t *testing.T) {
 	}
 }
 
+func TestResolve_simple(t *testing.T) {
+	m := Simple("simple1", nil)
+	mods := Resolve(m)
+	if len(mods) != 1 || mods[0].Name() != m.Name() {
+		t.Errorf("modules: %v", mods)
+	}
+}
+
 func basicTestLoader(l *lua.LState) int {
 	mod := l.NewTable()
 
@@ -1,5 +1,7 @@
 local task = require('lark.task')
 local path = require('path')
+local fs = require('fs')
+local archive = require('archive')
 local version = require('version')
 local moses = require('moses')
 
@@ -14,7 +16,7 @@ release = task .. function()
     local dist_template = name .. '-{{.OS}}-{{.Arch}}'
     local release_dir = path.join(release_root, name)
     local path_template = path.join(release_dir, dist_template, '{{.Dir}}')
-    lark.exec{'mkdir', '-p', 'release'}
+    fs.mkdir_all(release_root)
     lark.exec{'gox', '-os=!plan9', '-output='..path_template, '-ldflags='..ldflags, './cmd/...'}
     local dist_pattern = path.join(release_dir, '*')
     local dist_dirs = path.glob(dist_pattern)
@@ -22,21 +24,18 @@ release = task .. function()
     dist_dirs = moses.reject(dist_dirs, function(_, dist) return ext_is(dist, '.zip') end)
     dist_dirs = moses.reject(dist_dirs, function(_, dist) return ext_is(dist, '.gz') end)
     for i, dist in pairs(dist_dirs) do
-        lark.exec{'cp', 'README.md', 'CHANGES.md', 'LICENSE', 'AUTHORS', dist}
-        lark.exec{'cp', '-r', 'docs', dist}
+        for _, file in pairs{'README.md', 'CHANGES.md', 'LICENSE', 'AUTHORS', 'docs'} do
+            fs.copy(file, path.join(dist, file))
+        end
 
         local name = path.base(dist)
         if string.find(name, 'darwin') or string.find(name, 'windows') then
-            local files = path.glob(path.join(dist, '*'))
-            for i, fp in pairs(files) do
-                files[i] = string.sub(fp, string.len(release_dir)+2)
-            end
-            lark.exec{'zip', '-o', name .. '.zip', files,
-                      dir=release_dir}
+            archive.create(path.join(release_dir, name .. '.zip'), dist,
+                           {strip_prefix=release_dir, reproducible=true})
         else
-            lark.exec{'tar', '-cvzf', name .. '.tar.gz', name,
-                      dir=release_dir}
+            archive.create(path.join(release_dir, name .. '.tar.gz'), dist,
+                           {strip_prefix=release_dir, reproducible=true})
         end
-        lark.exec{'rm', '-r', dist}
+        fs.remove_all(dist)
     end
 end
@@ -0,0 +1,221 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bmatsuo/lark/gluamodule"
+	"github.com/bmatsuo/lark/lib/doc"
+	"github.com/yuin/gopher-lua"
+)
+
+// Module is a gluamodule.Module that loads the archive module.
+var Module = gluamodule.New("archive", Loader,
+	doc.Module,
+)
+
+// Loader preloads the archive module so that it can be required in lua
+// scripts.
+func Loader(l *lua.LState) int {
+	l.Pop(1) // first argument is the module name
+
+	mod := l.NewTable()
+	doc.Go(l, mod, &doc.Docs{
+		Desc: `
+		The archive module creates and extracts zip, tar, and gzipped tar
+		archives without external programs.  Unless an option specifies the
+		format, it is determined by the extension of the archive (".zip",
+		".tar", ".tar.gz", or ".tgz").
+		`,
+	})
+
+	set := func(name string, fn lua.LGFunction, docs *doc.Docs) {
+		lfn := l.NewClosure(fn)
+		doc.Go(l, lfn, docs)
+		l.SetField(mod, name, lfn)
+	}
+
+	set("create", LuaCreate, &doc.Docs{
+		Sig: "(path, files, opt) => ()",
+		Desc: `
+		Creates an archive containing files.  Directories are added
+		recursively and symbolic links are added as links.
+		`,
+		Params: []string{
+			"path   The archive to create",
+			"files  A path or glob pattern, or an array of them",
+			"opt    Optional table of options",
+		},
+		Vars: []string{
+			"opt.format        The archive format: \"zip\", \"tar\", or \"tar.gz\"",
+			"opt.strip_prefix  A directory removed from the path of each file to form its name in the archive",
+			"opt.prefix        A directory prepended to the name of each file in the archive",
+			"opt.mode          The permission bits of every file in the archive as a string of octal digits (e.g. \"0644\") or a decimal number (e.g. 420)",
+			"opt.dir_mode      The permission bits of every directory in the archive, like opt.mode",
+			"opt.reproducible  Sort entries and fix their owners and modification times so that archives of identical files are identical",
+			"opt.mtime         The modification time of entries in a reproducible archive, in seconds since the Unix epoch (default 1980-01-01)",
+		},
+	})
+	set("extract", LuaExtract, &doc.Docs{
+		Sig: "(path, dir, opt) => ()",
+		Desc: `
+		Extracts an archive into a directory.  An error is raised if an entry
+		would be written outside of dir or through a symbolic link extracted
+		from the archive.
+		`,
+		Params: []string{
+			"path  The archive to extract",
+			"dir   The destination directory",
+			"opt   Optional table of options",
+		},
+		Vars: []string{
+			"opt.format            The archive format",
+			"opt.strip_components  The number of leading directories removed from entry names",
+		},
+	})
+	set("list", LuaList, &doc.Docs{
+		Sig:  "(path, opt) => [string]",
+		Desc: "Returns the names of the entries in an archive.  Directory names end with a slash.",
+		Params: []string{
+			"path  The archive",
+			"opt   Optional table of options",
+		},
+		Vars: []string{
+			"opt.format  The archive format",
+		},
+	})
+
+	l.Push(mod)
+	return 1
+}
+
+// Exports defines the exported functions in the archive module.
+var Exports = map[string]lua.LGFunction{
+	"create":  LuaCreate,
+	"extract": LuaExtract,
+	"list":    LuaList,
+}
+
+// LuaCreate creates an archive.
+func LuaCreate(state *lua.LState) int {
+	dest := state.CheckString(1)
+	var files []string
+	switch v := state.CheckAny(2).(type) {
+	case lua.LString:
+		files = []string{string(v)}
+	case *lua.LTable:
+		for i := 1; i <= v.Len(); i++ {
+			s, ok := v.RawGetInt(i).(lua.LString)
+			if !ok {
+				state.ArgError(2, "array contains a non-string value")
+			}
+			files = append(files, string(s))
+		}
+	default:
+		state.ArgError(2, "files is not a string or table: "+v.Type().String())
+	}
+	opt := &CreateOpt{}
+	if lopt := state.OptTable(3, nil); lopt != nil {
+		opt.Format = optString(state, 3, lopt, "format")
+		opt.StripPrefix = optString(state, 3, lopt, "strip_prefix")
+		opt.Prefix = optString(state, 3, lopt, "prefix")
+		opt.Mode = optMode(state, 3, lopt, "mode")
+		opt.DirMode = optMode(state, 3, lopt, "dir_mode")
+		opt.Reproducible = lua.LVAsBool(state.GetField(lopt, "reproducible"))
+		switch mtime := state.GetField(lopt, "mtime").(type) {
+		case lua.LNumber:
+			opt.ModTime = time.Unix(int64(mtime), 0).UTC()
+		default:
+			if mtime != lua.LNil {
+				state.ArgError(3, "named value 'mtime' is not a number: "+mtime.Type().String())
+			}
+		}
+	}
+	err := Create(dest, files, opt)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+	}
+	return 0
+}
+
+// LuaExtract extracts an archive.
+func LuaExtract(state *lua.LState) int {
+	src := state.CheckString(1)
+	dest := state.CheckString(2)
+	opt := &ExtractOpt{}
+	if lopt := state.OptTable(3, nil); lopt != nil {
+		opt.Format = optString(state, 3, lopt, "format")
+		switch n := state.GetField(lopt, "strip_components").(type) {
+		case lua.LNumber:
+			opt.StripComponents = int(n)
+		default:
+			if n != lua.LNil {
+				state.ArgError(3, "named value 'strip_components' is not a number: "+n.Type().String())
+			}
+		}
+	}
+	err := Extract(src, dest, opt)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+	}
+	return 0
+}
+
+// LuaList lists the entries of an archive.
+func LuaList(state *lua.LState) int {
+	src := state.CheckString(1)
+	var format string
+	if lopt := state.OptTable(2, nil); lopt != nil {
+		format = optString(state, 2, lopt, "format")
+	}
+	names, err := List(src, format)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	t := state.NewTable()
+	for _, name := range names {
+		t.Append(lua.LString(name))
+	}
+	state.Push(t)
+	return 1
+}
+
+// optString returns a named string option.
+func optString(state *lua.LState, n int, opt *lua.LTable, name string) string {
+	switch v := state.GetField(opt, name).(type) {
+	case lua.LString:
+		return string(v)
+	default:
+		if v != lua.LNil {
+			state.ArgError(n, "named value '"+name+"' is not a string: "+v.Type().String())
+		}
+		return ""
+	}
+}
+
+// optMode returns a file mode given as a number or a string of octal digits.
+// Numbers are decimal, so a number that is not valid permission bits (e.g. 755
+// meant as octal) is an error, as is a string of more than permission bits.
+func optMode(state *lua.LState, n int, opt *lua.LTable, name string) os.FileMode {
+	switch v := state.GetField(opt, name).(type) {
+	case lua.LNumber:
+		if v < 0 || v > lua.LNumber(os.ModePerm) || v != lua.LNumber(int(v)) {
+			state.ArgError(n, fmt.Sprintf("named value '%s' is not permission bits: %v (use an octal string like \"0755\")", name, v))
+		}
+		return os.FileMode(v)
+	case lua.LString:
+		m, err := strconv.ParseUint(string(v), 8, 32)
+		if err != nil || m > uint64(os.ModePerm) {
+			state.ArgError(n, "named value '"+name+"' is not an octal mode: "+string(v))
+		}
+		return os.FileMode(m)
+	default:
+		if v != lua.LNil {
+			state.ArgError(n, "named value '"+name+"' is not a number or string: "+v.Type().String())
+		}
+		return 0
+	}
+}
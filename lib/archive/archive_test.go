@@ -0,0 +1,225 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/lark/gluatest"
+)
+
+var luaArchiveTest = &gluatest.File{
+	Module: Module,
+	Path:   "archive_test.lua",
+}
+
+func TestModule(t *testing.T) {
+	luaArchiveTest.Test(t)
+}
+
+func BenchmarkRequireModule(b *testing.B) {
+	file := &gluatest.File{Module: Module}
+	file.BenchmarkRequireModule(b)
+}
+
+// testTree creates a directory tree in a temporary directory.
+func testTree(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "lark-archive-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"src/a.txt":     "a",
+		"src/sub/b.txt": "b",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = os.Symlink("a.txt", filepath.Join(dir, "src/link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCreateExtract(t *testing.T) {
+	dir := testTree(t)
+	defer os.RemoveAll(dir)
+
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		archive := filepath.Join(dir, "out"+ext)
+		err := Create(archive, []string{filepath.Join(dir, "src")}, &CreateOpt{
+			StripPrefix:  dir,
+			Prefix:       "pkg",
+			Mode:         0640,
+			Reproducible: true,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		names, err := List(archive, "")
+		if err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		expect := []string{"pkg/src/", "pkg/src/a.txt", "pkg/src/link", "pkg/src/sub/", "pkg/src/sub/b.txt"}
+		if !reflect.DeepEqual(names, expect) {
+			t.Errorf("%s: names %q (expected %q)", ext, names, expect)
+		}
+
+		dest := filepath.Join(dir, "extract"+ext)
+		err = Extract(archive, dest, &ExtractOpt{StripComponents: 1})
+		if err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		p, err := ioutil.ReadFile(filepath.Join(dest, "src/sub/b.txt"))
+		if err != nil || string(p) != "b" {
+			t.Errorf("%s: content %q (%v)", ext, p, err)
+		}
+		info, err := os.Stat(filepath.Join(dest, "src/a.txt"))
+		if err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		if info.Mode().Perm() != 0640 {
+			t.Errorf("%s: mode %v", ext, info.Mode())
+		}
+		if !info.ModTime().Equal(ReproducibleTime) {
+			t.Errorf("%s: mtime %v", ext, info.ModTime())
+		}
+		link, err := os.Readlink(filepath.Join(dest, "src/link"))
+		if err != nil || link != "a.txt" {
+			t.Errorf("%s: link %q (%v)", ext, link, err)
+		}
+	}
+}
+
+func TestCreate_reproducible(t *testing.T) {
+	dir := testTree(t)
+	defer os.RemoveAll(dir)
+
+	for _, ext := range []string{".zip", ".tar.gz"} {
+		var content [][]byte
+		for i := 0; i < 2; i++ {
+			now := time.Now().Add(time.Duration(i) * time.Hour)
+			err := os.Chtimes(filepath.Join(dir, "src/a.txt"), now, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			archive := filepath.Join(dir, "out"+ext)
+			err = Create(archive, []string{filepath.Join(dir, "src")}, &CreateOpt{
+				StripPrefix:  dir,
+				Reproducible: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := ioutil.ReadFile(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			content = append(content, p)
+		}
+		if !bytes.Equal(content[0], content[1]) {
+			t.Errorf("%s: archives are not identical", ext)
+		}
+	}
+}
+
+func TestExtract_unsafe(t *testing.T) {
+	dir := testTree(t)
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "out.tar")
+	files := []string{filepath.Join(dir, "src/a.txt")}
+	err := Create(archive, files, &CreateOpt{
+		StripPrefix: filepath.Join(dir, "src"),
+		Prefix:      "..",
+	})
+	if err == nil {
+		t.Errorf("created an archive with an unsafe name")
+	}
+	// leading slashes are removed when the archive is created
+	err = Create(archive, files, &CreateOpt{
+		StripPrefix: filepath.Join(dir, "src"),
+		Prefix:      "/tmp",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Extract(archive, filepath.Join(dir, "dest"), nil)
+	if err != nil {
+		t.Error(err)
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4})
+	tw.Write([]byte("evil"))
+	tw.Close()
+	err = ioutil.WriteFile(archive, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Extract(archive, filepath.Join(dir, "dest"), nil)
+	if err == nil {
+		t.Errorf("extracted unsafe path")
+	}
+
+	err = os.Symlink("../..", filepath.Join(dir, "src/up"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive = filepath.Join(dir, "out.zip")
+	err = Create(archive, []string{filepath.Join(dir, "src")}, &CreateOpt{StripPrefix: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Extract(archive, filepath.Join(dir, "dest"), nil)
+	if err == nil {
+		t.Errorf("extracted unsafe symbolic link")
+	}
+	// each link is safe but together they point outside of dest.
+	buf.Reset()
+	tw = tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "x", Typeflag: tar.TypeSymlink, Linkname: ".", Mode: 0777},
+		{Name: "x/l", Typeflag: tar.TypeSymlink, Linkname: "..", Mode: 0777},
+		{Name: "l/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+	} {
+		err = tw.WriteHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			tw.Write([]byte("evil"))
+		}
+	}
+	err = tw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive = filepath.Join(dir, "links.tar")
+	err = ioutil.WriteFile(archive, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Extract(archive, filepath.Join(dir, "links"), nil)
+	if err == nil {
+		t.Errorf("extracted through symbolic links")
+	}
+	_, err = os.Lstat(filepath.Join(dir, "evil"))
+	if !os.IsNotExist(err) {
+		t.Errorf("file written outside of dest: %v", err)
+	}
+}
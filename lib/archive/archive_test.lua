@@ -0,0 +1,48 @@
+local archive = require('archive')
+
+local function contains(list, x)
+    for _, y in ipairs(list) do
+        if x == y then return true end
+    end
+    return false
+end
+
+function test_create_list()
+    for _, ext in ipairs{'.zip', '.tar', '.tar.gz'} do
+        local path = os.tmpname() .. ext
+        archive.create(path, {'*.go', 'archive_test.lua'}, {prefix = 'src', reproducible = true})
+        local names = archive.list(path)
+        assert(contains(names, 'src/archive.go'))
+        assert(contains(names, 'src/archive_test.lua'))
+        os.remove(path)
+    end
+end
+
+function test_mode()
+    local path = os.tmpname() .. '.zip'
+    archive.create(path, 'archive.go', {mode = 420})
+    archive.create(path, 'archive.go', {mode = '0644', dir_mode = '755'})
+    os.remove(path)
+end
+
+function test_format()
+    local path = os.tmpname()
+    assert(not pcall(archive.create, path, 'archive.go'))
+    archive.create(path, 'archive.go', {format = 'zip'})
+    assert(not pcall(archive.list, path))
+    assert(archive.list(path, {format = 'zip'})[1] == 'archive.go')
+    os.remove(path)
+end
+
+function test_errors()
+    local path = os.tmpname() .. '.zip'
+    assert(not pcall(archive.create, path, 'missing.go'))
+    assert(not pcall(archive.create, path, 'archive.go', {strip_prefix = 'other'}))
+    assert(not pcall(archive.create, path, 'archive.go', {mode = '9'}))
+    assert(not pcall(archive.create, path, 'archive.go', {mode = '4755'}))
+    assert(not pcall(archive.create, path, 'archive.go', {mode = 755}))
+    assert(not pcall(archive.create, path, 'archive.go', {mode = 420.5}))
+    assert(not pcall(archive.create, path, '../archive/archive.go'))
+    assert(not pcall(archive.create, path, 'archive.go', {prefix = '../x'}))
+    assert(not pcall(archive.extract, path, os.tmpname()))
+end
@@ -0,0 +1,294 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bmatsuo/lark/lib/path"
+)
+
+// Archive formats.
+const (
+	FormatZip   = "zip"
+	FormatTarGz = "tar.gz"
+	FormatTar   = "tar"
+)
+
+// ReproducibleTime is the default modification time of entries in
+// reproducible archives.  It is the earliest time that can be represented in
+// a zip archive.
+var ReproducibleTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// DetectFormat returns the format of the archive at path based on its
+// extension.
+func DetectFormat(path string) (string, error) {
+	switch {
+	case strings.HasSuffix(path, ".zip"):
+		return FormatZip, nil
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return FormatTarGz, nil
+	case strings.HasSuffix(path, ".tar"):
+		return FormatTar, nil
+	}
+	return "", fmt.Errorf("unknown archive format: %s", path)
+}
+
+// CreateOpt contains options for Create.
+type CreateOpt struct {
+	// Format is the archive format.  If Format is empty it is determined by
+	// the extension of the archive.
+	Format string
+	// StripPrefix is removed from the path of each file to get the name of
+	// its archive entry.  Every file must be contained in StripPrefix.
+	StripPrefix string
+	// Prefix is joined with the name of each entry.
+	Prefix string
+	// Mode, if not zero, is the permission bits of every file.
+	Mode os.FileMode
+	// DirMode, if not zero, is the permission bits of every directory.
+	DirMode os.FileMode
+	// Reproducible causes entries to be sorted by name, and their owners
+	// and modification times to be fixed, so that archives of identical
+	// files are identical.
+	Reproducible bool
+	// ModTime is the modification time of entries in a reproducible
+	// archive.  If ModTime is zero ReproducibleTime is used.
+	ModTime time.Time
+}
+
+type entry struct {
+	path string
+	name string
+	info os.FileInfo
+	link string
+}
+
+// Create writes an archive containing files to dest.  Files may be paths or
+// patterns for path.Glob.  Directories are added recursively.
+func Create(dest string, files []string, opt *CreateOpt) error {
+	if opt == nil {
+		opt = &CreateOpt{}
+	}
+	format := opt.Format
+	if format == "" {
+		var err error
+		format, err = DetectFormat(dest)
+		if err != nil {
+			return err
+		}
+	}
+	entries, err := collect(files, opt)
+	if err != nil {
+		return err
+	}
+	if opt.Reproducible {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatZip:
+		err = writeZip(f, entries, opt)
+	case FormatTarGz:
+		gz := gzip.NewWriter(f)
+		err = writeTar(gz, entries, opt)
+		if err == nil {
+			err = gz.Close()
+		}
+	case FormatTar:
+		err = writeTar(f, entries, opt)
+	default:
+		err = fmt.Errorf("unknown archive format: %s", format)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(dest)
+		return err
+	}
+	return f.Close()
+}
+
+// collect returns the entries for files.
+func collect(files []string, opt *CreateOpt) ([]*entry, error) {
+	var paths []string
+	for _, file := range files {
+		if !strings.ContainsAny(file, `*?[`) {
+			paths = append(paths, file)
+			continue
+		}
+		matches, err := path.Glob(file, &path.GlobOpt{Sort: true})
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+
+	var entries []*entry
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		err := filepath.Walk(p, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name, err := entryName(p, opt)
+			if err != nil {
+				return err
+			}
+			if name == "" || seen[name] {
+				return nil
+			}
+			seen[name] = true
+			e := &entry{path: p, name: name, info: info}
+			if info.Mode()&os.ModeSymlink != 0 {
+				e.link, err = os.Readlink(p)
+				if err != nil {
+					return err
+				}
+			}
+			entries = append(entries, e)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// entryName returns the archive name of the file at p, or an empty string if
+// p is the prefix being stripped.  An error is returned if the name would
+// begin with "..", which extraction would place outside its directory.
+func entryName(p string, opt *CreateOpt) (string, error) {
+	name := filepath.ToSlash(filepath.Clean(p))
+	if opt.StripPrefix != "" {
+		strip := filepath.ToSlash(filepath.Clean(opt.StripPrefix))
+		switch {
+		case name == strip:
+			name = ""
+		case strip == ".":
+		case strings.HasPrefix(name, strip+"/"):
+			name = name[len(strip)+1:]
+		default:
+			return "", fmt.Errorf("%s is not contained in %s", p, opt.StripPrefix)
+		}
+	}
+	if opt.Prefix != "" {
+		name = pathpkg.Join(filepath.ToSlash(opt.Prefix), name)
+	}
+	name = strings.TrimLeft(name, "/")
+	if name == "." {
+		name = ""
+	}
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("%s: archive name %s is outside the archive root", p, name)
+	}
+	return name, nil
+}
+
+// mode returns the permission bits of e in the archive.
+func (e *entry) mode(opt *CreateOpt) os.FileMode {
+	switch {
+	case e.info.IsDir() && opt.DirMode != 0:
+		return opt.DirMode
+	case e.info.Mode().IsRegular() && opt.Mode != 0:
+		return opt.Mode
+	}
+	return e.info.Mode().Perm()
+}
+
+func modTime(e *entry, opt *CreateOpt) time.Time {
+	if !opt.Reproducible {
+		return e.info.ModTime()
+	}
+	if opt.ModTime.IsZero() {
+		return ReproducibleTime
+	}
+	return opt.ModTime
+}
+
+func writeTar(w io.Writer, entries []*entry, opt *CreateOpt) error {
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr, err := tar.FileInfoHeader(e.info, e.link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = e.name
+		if e.info.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Mode = int64(e.mode(opt))
+		hdr.ModTime = modTime(e, opt)
+		if opt.Reproducible {
+			hdr.Uid, hdr.Gid = 0, 0
+			hdr.Uname, hdr.Gname = "", ""
+			hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+			hdr.Format = tar.FormatPAX
+		}
+		err = tw.WriteHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if e.info.Mode().IsRegular() {
+			err = copyFile(tw, e.path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, entries []*entry, opt *CreateOpt) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		hdr, err := zip.FileInfoHeader(e.info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = e.name
+		if e.info.IsDir() {
+			hdr.Name += "/"
+		} else {
+			hdr.Method = zip.Deflate
+		}
+		hdr.SetMode(e.info.Mode()&^os.ModePerm | e.mode(opt))
+		hdr.Modified = modTime(e, opt)
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		switch {
+		case e.link != "":
+			_, err = io.WriteString(fw, e.link)
+		case e.info.Mode().IsRegular():
+			err = copyFile(fw, e.path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,308 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExtractOpt contains options for Extract.
+type ExtractOpt struct {
+	// Format is the archive format.  If Format is empty it is determined by
+	// the extension of the archive.
+	Format string
+	// StripComponents is the number of leading path elements removed from
+	// entry names.  Entries with fewer elements are skipped.
+	StripComponents int
+}
+
+// Extract writes the contents of the archive src into the directory dest.
+// An error is returned if an entry would be written outside of dest, through
+// a symbolic link extracted from the archive, or is a symbolic link pointing
+// outside of dest.
+func Extract(src, dest string, opt *ExtractOpt) error {
+	if opt == nil {
+		opt = &ExtractOpt{}
+	}
+	err := os.MkdirAll(dest, 0755)
+	if err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+	x := &extractor{
+		dest:  dest,
+		root:  root,
+		strip: opt.StripComponents,
+		links: make(map[string]bool),
+	}
+	return walk(src, opt.Format, x.extract)
+}
+
+// List returns the names of the entries in the archive src.  The names of
+// directories end with a slash.
+func List(src, format string) ([]string, error) {
+	var names []string
+	err := walk(src, format, func(name string, info os.FileInfo, r io.Reader) error {
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+type walkFunc func(name string, info os.FileInfo, r io.Reader) error
+
+// walk calls fn for each entry of the archive src.  The reader passed to fn
+// contains the entry's content, or the target of a symbolic link.
+func walk(src, format string, fn walkFunc) error {
+	if format == "" {
+		var err error
+		format, err = DetectFormat(src)
+		if err != nil {
+			return err
+		}
+	}
+	if format == FormatZip {
+		return walkZip(src, fn)
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	switch format {
+	case FormatTarGz:
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%s: %v", src, err)
+		}
+		defer gz.Close()
+		r = gz
+	case FormatTar:
+	default:
+		return fmt.Errorf("unknown archive format: %s", format)
+	}
+	err = walkTar(r, fn)
+	if err != nil {
+		return fmt.Errorf("%s: %v", src, err)
+	}
+	return nil
+}
+
+func walkTar(r io.Reader, fn walkFunc) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var content io.Reader = tr
+		if hdr.Typeflag == tar.TypeSymlink {
+			content = strings.NewReader(hdr.Linkname)
+		}
+		err = fn(hdr.Name, hdr.FileInfo(), content)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(src string, fn walkFunc) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %v", src, err)
+		}
+		err = fn(f.Name, f.FileInfo(), r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type extractor struct {
+	dest string
+	// root is the real path of dest.
+	root  string
+	strip int
+	// links contains the paths, relative to dest, of the symbolic links that
+	// have been extracted.
+	links map[string]bool
+}
+
+func (x *extractor) extract(name string, info os.FileInfo, r io.Reader) error {
+	rel, ok := x.entryPath(name)
+	if !ok {
+		return nil
+	}
+	if rel == "" {
+		return fmt.Errorf("unsafe path in archive: %s", name)
+	}
+	mode := info.Mode()
+	if !mode.IsDir() && !mode.IsRegular() && mode&os.ModeSymlink == 0 {
+		return nil
+	}
+	for dir := pathpkg.Dir(rel); dir != "."; dir = pathpkg.Dir(dir) {
+		if x.links[dir] {
+			return fmt.Errorf("unsafe path in archive: %s (through symbolic link %s)", name, dir)
+		}
+	}
+	target := filepath.Join(x.dest, filepath.FromSlash(rel))
+	parent, err := x.mkdirParent(target)
+	if err != nil {
+		return fmt.Errorf("unsafe path in archive: %s (%v)", name, err)
+	}
+	switch {
+	case mode.IsDir():
+		return os.MkdirAll(target, dirMode(mode))
+	case mode&os.ModeSymlink != 0:
+		p, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		link := string(p)
+		if filepath.IsAbs(link) || !x.contains(filepath.Join(parent, filepath.FromSlash(link))) {
+			return fmt.Errorf("unsafe symbolic link in archive: %s -> %s", name, link)
+		}
+		os.Remove(target)
+		err = os.Symlink(link, target)
+		if err != nil {
+			return err
+		}
+		x.links[rel] = true
+		return nil
+	default:
+		return writeFile(target, r, fileMode(mode), info.ModTime())
+	}
+}
+
+// entryPath returns the cleaned path of an entry relative to the destination
+// directory.  False is returned if the entry is skipped.  An empty path is
+// returned if the entry is outside of the destination.
+func (x *extractor) entryPath(name string) (string, bool) {
+	name = strings.TrimSuffix(filepath.ToSlash(name), "/")
+	if x.strip > 0 {
+		segs := strings.Split(strings.TrimLeft(name, "/"), "/")
+		if len(segs) <= x.strip {
+			return "", false
+		}
+		name = strings.Join(segs[x.strip:], "/")
+	}
+	if pathpkg.IsAbs(name) {
+		return "", true
+	}
+	name = pathpkg.Clean(name)
+	if name == "." {
+		return "", false
+	}
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", true
+	}
+	return name, true
+}
+
+// mkdirParent creates the parent directory of target and returns its real
+// path.  An error is returned if the parent directory, or its deepest
+// existing ancestor, resolves outside of the destination.
+func (x *extractor) mkdirParent(target string) (string, error) {
+	dir := filepath.Dir(target)
+	for p := dir; ; p = filepath.Dir(p) {
+		resolved, err := filepath.EvalSymlinks(p)
+		if os.IsNotExist(err) && filepath.Dir(p) != p {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if !x.contains(resolved) {
+			return "", fmt.Errorf("%s resolves outside of the destination", p)
+		}
+		break
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	if !x.contains(resolved) {
+		return "", fmt.Errorf("%s resolves outside of the destination", dir)
+	}
+	return resolved, nil
+}
+
+// contains returns true if path is within the real destination directory.
+func (x *extractor) contains(path string) bool {
+	rel, err := filepath.Rel(x.root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func dirMode(mode os.FileMode) os.FileMode {
+	if mode.Perm() == 0 {
+		return 0755
+	}
+	return mode.Perm()
+}
+
+func fileMode(mode os.FileMode) os.FileMode {
+	if mode.Perm() == 0 {
+		return 0644
+	}
+	return mode.Perm()
+}
+
+func writeFile(target string, r io.Reader, mode os.FileMode, mtime time.Time) error {
+	// an existing symbolic link is replaced instead of followed.
+	os.Remove(target)
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(target, mode)
+	if err != nil {
+		return err
+	}
+	if mtime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(target, mtime, mtime)
+}
@@ -0,0 +1,495 @@
+package fs
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bmatsuo/lark/gluamodule"
+	"github.com/bmatsuo/lark/lib/doc"
+	"github.com/yuin/gopher-lua"
+)
+
+// Module is a gluamodule.Module that loads the fs module.
+var Module = gluamodule.New("fs", Loader,
+	doc.Module,
+)
+
+// Loader preloads the fs module so that it can be required in lua scripts.
+func Loader(l *lua.LState) int {
+	l.Pop(1) // first argument is the module name
+
+	mod := l.NewTable()
+	doc.Go(l, mod, &doc.Docs{
+		Desc: `
+		The fs module provides filesystem operations that do not depend on
+		external programs.  Errors are raised for any operation that fails.
+
+		Functions which take a file mode accept a string of octal digits (e.g.
+		"0755") or a decimal number (e.g. 493).  A number that is not valid
+		permission bits, like 755, is an error.
+		`,
+	})
+
+	set := func(name string, fn lua.LGFunction, docs *doc.Docs) {
+		lfn := l.NewClosure(fn)
+		doc.Go(l, lfn, docs)
+		l.SetField(mod, name, lfn)
+	}
+
+	set("mkdir_all", LuaMkdirAll, &doc.Docs{
+		Sig:  "(path, mode) => ()",
+		Desc: "Creates a directory and any missing parent directories.",
+		Params: []string{
+			"path  The directory to create",
+			"mode  Optional permission bits of created directories (default 0755)",
+		},
+	})
+	set("copy", LuaCopy, &doc.Docs{
+		Sig: "(src, dst) => ()",
+		Desc: `
+		Copies the file or directory src to dst, preserving file modes.
+		Directories are copied recursively and symbolic links are copied as
+		links, replacing existing files.  If src is a directory and dst exists
+		the contents of src are merged into dst.  If src is a file and dst is
+		an existing directory src is copied into dst, like cp.  It is an
+		error to copy a directory into itself.
+		`,
+		Params: []string{
+			"src  The file or directory to copy",
+			"dst  The path of the copy",
+		},
+	})
+	set("move", LuaMove, &doc.Docs{
+		Sig: "(src, dst) => ()",
+		Desc: `
+		Renames src to dst.  If src and dst are on different devices src is
+		copied and then removed.
+		`,
+		Params: []string{
+			"src  The file or directory to move",
+			"dst  The new path",
+		},
+	})
+	set("remove_all", LuaRemoveAll, &doc.Docs{
+		Sig:  "path => ()",
+		Desc: "Removes path and any children it contains.  No error is raised if path does not exist.",
+		Params: []string{
+			"path  The file or directory to remove",
+		},
+	})
+	set("read_file", LuaReadFile, &doc.Docs{
+		Sig:  "path => string",
+		Desc: "Returns the contents of a file.",
+		Params: []string{
+			"path  The file to read",
+		},
+	})
+	set("write_file", LuaWriteFile, &doc.Docs{
+		Sig:  "(path, content, mode) => ()",
+		Desc: "Writes content to a file, replacing the file if it exists.",
+		Params: []string{
+			"path     The file to write",
+			"content  The new contents of the file",
+			"mode     Optional permission bits of a created file (default 0644)",
+		},
+	})
+	set("touch", LuaTouch, &doc.Docs{
+		Sig:  "path => ()",
+		Desc: "Creates an empty file, or sets the access and modification times of an existing file to the current time.",
+		Params: []string{
+			"path  The file to touch",
+		},
+	})
+	set("stat", LuaStat, &doc.Docs{
+		Sig: "path => info",
+		Desc: `
+		Returns information about a file, or nil if it does not exist.
+		Symbolic links are followed.
+		`,
+		Params: []string{
+			"path  The file to describe",
+		},
+		Vars: []string{
+			"info.name    The base name of the file",
+			"info.size    The size of the file in bytes",
+			"info.mode    The permission bits of the file",
+			"info.mtime   The modification time in seconds since the Unix epoch",
+			"info.is_dir  True if the file is a directory",
+		},
+	})
+	set("symlink", LuaSymlink, &doc.Docs{
+		Sig:  "(target, link) => ()",
+		Desc: "Creates a symbolic link named link which points to target.",
+		Params: []string{
+			"target  The path the link points to",
+			"link    The path of the link",
+		},
+	})
+	set("temp_dir", LuaTempDir, &doc.Docs{
+		Sig: "prefix => string",
+		Desc: `
+		Creates a new temporary directory and returns its path.  The
+		directory and its contents are removed when lark finishes running
+		tasks.
+		`,
+		Params: []string{
+			"prefix  Optional prefix of the directory name (default \"lark\")",
+		},
+	})
+
+	l.Push(mod)
+	return 1
+}
+
+// Exports defines the exported functions in the fs module.
+var Exports = map[string]lua.LGFunction{
+	"mkdir_all":  LuaMkdirAll,
+	"copy":       LuaCopy,
+	"move":       LuaMove,
+	"remove_all": LuaRemoveAll,
+	"read_file":  LuaReadFile,
+	"write_file": LuaWriteFile,
+	"touch":      LuaTouch,
+	"stat":       LuaStat,
+	"symlink":    LuaSymlink,
+	"temp_dir":   LuaTempDir,
+}
+
+// optMode returns the file mode at position n of the stack, or def if the
+// argument is nil.  Numbers are decimal, so a number that is not valid
+// permission bits (e.g. 755 meant as octal) is an error, as is a string of
+// more than permission bits.
+func optMode(state *lua.LState, n int, def os.FileMode) os.FileMode {
+	switch v := state.Get(n).(type) {
+	case lua.LNumber:
+		if v < 0 || v > lua.LNumber(os.ModePerm) || v != lua.LNumber(int(v)) {
+			state.ArgError(n, fmt.Sprintf("mode is not permission bits: %v (use an octal string like \"0755\")", v))
+		}
+		return os.FileMode(v)
+	case lua.LString:
+		m, err := strconv.ParseUint(string(v), 8, 32)
+		if err != nil || m > uint64(os.ModePerm) {
+			state.ArgError(n, "invalid octal mode: "+string(v))
+		}
+		return os.FileMode(m)
+	default:
+		if v != lua.LNil {
+			state.ArgError(n, "mode is not a number or string: "+v.Type().String())
+		}
+		return def
+	}
+}
+
+// LuaMkdirAll creates a directory and its parents.
+func LuaMkdirAll(state *lua.LState) int {
+	path := state.CheckString(1)
+	mode := optMode(state, 2, 0755)
+	err := os.MkdirAll(path, mode)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+	}
+	return 0
+}
+
+// LuaCopy copies a file or directory tree.
+func LuaCopy(state *lua.LState) int {
+	src := state.CheckString(1)
+	dst := state.CheckString(2)
+	err := Copy(src, dst)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+	}
+	return 0
+}
+
+// LuaMove renames a file or directory.
+func LuaMove(state *lua.LState) int {
+	src := state.CheckString(1)
+	dst := state.CheckString(2)
+	err := Move(src, dst)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+	}
+	return 0
+}
+
+// LuaRemoveAll removes a file or directory tree.
+func LuaRemoveAll(state *lua.LState) int {
+	path := state.CheckString(1)
+	err := os.RemoveAll(path)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+	}
+	return 0
+}
+
+// LuaReadFile returns the contents of a file.
+func LuaReadFile(state *lua.LState) int {
+	path := state.CheckString(1)
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	state.Push(lua.LString(p))
+	return 1
+}
+
+// LuaWriteFile writes the contents of a file.
+func LuaWriteFile(state *lua.LState) int {
+	path := state.CheckString(1)
+	content := state.CheckString(2)
+	mode := optMode(state, 3, 0644)
+	err := ioutil.WriteFile(path, []byte(content), mode)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+	}
+	return 0
+}
+
+// LuaTouch creates a file or updates its modification time.
+func LuaTouch(state *lua.LState) int {
+	path := state.CheckString(1)
+	now := time.Now()
+	err := os.Chtimes(path, now, now)
+	if os.IsNotExist(err) {
+		var f *os.File
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+		if err == nil {
+			err = f.Close()
+		}
+	}
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+	}
+	return 0
+}
+
+// LuaStat returns a table describing a file.
+func LuaStat(state *lua.LState) int {
+	path := state.CheckString(1)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		state.Push(lua.LNil)
+		return 1
+	}
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	t := state.NewTable()
+	t.RawSetString("name", lua.LString(info.Name()))
+	t.RawSetString("size", lua.LNumber(info.Size()))
+	t.RawSetString("mode", lua.LNumber(info.Mode().Perm()))
+	mtime := float64(info.ModTime().UnixNano()) / float64(time.Second)
+	t.RawSetString("mtime", lua.LNumber(mtime))
+	t.RawSetString("is_dir", lua.LBool(info.IsDir()))
+	state.Push(t)
+	return 1
+}
+
+// LuaSymlink creates a symbolic link.
+func LuaSymlink(state *lua.LState) int {
+	target := state.CheckString(1)
+	link := state.CheckString(2)
+	err := os.Symlink(target, link)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+	}
+	return 0
+}
+
+// LuaTempDir creates a temporary directory that is removed by Cleanup.
+func LuaTempDir(state *lua.LState) int {
+	prefix := state.OptString(1, "lark")
+	dir, err := ioutil.TempDir("", prefix)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	reg := state.Get(lua.RegistryIndex).(*lua.LTable)
+	tempDirs.Lock()
+	tempDirs.m[reg] = append(tempDirs.m[reg], dir)
+	tempDirs.Unlock()
+	state.Push(lua.LString(dir))
+	return 1
+}
+
+// tempDirs holds the temporary directories created by lua states, keyed by
+// the registry of the state.  It is not stored in the registry so that
+// CleanupAll can be called while the states are running.
+var tempDirs = struct {
+	sync.Mutex
+	m map[*lua.LTable][]string
+}{m: make(map[*lua.LTable][]string)}
+
+// Cleanup removes the temporary directories created by l.  The first error
+// encountered is returned after attempting to remove every directory.
+func Cleanup(l *lua.LState) error {
+	reg := l.Get(lua.RegistryIndex).(*lua.LTable)
+	tempDirs.Lock()
+	dirs := tempDirs.m[reg]
+	delete(tempDirs.m, reg)
+	tempDirs.Unlock()
+	return removeAll(dirs)
+}
+
+// CleanupAll removes the temporary directories created by every lua state.
+// Unlike Cleanup it is safe to call while the states are running, e.g. just
+// before the process exits.
+func CleanupAll() error {
+	tempDirs.Lock()
+	var dirs []string
+	for reg, regDirs := range tempDirs.m {
+		dirs = append(dirs, regDirs...)
+		delete(tempDirs.m, reg)
+	}
+	tempDirs.Unlock()
+	return removeAll(dirs)
+}
+
+// removeAll removes each of dirs and returns the first error encountered.
+func removeAll(dirs []string) error {
+	var err error
+	for _, dir := range dirs {
+		errRemove := os.RemoveAll(dir)
+		if err == nil {
+			err = errRemove
+		}
+	}
+	return err
+}
+
+// Copy copies the file or directory src to dst.  Directories are copied
+// recursively and symbolic links are copied as links, replacing existing
+// files.  File modes are preserved.  Like cp, a file copied to an existing
+// directory is copied into the directory.  An error is returned if dst is
+// inside the directory src.
+func Copy(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		inside, err := isInside(dst, src)
+		if err != nil {
+			return err
+		}
+		if inside {
+			return fmt.Errorf("cannot copy directory %s into itself: %s", src, dst)
+		}
+	} else if dinfo, err := os.Stat(dst); err == nil && dinfo.IsDir() {
+		dst = filepath.Join(dst, filepath.Base(src))
+	}
+
+	var dirs []string
+	var modes []os.FileMode
+	err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			// directories are writable until their contents have been copied.
+			err = os.MkdirAll(target, 0700)
+			if err != nil {
+				return err
+			}
+			dirs = append(dirs, target)
+			modes = append(modes, info.Mode().Perm())
+			return nil
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Lstat(target); err == nil {
+				err = os.Remove(target)
+				if err != nil {
+					return err
+				}
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err = os.Chmod(dirs[i], modes[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isInside returns true if path is dir or is inside dir, comparing the
+// cleaned absolute paths.
+func isInside(path, dir string) (bool, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false, nil
+	}
+	up := ".." + string(filepath.Separator)
+	return rel != ".." && !strings.HasPrefix(rel, up), nil
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	fsrc, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fsrc.Close()
+	fdst, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fdst, fsrc)
+	if err != nil {
+		fdst.Close()
+		return err
+	}
+	err = fdst.Close()
+	if err != nil {
+		return err
+	}
+	return os.Chmod(dst, mode)
+}
+
+// Move renames src to dst.  If src and dst are on different devices src is
+// copied to dst and removed.
+func Move(src, dst string) error {
+	err := os.Rename(src, dst)
+	if lerr, ok := err.(*os.LinkError); ok && lerr.Err == syscall.EXDEV {
+		err = Copy(src, dst)
+		if err != nil {
+			return err
+		}
+		return os.RemoveAll(src)
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package fs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/bmatsuo/lark/gluamodule"
+	"github.com/bmatsuo/lark/gluatest"
+	"github.com/yuin/gopher-lua"
+)
+
+var luaFSTest = &gluatest.File{
+	Module: Module,
+	Path:   "fs_test.lua",
+}
+
+func TestModule(t *testing.T) {
+	luaFSTest.Test(t)
+}
+
+func BenchmarkRequireModule(b *testing.B) {
+	file := &gluatest.File{Module: Module}
+	file.BenchmarkRequireModule(b)
+}
+
+func TestCleanup(t *testing.T) {
+	l := lua.NewState()
+	defer l.Close()
+	gluamodule.Preload(l, gluamodule.Resolve(Module)...)
+
+	err := l.DoString(`
+		local fs = require('fs')
+		dir1 = fs.temp_dir()
+		dir2 = fs.temp_dir('lark-fs-test')
+		fs.write_file(dir2 .. '/x', 'x')
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dirs []string
+	for _, name := range []string{"dir1", "dir2"} {
+		dir := lua.LVAsString(l.GetGlobal(name))
+		_, err := os.Stat(dir)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		dirs = append(dirs, dir)
+	}
+
+	err = Cleanup(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		_, err := os.Stat(dir)
+		if !os.IsNotExist(err) {
+			t.Errorf("%s: not removed (%v)", dir, err)
+		}
+	}
+}
+
+func TestCleanupAll(t *testing.T) {
+	var dirs []string
+	for i := 0; i < 2; i++ {
+		l := lua.NewState()
+		defer l.Close()
+		gluamodule.Preload(l, gluamodule.Resolve(Module)...)
+		err := l.DoString(`dir = require('fs').temp_dir()`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dirs = append(dirs, lua.LVAsString(l.GetGlobal("dir")))
+	}
+
+	err := CleanupAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		_, err := os.Stat(dir)
+		if !os.IsNotExist(err) {
+			t.Errorf("%s: not removed (%v)", dir, err)
+		}
+	}
+}
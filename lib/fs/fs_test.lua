@@ -0,0 +1,95 @@
+local fs = require('fs')
+
+function __test_setup()
+    dir = fs.temp_dir('lark-fs-test')
+end
+
+function __test_teardown()
+    fs.remove_all(dir)
+end
+
+function test_write_read()
+    local p = dir .. '/file.txt'
+    fs.write_file(p, 'hello')
+    assert(fs.read_file(p) == 'hello')
+    fs.write_file(p, 'bye')
+    assert(fs.read_file(p) == 'bye')
+    assert(not pcall(fs.read_file, dir .. '/missing'))
+end
+
+function test_mkdir_all()
+    local p = dir .. '/a/b/c'
+    fs.mkdir_all(p)
+    assert(fs.stat(p).is_dir)
+    fs.mkdir_all(p)
+    fs.mkdir_all(dir .. '/d', '0700')
+    assert(fs.stat(dir .. '/d').mode == 448)
+    assert(not pcall(fs.mkdir_all, dir .. '/e', '9'))
+    assert(not pcall(fs.mkdir_all, dir .. '/e', 755))
+end
+
+function test_stat()
+    assert(fs.stat(dir .. '/missing') == nil)
+    local p = dir .. '/x'
+    fs.write_file(p, '12345', 420)
+    local info = fs.stat(p)
+    assert(info.name == 'x')
+    assert(info.size == 5)
+    assert(info.mode == 420)
+    assert(not info.is_dir)
+    assert(info.mtime > 0)
+end
+
+function test_touch()
+    local p = dir .. '/touched'
+    fs.touch(p)
+    assert(fs.stat(p).size == 0)
+    fs.write_file(p, 'abc')
+    fs.touch(p)
+    assert(fs.read_file(p) == 'abc')
+end
+
+function test_copy()
+    fs.mkdir_all(dir .. '/src/sub')
+    fs.write_file(dir .. '/src/a', 'a')
+    fs.write_file(dir .. '/src/sub/b', 'b', '0755')
+    fs.symlink('a', dir .. '/src/link')
+    fs.copy(dir .. '/src', dir .. '/dst')
+    assert(fs.read_file(dir .. '/dst/a') == 'a')
+    assert(fs.read_file(dir .. '/dst/sub/b') == 'b')
+    assert(fs.stat(dir .. '/dst/sub/b').mode == 493)
+    assert(fs.read_file(dir .. '/dst/link') == 'a')
+
+    fs.copy(dir .. '/src/a', dir .. '/c')
+    assert(fs.read_file(dir .. '/c') == 'a')
+
+    -- copying again replaces files and links.
+    fs.write_file(dir .. '/src/a', 'aa')
+    fs.copy(dir .. '/src', dir .. '/dst')
+    assert(fs.read_file(dir .. '/dst/link') == 'aa')
+
+    -- a file copied to a directory is copied into it.
+    fs.copy(dir .. '/src/a', dir .. '/dst/sub')
+    assert(fs.read_file(dir .. '/dst/sub/a') == 'aa')
+
+    assert(not pcall(fs.copy, dir .. '/src', dir .. '/src/sub/copy'))
+    assert(not pcall(fs.copy, dir .. '/src', dir .. '/src'))
+    assert(not fs.stat(dir .. '/src/sub/copy'))
+    fs.copy(dir .. '/src', dir .. '/src2')
+    assert(fs.read_file(dir .. '/src2/a') == 'aa')
+end
+
+function test_move()
+    fs.write_file(dir .. '/a', 'a')
+    fs.move(dir .. '/a', dir .. '/b')
+    assert(not fs.stat(dir .. '/a'))
+    assert(fs.read_file(dir .. '/b') == 'a')
+end
+
+function test_remove_all()
+    fs.mkdir_all(dir .. '/x/y')
+    fs.touch(dir .. '/x/y/z')
+    fs.remove_all(dir .. '/x')
+    assert(not fs.stat(dir .. '/x'))
+    fs.remove_all(dir .. '/x')
+end
@@ -0,0 +1,228 @@
+package hash
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	gohash "hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bmatsuo/lark/gluamodule"
+	"github.com/bmatsuo/lark/lib/doc"
+	"github.com/bmatsuo/lark/lib/path"
+	"github.com/yuin/gopher-lua"
+)
+
+// Module is a gluamodule.Module that loads the hash module.
+var Module = gluamodule.New("hash", Loader,
+	doc.Module,
+)
+
+// Algorithms maps the names of supported hash algorithms to their
+// constructors.
+var Algorithms = map[string]func() gohash.Hash{
+	"sha256": sha256.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+}
+
+// Loader preloads the hash module so that it can be required in lua scripts.
+func Loader(l *lua.LState) int {
+	l.Pop(1) // first argument is the module name
+
+	mod := l.NewTable()
+	doc.Go(l, mod, &doc.Docs{
+		Desc: `
+		The hash module computes digests of strings and files.  Digests are
+		returned as lower case hexadecimal strings.
+		`,
+	})
+
+	set := func(name string, fn lua.LGFunction, docs *doc.Docs) {
+		lfn := l.NewClosure(fn)
+		doc.Go(l, lfn, docs)
+		l.SetField(mod, name, lfn)
+	}
+
+	for _, name := range []string{"sha256", "sha1", "md5"} {
+		set(name, luaString(name), &doc.Docs{
+			Sig:  "str => string",
+			Desc: fmt.Sprintf("Returns the %s digest of a string.", name),
+			Params: []string{
+				"str  The data to hash",
+			},
+		})
+		set(name+"_file", luaFile(name), &doc.Docs{
+			Sig:  "path => string",
+			Desc: fmt.Sprintf("Returns the %s digest of the contents of a file.", name),
+			Params: []string{
+				"path  The file to hash",
+			},
+		})
+	}
+	set("tree", LuaTree, &doc.Docs{
+		Sig: "(patt, opt) => string",
+		Desc: `
+		Returns a digest of the files matching glob patterns.  The digest
+		covers the name and contents of each file, and does not depend on the
+		order in which files are found.  Directories are ignored.
+		`,
+		Params: []string{
+			"patt  A glob pattern, or an array of patterns, as accepted by path.glob()",
+			"opt   Optional table of options",
+		},
+		Vars: []string{
+			"opt.algorithm  The hash algorithm: \"sha256\", \"sha1\", or \"md5\" (default \"sha256\")",
+			"opt.exclude    A pattern or array of patterns for files which are not hashed",
+			"opt.hidden     Allow wildcards to match names beginning with a dot",
+		},
+	})
+
+	l.Push(mod)
+	return 1
+}
+
+// Exports defines the exported functions in the hash module.
+var Exports = map[string]lua.LGFunction{
+	"sha256":      luaString("sha256"),
+	"sha256_file": luaFile("sha256"),
+	"sha1":        luaString("sha1"),
+	"sha1_file":   luaFile("sha1"),
+	"md5":         luaString("md5"),
+	"md5_file":    luaFile("md5"),
+	"tree":        LuaTree,
+}
+
+func luaString(algorithm string) lua.LGFunction {
+	return func(state *lua.LState) int {
+		str := state.CheckString(1)
+		h := Algorithms[algorithm]()
+		io.WriteString(h, str)
+		state.Push(lua.LString(hex.EncodeToString(h.Sum(nil))))
+		return 1
+	}
+}
+
+func luaFile(algorithm string) lua.LGFunction {
+	return func(state *lua.LState) int {
+		path := state.CheckString(1)
+		sum, err := File(algorithm, path)
+		if err != nil {
+			state.RaiseError("%s", err.Error())
+			return 0
+		}
+		state.Push(lua.LString(sum))
+		return 1
+	}
+}
+
+// LuaTree computes a digest of the files matching glob patterns.
+func LuaTree(state *lua.LState) int {
+	var patterns []string
+	switch v := state.CheckAny(1).(type) {
+	case lua.LString:
+		patterns = []string{string(v)}
+	case *lua.LTable:
+		for i := 1; i <= v.Len(); i++ {
+			s, ok := v.RawGetInt(i).(lua.LString)
+			if !ok {
+				state.ArgError(1, "array contains a non-string value")
+			}
+			patterns = append(patterns, string(s))
+		}
+	default:
+		state.ArgError(1, "pattern is not a string or table: "+v.Type().String())
+	}
+	algorithm := "sha256"
+	opt := &path.GlobOpt{}
+	if lopt := state.OptTable(2, nil); lopt != nil {
+		if s, ok := state.GetField(lopt, "algorithm").(lua.LString); ok {
+			algorithm = string(s)
+		}
+		switch v := state.GetField(lopt, "exclude").(type) {
+		case lua.LString:
+			opt.Exclude = []string{string(v)}
+		case *lua.LTable:
+			for i := 1; i <= v.Len(); i++ {
+				opt.Exclude = append(opt.Exclude, lua.LVAsString(v.RawGetInt(i)))
+			}
+		}
+		opt.Hidden = lua.LVAsBool(state.GetField(lopt, "hidden"))
+	}
+	if Algorithms[algorithm] == nil {
+		state.ArgError(2, "unknown algorithm: "+algorithm)
+	}
+	sum, err := Tree(algorithm, patterns, opt)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	state.Push(lua.LString(sum))
+	return 1
+}
+
+// File returns the hex encoded digest of the file at path.
+func File(algorithm, path string) (string, error) {
+	newHash := Algorithms[algorithm]
+	if newHash == nil {
+		return "", fmt.Errorf("unknown algorithm: %s", algorithm)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := newHash()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Tree returns the hex encoded digest of the files matching patterns.  The
+// digest is computed over a line for each file, in lexical order of their
+// slash separated paths, containing the digest of the file and its path.
+func Tree(algorithm string, patterns []string, opt *path.GlobOpt) (string, error) {
+	newHash := Algorithms[algorithm]
+	if newHash == nil {
+		return "", fmt.Errorf("unknown algorithm: %s", algorithm)
+	}
+	globOpt := path.GlobOpt{}
+	if opt != nil {
+		globOpt = *opt
+	}
+	globOpt.FilesOnly = true
+
+	seen := make(map[string]bool)
+	var files []string
+	for _, patt := range patterns {
+		matches, err := path.Glob(patt, &globOpt)
+		if err != nil {
+			return "", err
+		}
+		for _, file := range matches {
+			file = filepath.ToSlash(file)
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	sort.Strings(files)
+
+	h := newHash()
+	for _, file := range files {
+		sum, err := File(algorithm, filepath.FromSlash(file))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s  %s\n", sum, file)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,21 @@
+package hash
+
+import (
+	"testing"
+
+	"github.com/bmatsuo/lark/gluatest"
+)
+
+var luaHashTest = &gluatest.File{
+	Module: Module,
+	Path:   "hash_test.lua",
+}
+
+func TestModule(t *testing.T) {
+	luaHashTest.Test(t)
+}
+
+func BenchmarkRequireModule(b *testing.B) {
+	file := &gluatest.File{Module: Module}
+	file.BenchmarkRequireModule(b)
+}
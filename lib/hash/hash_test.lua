@@ -0,0 +1,32 @@
+local hash = require('hash')
+
+function test_string()
+    assert(hash.sha256('abc') == 'ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad')
+    assert(hash.sha1('abc') == 'a9993e364706816aba3e25717850c26c9cd0d89d')
+    assert(hash.md5('abc') == '900150983cd24fb0d6963f7d28e17f72')
+    assert(hash.md5('') == 'd41d8cd98f00b204e9800998ecf8427e')
+end
+
+function test_file()
+    local path = os.tmpname()
+    local f = io.open(path, 'w')
+    f:write('abc')
+    f:close()
+    assert(hash.sha256_file(path) == hash.sha256('abc'))
+    assert(hash.sha1_file(path) == hash.sha1('abc'))
+    assert(hash.md5_file(path) == hash.md5('abc'))
+    os.remove(path)
+    assert(not pcall(hash.sha256_file, path))
+end
+
+function test_tree()
+    local sum = hash.tree('*.go')
+    assert(#sum == 64)
+    assert(hash.tree('*.go') == sum)
+    assert(hash.tree({'hash_test.go', 'hash.go'}) == hash.tree({'hash.go', 'hash_test.go', '*.go'}))
+    assert(hash.tree('*.go', {exclude = 'hash_test.go'}) == hash.tree('hash.go'))
+    assert(hash.tree('*.go', {exclude = 'hash_test.go'}) ~= sum)
+    assert(#hash.tree('*.go', {algorithm = 'md5'}) == 32)
+    assert(hash.tree('*.missing') == hash.sha256(''))
+    assert(not pcall(hash.tree, '*.go', {algorithm = 'crc'}))
+end
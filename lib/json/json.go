@@ -0,0 +1,478 @@
+package json
+
+import (
+	"bytes"
+	encjson "encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bmatsuo/lark/gluamodule"
+	"github.com/bmatsuo/lark/lib/doc"
+	"github.com/yuin/gopher-lua"
+)
+
+// Module is a gluamodule.Module that loads the json module.
+var Module = gluamodule.New("json", Loader,
+	doc.Module,
+)
+
+// Kinds of tables recorded in their metatable.
+const (
+	kindArray  = "array"
+	kindObject = "object"
+)
+
+// maxExactInt is the largest magnitude of integers which are represented
+// exactly by a lua number.
+const maxExactInt = 1 << 53
+
+// Loader preloads the json module so that it can be required in lua scripts.
+func Loader(l *lua.LState) int {
+	l.Pop(1) // first argument is the module name
+
+	mod := l.NewTable()
+	doc.Go(l, mod, &doc.Docs{
+		Desc: `
+		The json module encodes and decodes JSON documents.
+
+		Decoded arrays and objects are tables which remember their kind, so
+		an empty array is encoded as [] after it is decoded.  Other tables are
+		encoded as arrays if their keys are the integers 1 through n, and as
+		objects otherwise.  An empty table is encoded as an object unless it
+		is marked with json.array().
+
+		JSON null is decoded as json.null.  Integers too large to be
+		represented exactly by a Lua number are decoded as values created by
+		json.number(), which preserve all digits when encoded.
+		`,
+		Vars: []string{
+			"null  The value of JSON null",
+		},
+	})
+
+	m := &module{
+		array:  l.NewTable(),
+		object: l.NewTable(),
+		number: l.NewTable(),
+		null:   l.NewUserData(),
+	}
+	l.SetField(m.array, "__json", lua.LString(kindArray))
+	l.SetField(m.object, "__json", lua.LString(kindObject))
+	l.SetField(m.number, "__tostring", l.NewFunction(luaNumberString))
+	l.SetField(m.number, "__json", lua.LString("number"))
+	nullmt := l.NewTable()
+	l.SetField(nullmt, "__tostring", l.NewFunction(func(l *lua.LState) int {
+		l.Push(lua.LString("null"))
+		return 1
+	}))
+	m.null.Metatable = nullmt
+
+	set := func(name string, fn lua.LGFunction, docs *doc.Docs) {
+		lfn := l.NewClosure(fn)
+		doc.Go(l, lfn, docs)
+		l.SetField(mod, name, lfn)
+	}
+
+	set("decode", m.luaDecode, &doc.Docs{
+		Sig:  "str => value",
+		Desc: "Decodes a JSON document.  An error is raised if str is not a single valid JSON value.",
+		Params: []string{
+			"str  A JSON document",
+		},
+	})
+	set("encode", m.luaEncode, &doc.Docs{
+		Sig:  "(value, opt) => string",
+		Desc: "Encodes value as a JSON document.  Object keys are sorted so that the encoding of a table does not change.  An error is raised for values that cannot be represented (e.g. functions, tables containing themselves, and strings that are not valid UTF-8).",
+		Params: []string{
+			"value  A string, number, boolean, table, json.null, or json.number()",
+			"opt    Optional table of options",
+		},
+		Vars: []string{
+			"opt.indent  The number of spaces (or a string) used to indent nested values",
+		},
+	})
+	set("read_file", m.luaReadFile, &doc.Docs{
+		Sig:  "path => value",
+		Desc: "Decodes the JSON document in a file.",
+		Params: []string{
+			"path  The file to read",
+		},
+	})
+	set("write_file", m.luaWriteFile, &doc.Docs{
+		Sig:  "(path, value, opt) => ()",
+		Desc: "Encodes value and writes it to a file followed by a newline.  Options are the same as json.encode().",
+		Params: []string{
+			"path   The file to write",
+			"value  The value to encode",
+			"opt    Optional table of options",
+		},
+	})
+	set("array", m.luaMark(m.array), &doc.Docs{
+		Sig:  "t => t",
+		Desc: "Marks t to be encoded as an array and returns it.",
+		Params: []string{
+			"t  Optional table (default {})",
+		},
+	})
+	set("object", m.luaMark(m.object), &doc.Docs{
+		Sig:  "t => t",
+		Desc: "Marks t to be encoded as an object and returns it.",
+		Params: []string{
+			"t  Optional table (default {})",
+		},
+	})
+	set("number", m.luaNumber, &doc.Docs{
+		Sig:  "str => number",
+		Desc: "Returns a number which is encoded exactly as str.  The value can be converted back to a string with tostring().",
+		Params: []string{
+			"str  A JSON number",
+		},
+	})
+
+	l.SetField(mod, "null", m.null)
+
+	l.Push(mod)
+	return 1
+}
+
+type module struct {
+	array  *lua.LTable
+	object *lua.LTable
+	number *lua.LTable
+	null   *lua.LUserData
+}
+
+func (m *module) luaDecode(l *lua.LState) int {
+	str := l.CheckString(1)
+	v, err := m.decode(l, strings.NewReader(str))
+	if err != nil {
+		l.RaiseError("%s", err.Error())
+		return 0
+	}
+	l.Push(v)
+	return 1
+}
+
+func (m *module) luaReadFile(l *lua.LState) int {
+	path := l.CheckString(1)
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		l.RaiseError("%s", err.Error())
+		return 0
+	}
+	v, err := m.decode(l, bytes.NewReader(p))
+	if err != nil {
+		l.RaiseError("%s: %s", path, err.Error())
+		return 0
+	}
+	l.Push(v)
+	return 1
+}
+
+func (m *module) luaEncode(l *lua.LState) int {
+	v := l.CheckAny(1)
+	p, err := m.encode(l, v, l.OptTable(2, nil))
+	if err != nil {
+		l.RaiseError("%s", err.Error())
+		return 0
+	}
+	l.Push(lua.LString(p))
+	return 1
+}
+
+func (m *module) luaWriteFile(l *lua.LState) int {
+	path := l.CheckString(1)
+	v := l.CheckAny(2)
+	p, err := m.encode(l, v, l.OptTable(3, nil))
+	if err != nil {
+		l.RaiseError("%s", err.Error())
+		return 0
+	}
+	err = ioutil.WriteFile(path, append(p, '\n'), 0644)
+	if err != nil {
+		l.RaiseError("%s", err.Error())
+	}
+	return 0
+}
+
+func (m *module) luaMark(mt *lua.LTable) lua.LGFunction {
+	return func(l *lua.LState) int {
+		t := l.OptTable(1, l.NewTable())
+		l.SetMetatable(t, mt)
+		l.Push(t)
+		return 1
+	}
+}
+
+func (m *module) luaNumber(l *lua.LState) int {
+	str := l.CheckString(1)
+	if !isNumber(str) {
+		l.ArgError(1, "invalid JSON number: "+str)
+	}
+	l.Push(m.newNumber(l, encjson.Number(str)))
+	return 1
+}
+
+func luaNumberString(l *lua.LState) int {
+	ud := l.CheckUserData(1)
+	l.Push(lua.LString(fmt.Sprint(ud.Value)))
+	return 1
+}
+
+func (m *module) newNumber(l *lua.LState, n encjson.Number) *lua.LUserData {
+	ud := l.NewUserData()
+	ud.Value = n
+	ud.Metatable = m.number
+	return ud
+}
+
+// isNumber returns true if s is a valid JSON number.
+func isNumber(s string) bool {
+	var n encjson.Number
+	err := encjson.Unmarshal([]byte(s), &n)
+	return err == nil && string(n) == s
+}
+
+func (m *module) decode(l *lua.LState, r io.Reader) (lua.LValue, error) {
+	dec := encjson.NewDecoder(r)
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	_, err = dec.Token()
+	if err != io.EOF {
+		return nil, fmt.Errorf("invalid data after top-level value")
+	}
+	return m.toLua(l, v), nil
+}
+
+func (m *module) toLua(l *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case nil:
+		return m.null
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case encjson.Number:
+		if i, err := v.Int64(); err == nil {
+			if i > -maxExactInt && i < maxExactInt {
+				return lua.LNumber(i)
+			}
+			return m.newNumber(l, v)
+		}
+		if !strings.ContainsAny(string(v), ".eE") {
+			// an integer that does not fit in an int64
+			return m.newNumber(l, v)
+		}
+		f, _ := v.Float64()
+		return lua.LNumber(f)
+	case []interface{}:
+		t := l.NewTable()
+		for _, x := range v {
+			t.Append(m.toLua(l, x))
+		}
+		t.Metatable = m.array
+		return t
+	case map[string]interface{}:
+		t := l.NewTable()
+		for k, x := range v {
+			t.RawSetString(k, m.toLua(l, x))
+		}
+		t.Metatable = m.object
+		return t
+	default:
+		panic(fmt.Sprintf("unexpected value: %T", v))
+	}
+}
+
+func (m *module) encode(l *lua.LState, v lua.LValue, opt *lua.LTable) ([]byte, error) {
+	e := &encoder{
+		m:       m,
+		visited: make(map[*lua.LTable]bool),
+	}
+	var indent string
+	if opt != nil {
+		switch n := l.GetField(opt, "indent").(type) {
+		case lua.LNumber:
+			indent = strings.Repeat(" ", int(n))
+		case lua.LString:
+			indent = string(n)
+		}
+	}
+	err := e.encode(v)
+	if err != nil {
+		return nil, err
+	}
+	if indent == "" {
+		return e.buf.Bytes(), nil
+	}
+	var buf bytes.Buffer
+	err = encjson.Indent(&buf, e.buf.Bytes(), "", indent)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type encoder struct {
+	m       *module
+	buf     bytes.Buffer
+	visited map[*lua.LTable]bool
+}
+
+func (e *encoder) encode(v lua.LValue) error {
+	switch v := v.(type) {
+	case *lua.LNilType:
+		e.buf.WriteString("null")
+	case lua.LBool:
+		e.buf.WriteString(strconv.FormatBool(bool(v)))
+	case lua.LString:
+		return e.writeString(string(v))
+	case lua.LNumber:
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("cannot encode number: %v", f)
+		}
+		if f == math.Trunc(f) && math.Abs(f) < maxExactInt {
+			e.buf.WriteString(strconv.FormatInt(int64(f), 10))
+		} else {
+			e.buf.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	case *lua.LUserData:
+		if v == e.m.null {
+			e.buf.WriteString("null")
+			return nil
+		}
+		n, ok := v.Value.(encjson.Number)
+		if !ok || v.Metatable != e.m.number {
+			return fmt.Errorf("cannot encode userdata")
+		}
+		e.buf.WriteString(string(n))
+	case *lua.LTable:
+		if e.visited[v] {
+			return fmt.Errorf("cannot encode table containing itself")
+		}
+		e.visited[v] = true
+		defer delete(e.visited, v)
+		return e.encodeTable(v)
+	default:
+		return fmt.Errorf("cannot encode %s", v.Type())
+	}
+	return nil
+}
+
+// writeString writes s as a JSON string.  An error is returned if s is not
+// valid UTF-8 because encoding/json would replace the invalid bytes.
+func (e *encoder) writeString(s string) error {
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("cannot encode string that is not valid UTF-8: %q", s)
+	}
+	enc := encjson.NewEncoder(&e.buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(s)
+	if err != nil {
+		return err
+	}
+	e.buf.Truncate(e.buf.Len() - 1) // trailing newline
+	return nil
+}
+
+// tableKind returns the kind recorded in the metatable of t, or infers it
+// from the keys of t.
+func (e *encoder) tableKind(t *lua.LTable) (string, error) {
+	switch t.Metatable {
+	case e.m.array:
+		return kindArray, nil
+	case e.m.object:
+		return kindObject, nil
+	}
+	n := t.Len()
+	count := 0
+	strkeys := false
+	t.ForEach(func(k, _ lua.LValue) {
+		count++
+		if _, ok := k.(lua.LString); ok {
+			strkeys = true
+		}
+	})
+	switch {
+	case count == 0:
+		return kindObject, nil
+	case count == n:
+		return kindArray, nil
+	case strkeys && n > 0:
+		return "", fmt.Errorf("cannot encode table with both array and object keys")
+	default:
+		return kindObject, nil
+	}
+}
+
+func (e *encoder) encodeTable(t *lua.LTable) error {
+	kind, err := e.tableKind(t)
+	if err != nil {
+		return err
+	}
+	if kind == kindArray {
+		e.buf.WriteByte('[')
+		for i := 1; i <= t.Len(); i++ {
+			if i > 1 {
+				e.buf.WriteByte(',')
+			}
+			err := e.encode(t.RawGetInt(i))
+			if err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte(']')
+		return nil
+	}
+
+	var keys []string
+	values := make(map[string]lua.LValue)
+	t.ForEach(func(k, v lua.LValue) {
+		var key string
+		switch k := k.(type) {
+		case lua.LString:
+			key = string(k)
+		case lua.LNumber:
+			key = k.String()
+		default:
+			if err == nil {
+				err = fmt.Errorf("cannot encode object key of type %s", k.Type())
+			}
+			return
+		}
+		keys = append(keys, key)
+		values[key] = v
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(keys)
+	e.buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		err := e.writeString(key)
+		if err != nil {
+			return err
+		}
+		e.buf.WriteByte(':')
+		err = e.encode(values[key])
+		if err != nil {
+			return err
+		}
+	}
+	e.buf.WriteByte('}')
+	return nil
+}
@@ -0,0 +1,21 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/bmatsuo/lark/gluatest"
+)
+
+var luaJSONTest = &gluatest.File{
+	Module: Module,
+	Path:   "json_test.lua",
+}
+
+func TestModule(t *testing.T) {
+	luaJSONTest.Test(t)
+}
+
+func BenchmarkRequireModule(b *testing.B) {
+	file := &gluatest.File{Module: Module}
+	file.BenchmarkRequireModule(b)
+}
@@ -0,0 +1,82 @@
+local json = require('json')
+
+function test_decode()
+    local v = json.decode('{"a": [1, 2.5, "x", true, null], "b": {}}')
+    assert(v.a[1] == 1)
+    assert(v.a[2] == 2.5)
+    assert(v.a[3] == 'x')
+    assert(v.a[4] == true)
+    assert(v.a[5] == json.null)
+    assert(#v.a == 5)
+    assert(next(v.b) == nil)
+    assert(json.decode('"s"') == 's')
+    assert(not pcall(json.decode, '{'))
+    assert(not pcall(json.decode, '1 2'))
+end
+
+function test_encode()
+    assert(json.encode(1) == '1')
+    assert(json.encode(1.5) == '1.5')
+    assert(json.encode('a<b') == '"a<b"')
+    assert(json.encode(json.null) == 'null')
+    assert(json.encode({1, 2, 3}) == '[1,2,3]')
+    assert(json.encode({}) == '{}')
+    assert(json.encode({a = 1, b = {true}}) == '{"a":1,"b":[true]}')
+    assert(json.encode({[3] = 'x'}) == '{"3":"x"}')
+    assert(not pcall(json.encode, {1, a = 2}))
+    assert(not pcall(json.encode, print))
+    assert(not pcall(json.encode, 0/0))
+    assert(not pcall(json.encode, 'a\255b'))
+    assert(not pcall(json.encode, {['\255'] = 1}))
+    local t = {}
+    t.t = t
+    assert(not pcall(json.encode, t))
+end
+
+function test_encode_sorted()
+    local t = {}
+    for i = 1, 20 do
+        t['k' .. i] = i
+    end
+    local s = json.encode(t)
+    assert(s == json.encode(json.decode(s)))
+    assert(string.find(s, '^{"k1":1,"k10":10,"k11":11,'))
+end
+
+function test_encode_indent()
+    local s = json.encode({a = {1}, b = 'x'}, {indent = 2})
+    assert(s == '{\n  "a": [\n    1\n  ],\n  "b": "x"\n}')
+    s = json.encode({1}, {indent = '\t'})
+    assert(s == '[\n\t1\n]')
+end
+
+function test_array_object()
+    assert(json.encode(json.array()) == '[]')
+    assert(json.encode(json.object({})) == '{}')
+    local v = json.decode('{"a": [], "b": {}}')
+    assert(json.encode(v) == '{"a":[],"b":{}}')
+    table.insert(v.a, 1)
+    assert(json.encode(v.a) == '[1]')
+end
+
+function test_big_numbers()
+    local v = json.decode('[9007199254740993,-12345678901234567890,9007199254740992]')
+    assert(tostring(v[1]) == '9007199254740993')
+    assert(tostring(v[2]) == '-12345678901234567890')
+    assert(json.encode(v) == '[9007199254740993,-12345678901234567890,9007199254740992]')
+    assert(json.encode(json.number('123456789012345678901234567890')) == '123456789012345678901234567890')
+    assert(not pcall(json.number, '12a'))
+end
+
+function test_files()
+    local path = os.tmpname()
+    json.write_file(path, {a = {1, 2}}, {indent = 2})
+    local f = io.open(path)
+    local content = f:read('*a')
+    f:close()
+    assert(content == '{\n  "a": [\n    1,\n    2\n  ]\n}\n')
+    local v = json.read_file(path)
+    assert(v.a[2] == 2)
+    os.remove(path)
+    assert(not pcall(json.read_file, path))
+end
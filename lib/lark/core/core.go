@@ -9,12 +9,17 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/bmatsuo/lark/execgroup"
 	"github.com/bmatsuo/lark/gluamodule"
 	"github.com/bmatsuo/lark/lib/doc"
+	"github.com/bmatsuo/lark/lib/lark/task"
 	"github.com/fatih/color"
 	"github.com/mattn/go-isatty"
 	"github.com/yuin/gopher-lua"
@@ -25,8 +30,9 @@ var Module = gluamodule.New("lark.core", Loader,
 	doc.Module,
 )
 
-// InitModule changes the configuration of the module.  It is not safe to call
-// InitModule after the module has been loaded.
+// InitModule changes the configuration of the module.  The setting made with
+// SetColor is kept.  It is not safe to call InitModule after the module has
+// been loaded.
 func InitModule(logWriter io.Writer, limit int) {
 	if logWriter == nil {
 		logWriter = os.Stderr
@@ -34,17 +40,281 @@ func InitModule(logWriter io.Writer, limit int) {
 	if limit == 0 {
 		limit = runtime.NumCPU()
 	}
-	defaultCore = newCore(logWriter, limit)
+	c := newCore(logWriter, limit)
+	c.color = atomic.LoadInt32(&defaultCore.color)
+	defaultCore = c
 }
 
 var defaultCore = newCore(os.Stderr, runtime.NumCPU())
 
+// Config contains the configuration of an Instance.
+type Config struct {
+	// Log receives messages logged by the module.  If nil os.Stderr is used.
+	Log io.Writer
+	// Stdout and Stderr receive the output of executed commands which is not
+	// redirected.  If nil os.Stdout and os.Stderr are used.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Limit is the number of commands that may execute concurrently.  If zero
+	// the number of CPUs is used, if negative there is no limit.
+	Limit int
+	// Color is "always" or "never" to override the detection of a terminal
+	// for colored log output.  Any other value detects a terminal.
+	Color string
+}
+
+// Instance is an instance of the lark.core module that is independent of
+// the module configured by InitModule.  Each instance has its own scheduler
+// and output.
+type Instance struct {
+	core   *core
+	module gluamodule.Module
+}
+
+// New returns a new Instance configured by conf.
+func New(conf *Config) *Instance {
+	if conf == nil {
+		conf = &Config{}
+	}
+	logWriter := conf.Log
+	if logWriter == nil {
+		logWriter = os.Stderr
+	}
+	limit := conf.Limit
+	if limit == 0 {
+		limit = runtime.NumCPU()
+	}
+	c := newCore(logWriter, limit)
+	if conf.Stdout != nil {
+		c.stdout = conf.Stdout
+	}
+	if conf.Stderr != nil {
+		c.stderr = conf.Stderr
+	}
+	switch conf.Color {
+	case "always":
+		c.color = colorAlways
+	case "never":
+		c.color = colorNever
+	}
+	loader := func(l *lua.LState) int {
+		l.Push(l.SetFuncs(l.NewTable(), c.exports()))
+		return 1
+	}
+	return &Instance{
+		core:   c,
+		module: gluamodule.New(Module.Name(), loader, doc.Module),
+	}
+}
+
+// Module returns a gluamodule.Module that loads the instance as the lark.core
+// module.
+func (i *Instance) Module() gluamodule.Module {
+	return i.module
+}
+
+// Interrupt is like the package function Interrupt but affects only the
+// instance.
+func (i *Instance) Interrupt() {
+	i.core.interrupt()
+}
+
+// ResetInterrupt undoes a previous call to Interrupt so that commands
+// executed afterwards are not interrupted.
+func (i *Instance) ResetInterrupt() {
+	i.core.runmut.Lock()
+	defer i.core.runmut.Unlock()
+	atomic.StoreInt32(&i.core.interrupted, 0)
+}
+
+// Interrupted returns true if Interrupt has been called on the instance.
+func (i *Instance) Interrupted() bool {
+	return atomic.LoadInt32(&i.core.interrupted) != 0
+}
+
+// Log logs a message using the instance's log writer.
+func (i *Instance) Log(msg string, opt *LogOpt) {
+	i.core.log(msg, opt)
+}
+
+// Failures is like the package function Failures but returns commands
+// executed by the instance.
+func (i *Instance) Failures() []*Failure {
+	return i.core.getFailures()
+}
+
+// ErrInterrupted is returned for the commands running when Interrupt is
+// called and for the commands executed after Interrupt.
+var ErrInterrupted = errors.New("interrupted")
+
+// interruptTimeout is how long commands have to exit after Interrupt before
+// they are killed.
+var interruptTimeout = 5 * time.Second
+
+// Interrupt terminates the running commands, causing them to fail with
+// ErrInterrupted.  Commands executed after Interrupt fail with ErrInterrupted
+// instead of executing, unless they are executed by the on_failure, project
+// failure, or always hooks of a task, so the failure propagates through the
+// running tasks while allowing them to clean up.  It is safe to call Interrupt
+// concurrently with a running module.
+//
+// On unix systems commands not reading from a terminal run in their own
+// process group, which is sent SIGTERM and then SIGKILL if the command has
+// not exited a few seconds later.
+func Interrupt() {
+	defaultCore.interrupt()
+}
+
+// Interrupted returns true if Interrupt has been called.
+func Interrupted() bool {
+	return atomic.LoadInt32(&defaultCore.interrupted) != 0
+}
+
+// Failure describes a command that did not exit successfully.
+type Failure struct {
+	// Command is the command line as it was logged.
+	Command string
+	// Status is the exit status of the command, or -1 if the command could
+	// not be started or was terminated by a signal.
+	Status int
+	// Tasks contains the names of the tasks that were running when the
+	// command was executed, outermost first.
+	Tasks []string
+	Err   error
+}
+
+// Failures returns the commands that have failed, in the order they
+// completed.  Commands executed with the named value 'ignore' and commands
+// which did not execute because of Interrupt are not included.
+func Failures() []*Failure {
+	return defaultCore.getFailures()
+}
+
+// exitStatus returns the exit status of a command that failed with err.
+func exitStatus(err error) int {
+	if err, ok := err.(*exec.ExitError); ok {
+		if status, ok := err.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+	return -1
+}
+
+// newFailure returns a Failure for a command executed in state with args.
+func newFailure(state *lua.LState, v1 lua.LValue, args []string) *Failure {
+	cmd, ok := state.GetField(v1, "_str").(lua.LString)
+	if !ok {
+		cmd = lua.LString(strings.Join(args, " "))
+	}
+	return &Failure{
+		Command: string(cmd),
+		Tasks:   task.Stack(state),
+	}
+}
+
+// recordFailure records f if err is a command failure.
+func (c *core) recordFailure(f *Failure, err error) {
+	if err == nil || err == ErrInterrupted {
+		return
+	}
+	f.Err = err
+	f.Status = exitStatus(err)
+	c.failmut.Lock()
+	c.failures = append(c.failures, f)
+	c.failmut.Unlock()
+}
+
+// interrupt terminates the running commands and causes commands started
+// afterwards to fail.  Commands which have not exited after interruptTimeout
+// are killed.  Only the first call to interrupt has an effect.
+func (c *core) interrupt() {
+	c.runmut.Lock()
+	defer c.runmut.Unlock()
+	if atomic.LoadInt32(&c.interrupted) != 0 {
+		return
+	}
+	atomic.StoreInt32(&c.interrupted, 1)
+	if len(c.running) == 0 {
+		return
+	}
+	for cmd := range c.running {
+		c.running[cmd] = true
+		terminate(cmd)
+	}
+	time.AfterFunc(interruptTimeout, c.killInterrupted)
+}
+
+// killInterrupted kills the commands terminated by interrupt that are still
+// running.
+func (c *core) killInterrupted() {
+	c.runmut.Lock()
+	defer c.runmut.Unlock()
+	for cmd, interrupted := range c.running {
+		if interrupted {
+			kill(cmd)
+		}
+	}
+}
+
+// start starts cmd unless Interrupt has been called, in which case
+// ErrInterrupted is returned.  If cleanup is true cmd is started regardless
+// of interrupts.
+func (c *core) start(cmd *exec.Cmd, cleanup bool) error {
+	c.runmut.Lock()
+	defer c.runmut.Unlock()
+	if !cleanup && atomic.LoadInt32(&c.interrupted) != 0 {
+		return ErrInterrupted
+	}
+	setProcessGroup(cmd)
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	c.running[cmd] = false
+	return nil
+}
+
+// wait waits for cmd, which was started with c.start, to exit.  If cmd was
+// killed by an interrupt ErrInterrupted is returned.
+func (c *core) wait(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	c.runmut.Lock()
+	interrupted := c.running[cmd]
+	delete(c.running, cmd)
+	c.runmut.Unlock()
+	if interrupted {
+		return ErrInterrupted
+	}
+	return err
+}
+
+func (c *core) getFailures() []*Failure {
+	c.failmut.Lock()
+	defer c.failmut.Unlock()
+	return append([]*Failure(nil), c.failures...)
+}
+
 type core struct {
-	logger     *log.Logger
-	isTTY      bool
-	groups     map[string]*execgroup.Group
-	limit      chan struct{}
-	grouplimit map[string]chan struct{}
+	logger *log.Logger
+	isTTY  bool
+	stdout io.Writer
+	stderr io.Writer
+	limit  chan struct{}
+	pools  map[string]*pool
+
+	// color is accessed atomically.
+	color int32
+
+	// interrupted is accessed atomically.  Changes to interrupted are made
+	// while holding runmut so that they are consistent with running, which
+	// maps each running command to true if it was terminated by an
+	// interrupt.
+	interrupted int32
+	runmut      sync.Mutex
+	running     map[*exec.Cmd]bool
+
+	failmut  sync.Mutex
+	failures []*Failure
 }
 
 func istty(w io.Writer) bool {
@@ -62,7 +332,11 @@ func istty(w io.Writer) bool {
 func newCore(logfile io.Writer, limit int) *core {
 	c := &core{
 		isTTY:  istty(logfile),
-		groups: make(map[string]*execgroup.Group),
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		pools:  make(map[string]*pool),
+
+		running: make(map[*exec.Cmd]bool),
 	}
 	if limit > 0 {
 		c.limit = make(chan struct{}, limit)
@@ -93,6 +367,7 @@ func (c *core) exports() map[string]lua.LGFunction {
 		"exec":       c.LuaExecRaw,
 		"start":      c.LuaStartRaw,
 		"make_group": c.LuaMakeGroup,
+		"make_pool":  c.LuaMakePool,
 		"wait":       c.LuaWait,
 	}
 }
@@ -205,64 +480,70 @@ func (c *core) LuaMakeGroup(state *lua.LState) int {
 		}
 	}
 
+	gs := stateGroups(state)
 	var gfollows []*execgroup.Group
 	for _, name := range follows {
-		g, ok := c.groups[name]
-		if !ok {
-			g = execgroup.NewGroup(nil)
-			c.groups[name] = g
-		}
-		gfollows = append(gfollows, g)
+		gfollows = append(gfollows, gs.group(name))
 	}
 
-	_, ok := c.groups[groupname]
+	_, ok := gs.groups[groupname]
 	if ok {
 		msg := fmt.Sprintf("group already exists: %q", groupname)
 		state.ArgError(1, msg)
 		return 0
 	}
 
-	c.groups[groupname] = execgroup.NewGroup(gfollows)
+	gs.groups[groupname] = execgroup.NewGroup(gfollows)
 	if limit < 0 {
-		c.grouplimit[groupname] = nil
+		gs.limits[groupname] = nil
 	} else if limit > 0 {
-		c.grouplimit[groupname] = make(chan struct{}, limit)
+		gs.limits[groupname] = make(chan struct{}, limit)
 	}
 
 	return 0
 }
 
+// LuaWait waits for the named groups, or every group used by the calling
+// state if no name is given.  Every group is waited for even if one fails.
+// The returned table contains the message of the first failure as 'error'
+// and an array with the message of each failed group as 'errors'.
 func (c *core) LuaWait(state *lua.LState) int {
+	gs := stateGroups(state)
 	var names []string
 	n := state.GetTop()
 	if n == 0 {
-		for name := range c.groups {
+		for name := range gs.groups {
 			names = append(names, name)
 		}
+		sort.Strings(names)
 	} else {
 		for i := 1; i <= n; i++ {
-			names = append(names, state.CheckString(1))
+			names = append(names, state.CheckString(i))
 		}
 	}
 
 	rt := state.NewTable()
 
-	var err error
+	errs := state.NewTable()
 	for _, name := range names {
-		group := c.groups[name]
-		if group != nil {
-			if err == nil {
-				err = group.Wait()
-			} else {
-				group.Wait()
-			}
+		group := gs.groups[name]
+		if group == nil {
+			continue
+		}
+		err := group.Wait()
+		if err == nil {
+			continue
 		}
-	}
-
-	if err != nil {
 		msg := fmt.Sprintf("asynchronous error: %v", err)
-		state.SetField(rt, "error", lua.LString(msg))
+		if name != "" {
+			msg = fmt.Sprintf("asynchronous error in group %s: %v", name, err)
+		}
+		if errs.Len() == 0 {
+			state.SetField(rt, "error", lua.LString(msg))
+		}
+		errs.Append(lua.LString(msg))
 	}
+	state.SetField(rt, "errors", errs)
 	state.Push(rt)
 
 	return 1
@@ -293,7 +574,7 @@ func (c *core) LuaStartRaw(state *lua.LState) int {
 		args[i] = string(arg)
 	}
 
-	opt := &ExecRawOpt{}
+	opt := &ExecRawOpt{Cleanup: task.Cleanup(state)}
 
 	ignore := false
 	lignore := state.GetField(v1, "ignore")
@@ -432,6 +713,9 @@ func (c *core) LuaStartRaw(state *lua.LState) int {
 		}
 	}
 	opt.Env = env
+	opt.resolve(Dir(state))
+
+	claims := c.poolClaims(state, v1)
 
 	lstr := state.GetField(v1, "_str")
 	str, _ := lstr.(lua.LString)
@@ -440,24 +724,26 @@ func (c *core) LuaStartRaw(state *lua.LState) int {
 		lecho = true
 	}
 
-	group, ok := c.groups[groupname]
-	if !ok {
-		group = execgroup.NewGroup(nil)
-		c.groups[groupname] = group
-	}
+	gs := stateGroups(state)
+	group := gs.group(groupname)
 
 	limit := c.limit
-	glimit, ok := c.grouplimit[groupname]
+	glimit, ok := gs.limits[groupname]
 	if ok && glimit == nil {
 		// if the group has specifically been unilimited then remove the global
 		// limit as well.
 		limit = nil
 	}
+	failure := newFailure(state, v1, args)
 	err := group.Exec(func() error {
 		if glimit != nil {
 			glimit <- struct{}{}
 			defer func() { <-glimit }()
 		}
+		if len(claims) > 0 {
+			acquirePools(claims)
+			defer releasePools(claims)
+		}
 		if limit != nil {
 			limit <- struct{}{}
 			defer func() { <-limit }()
@@ -470,6 +756,7 @@ func (c *core) LuaStartRaw(state *lua.LState) int {
 		if ignore {
 			return nil
 		}
+		c.recordFailure(failure, result.Err)
 		return result.Err
 	})
 
@@ -509,7 +796,7 @@ func (c *core) LuaExecRaw(state *lua.LState) int {
 		args[i] = string(arg)
 	}
 
-	opt := &ExecRawOpt{}
+	opt := &ExecRawOpt{Cleanup: task.Cleanup(state)}
 
 	ldir := state.GetField(v1, "dir")
 	if ldir != lua.LNil {
@@ -626,6 +913,9 @@ func (c *core) LuaExecRaw(state *lua.LState) int {
 		}
 	}
 	opt.Env = env
+	opt.resolve(Dir(state))
+
+	claims := c.poolClaims(state, v1)
 
 	lecho, ok := state.GetField(v1, "echo").(lua.LBool)
 	if !ok {
@@ -635,11 +925,16 @@ func (c *core) LuaExecRaw(state *lua.LState) int {
 	lstr := state.GetField(v1, "_str")
 	str, _ := lstr.(lua.LString)
 
+	acquirePools(claims)
 	if str != "" && lecho {
 		opt := &LogOpt{Color: "green"}
 		c.log(string(str), opt)
 	}
 	result := c.execRaw(args[0], args[1:], opt)
+	releasePools(claims)
+	if !lua.LVAsBool(state.GetField(v1, "ignore")) {
+		c.recordFailure(newFailure(state, v1, args), result.Err)
+	}
 	rt := state.NewTable()
 	if result.Err != nil {
 		state.SetField(rt, "error", lua.LString(result.Err.Error()))
@@ -709,6 +1004,9 @@ type ExecRawOpt struct {
 
 	StdoutTee bool
 	StderrTee bool
+
+	// Cleanup allows the command to execute after Interrupt.
+	Cleanup bool
 }
 
 // ExecRaw executes the named command with the given arguments.
@@ -728,7 +1026,10 @@ func (c *core) execRaw(name string, args []string, opt *ExecRawOpt) *ExecRawResu
 	var stderr io.Writer
 
 	if opt == nil {
-		err := cmd.Run()
+		err := c.start(cmd, false)
+		if err == nil {
+			err = c.wait(cmd)
+		}
 		return &ExecRawResult{Err: err}
 	}
 
@@ -778,7 +1079,7 @@ func (c *core) execRaw(name string, args []string, opt *ExecRawOpt) *ExecRawResu
 		}
 	}
 	if opt.StdoutTee && stdout != nil {
-		stdout = io.MultiWriter(stdout, os.Stdout)
+		stdout = io.MultiWriter(stdout, c.stdout)
 	}
 	if opt.StderrCapture {
 		if stderr != nil {
@@ -788,7 +1089,7 @@ func (c *core) execRaw(name string, args []string, opt *ExecRawOpt) *ExecRawResu
 		}
 	}
 	if opt.StderrTee && stderr != nil {
-		stderr = io.MultiWriter(stderr, os.Stderr)
+		stderr = io.MultiWriter(stderr, c.stderr)
 	}
 
 	ioerr := make(chan error, 2)
@@ -812,7 +1113,7 @@ func (c *core) execRaw(name string, args []string, opt *ExecRawOpt) *ExecRawResu
 		}
 		closers = append(closers, pout)
 	} else {
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = c.stdout
 	}
 	if stderr != nil {
 		var err error
@@ -823,11 +1124,11 @@ func (c *core) execRaw(name string, args []string, opt *ExecRawOpt) *ExecRawResu
 		}
 		closers = append(closers, perr)
 	} else {
-		cmd.Stderr = os.Stderr
+		cmd.Stderr = c.stderr
 	}
 
 	result := &ExecRawResult{}
-	result.Err = cmd.Start()
+	result.Err = c.start(cmd, opt.Cleanup)
 	if result.Err != nil {
 		doclose()
 		return result
@@ -855,13 +1156,13 @@ func (c *core) execRaw(name string, args []string, opt *ExecRawOpt) *ExecRawResu
 				for j := 0; j < n; j++ {
 					<-ioerr
 				}
-				cmd.Wait()
+				c.wait(cmd)
 			}(n - i - 1)
 			return result
 		}
 	}
 
-	result.Err = cmd.Wait()
+	result.Err = c.wait(cmd)
 
 	return result
 }
@@ -887,6 +1188,23 @@ func getOutFile(name string, a bool) (*os.File, error) {
 	return nil, fmt.Errorf("invalid file descriptor")
 }
 
+const (
+	colorAuto int32 = iota
+	colorAlways
+	colorNever
+)
+
+// SetColor overrides the detection of a terminal for colored log output of
+// the module configured by InitModule.  Colors are always used if on is true
+// and never used if on is false.  Instances are configured with Config.Color.
+func SetColor(on bool) {
+	if on {
+		atomic.StoreInt32(&defaultCore.color, colorAlways)
+	} else {
+		atomic.StoreInt32(&defaultCore.color, colorNever)
+	}
+}
+
 // LogOpt contains options for the Log function
 type LogOpt struct {
 	Color string
@@ -902,26 +1220,31 @@ func (c *core) log(msg string, opt *LogOpt) {
 		opt = &LogOpt{}
 	}
 
-	var esc func(format string, v ...interface{}) string
-	if opt.Color != "" && c.isTTY {
-		esc = colorMap[opt.Color]
+	usecolor := c.isTTY
+	switch atomic.LoadInt32(&c.color) {
+	case colorAlways:
+		usecolor = true
+	case colorNever:
+		usecolor = false
 	}
-
-	if esc != nil {
-		msg = esc("%s", msg)
+	attr, ok := colorMap[opt.Color]
+	if ok && usecolor {
+		esc := color.New(attr)
+		esc.EnableColor()
+		msg = esc.SprintFunc()(msg)
 	}
 	c.logger.Print(msg)
 }
 
-var colorMap = map[string]func(format string, v ...interface{}) string{
-	"black":   color.BlackString,
-	"blue":    color.BlueString,
-	"cyan":    color.CyanString,
-	"green":   color.GreenString,
-	"magenta": color.MagentaString,
-	"red":     color.RedString,
-	"white":   color.WhiteString,
-	"yellow":  color.YellowString,
+var colorMap = map[string]color.Attribute{
+	"black":   color.FgBlack,
+	"blue":    color.FgBlue,
+	"cyan":    color.FgCyan,
+	"green":   color.FgGreen,
+	"magenta": color.FgMagenta,
+	"red":     color.FgRed,
+	"white":   color.FgWhite,
+	"yellow":  color.FgYellow,
 }
 
 type syncBuffer struct {
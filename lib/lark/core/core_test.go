@@ -1,10 +1,18 @@
 package core
 
 import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bmatsuo/lark/gluamodule"
 	"github.com/bmatsuo/lark/gluatest"
+	"github.com/bmatsuo/lark/lib/lark/task"
+	"github.com/yuin/gopher-lua"
 )
 
 var luaCoreTest = &gluatest.File{
@@ -20,3 +28,248 @@ func BenchmarkRequireModule(b *testing.B) {
 	file := &gluatest.File{Module: gluamodule.New("lark.core", Loader)}
 	file.BenchmarkRequireModule(b)
 }
+
+func TestExecRawOpt_resolve(t *testing.T) {
+	opt := &ExecRawOpt{
+		StdinFile:  "in.txt",
+		StdoutFile: "/dev/null",
+	}
+	opt.resolve("/project/svc")
+	if opt.Dir != "/project/svc" {
+		t.Errorf("dir: %q", opt.Dir)
+	}
+	if opt.StdinFile != "/project/svc/in.txt" {
+		t.Errorf("stdin: %q", opt.StdinFile)
+	}
+	if opt.StdoutFile != "/dev/null" {
+		t.Errorf("stdout: %q", opt.StdoutFile)
+	}
+	if opt.StderrFile != "" {
+		t.Errorf("stderr: %q", opt.StderrFile)
+	}
+
+	opt = &ExecRawOpt{Dir: "build"}
+	opt.resolve("/project/svc")
+	if opt.Dir != "/project/svc/build" {
+		t.Errorf("relative dir: %q", opt.Dir)
+	}
+}
+
+func TestInstance_Failures(t *testing.T) {
+	inst := New(&Config{Log: ioutil.Discard})
+	l := lua.NewState()
+	defer l.Close()
+	gluamodule.Preload(l, gluamodule.Resolve(task.Module)...)
+	gluamodule.Preload(l, inst.Module())
+
+	err := l.DoString(`
+		local core = require('lark.core')
+		local task = require('lark.task')
+		build = task .. function()
+			core.exec{'sh', '-c', 'exit 3', _str='sh -c "exit 3"'}
+			core.exec{'false', ignore=true}
+		end
+		task.run('build')
+		core.start{'false'}
+		core.wait()
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := inst.Failures()
+	if len(failures) != 2 {
+		t.Fatalf("failures: %d", len(failures))
+	}
+	f := failures[0]
+	if f.Command != `sh -c "exit 3"` || f.Status != 3 || !reflect.DeepEqual(f.Tasks, []string{"build"}) {
+		t.Errorf("failure: %q %d %q", f.Command, f.Status, f.Tasks)
+	}
+	f = failures[1]
+	if f.Command != "false" || f.Status != 1 || len(f.Tasks) != 0 {
+		t.Errorf("failure: %q %d %q", f.Command, f.Status, f.Tasks)
+	}
+}
+
+func TestInstance_groups(t *testing.T) {
+	inst := New(&Config{Log: ioutil.Discard})
+	var states []*lua.LState
+	for i := 0; i < 2; i++ {
+		l := lua.NewState()
+		defer l.Close()
+		gluamodule.Preload(l, inst.Module())
+		states = append(states, l)
+	}
+
+	// each state has its own groups even though they share the instance.
+	err := states[0].DoString(`
+		local core = require('lark.core')
+		core.start{'false', group='g'}
+		core.make_group{name='other'}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = states[1].DoString(`
+		local core = require('lark.core')
+		core.make_group{name='other'}
+		core.start{'true', group='g'}
+		result = core.wait()
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := states[1].GetGlobal("result")
+	if msg := states[1].GetField(result, "error"); msg != lua.LNil {
+		t.Errorf("wait raised the error of another state: %v", msg)
+	}
+	err = states[0].DoString(`result = require('lark.core').wait('g')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result = states[0].GetGlobal("result")
+	if msg := states[0].GetField(result, "error"); msg == lua.LNil {
+		t.Errorf("wait did not return the error of group g")
+	}
+}
+
+// interruptTest runs the build task defined by code after starting a
+// goroutine that interrupts inst shortly after a command starts, giving the
+// command time to start its own processes.  The task must not take more than
+// a few seconds to fail.
+func interruptTest(t *testing.T, inst *Instance, code string) *lua.LState {
+	l := lua.NewState()
+	gluamodule.Preload(l, gluamodule.Resolve(task.Module)...)
+	gluamodule.Preload(l, inst.Module())
+
+	go func() {
+		for {
+			inst.core.runmut.Lock()
+			n := len(inst.core.running)
+			inst.core.runmut.Unlock()
+			if n > 0 {
+				time.Sleep(100 * time.Millisecond)
+				inst.Interrupt()
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	start := time.Now()
+	err := l.DoString(code + "\ntask.run('build')")
+	if err == nil || !strings.Contains(err.Error(), ErrInterrupted.Error()) {
+		t.Errorf("error: %v", err)
+	}
+	if time.Since(start) > 4*time.Second {
+		t.Errorf("command was not killed")
+	}
+	if !inst.Interrupted() {
+		t.Errorf("instance is not interrupted")
+	}
+	if len(inst.Failures()) != 0 {
+		t.Errorf("failures: %d", len(inst.Failures()))
+	}
+	return l
+}
+
+func TestInstance_Interrupt(t *testing.T) {
+	inst := New(&Config{Log: ioutil.Discard})
+	l := interruptTest(t, inst, `
+		local core = require('lark.core')
+		local task = require('lark.task')
+		build = task.hooks{
+			always = function()
+				cleaned = not core.exec{'true'}.error
+			end,
+		} .. task .. function()
+			-- the captured output is not closed until sleep exits.
+			local result = core.exec{'sh', '-c', 'sleep 10; true', stdout='$'}
+			after = core.exec{'true'}.error
+			if result.error then
+				error(result.error)
+			end
+		end
+	`)
+	defer l.Close()
+	if l.GetGlobal("cleaned") != lua.LTrue {
+		t.Errorf("always hook could not execute a command")
+	}
+	if l.GetGlobal("after").String() != ErrInterrupted.Error() {
+		t.Errorf("command executed after the interrupt: %v", l.GetGlobal("after"))
+	}
+}
+
+func TestInstance_Interrupt_kill(t *testing.T) {
+	defer func(d time.Duration) { interruptTimeout = d }(interruptTimeout)
+	interruptTimeout = 100 * time.Millisecond
+
+	inst := New(&Config{Log: ioutil.Discard})
+	l := interruptTest(t, inst, `
+		local core = require('lark.core')
+		local task = require('lark.task')
+		build = task .. function()
+			local result = core.exec{'sh', '-c', 'trap "" TERM; sleep 10; true'}
+			if result.error then
+				error(result.error)
+			end
+		end
+	`)
+	l.Close()
+}
+
+func TestInstance_Interrupt_pending(t *testing.T) {
+	inst := New(&Config{Log: ioutil.Discard})
+	inst.Interrupt()
+	l := lua.NewState()
+	defer l.Close()
+	gluamodule.Preload(l, gluamodule.Resolve(task.Module)...)
+	gluamodule.Preload(l, inst.Module())
+	err := l.DoString(`
+		local core = require('lark.core')
+		local task = require('lark.task')
+		build = task.hooks{
+			on_failure = function()
+				cleaned = not core.exec{'true'}.error
+			end,
+		} .. task .. function()
+			first = core.exec{'true'}.error
+			second = core.exec{'true'}.error
+			error(second)
+		end
+		pcall(task.run, 'build')
+		outside = core.exec{'true'}.error
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"first", "second", "outside"} {
+		if l.GetGlobal(name).String() != ErrInterrupted.Error() {
+			t.Errorf("%s command: %v", name, l.GetGlobal(name))
+		}
+	}
+	if l.GetGlobal("cleaned") != lua.LTrue {
+		t.Errorf("on_failure hook could not execute a command")
+	}
+}
+
+func TestInstance_color(t *testing.T) {
+	SetColor(false)
+	defer atomic.StoreInt32(&defaultCore.color, colorAuto)
+
+	for _, test := range []struct {
+		color string
+		esc   bool
+	}{
+		{"always", true},
+		{"never", false},
+		{"", false},
+	} {
+		var buf bytes.Buffer
+		inst := New(&Config{Log: &buf, Color: test.color})
+		inst.Log("msg", &LogOpt{Color: "red"})
+		esc := strings.Contains(buf.String(), "\x1b[")
+		if esc != test.esc {
+			t.Errorf("color %q: escaped %v (%q)", test.color, esc, buf.String())
+		}
+	}
+}
@@ -21,3 +21,14 @@ function test_capture()
     assert(not result.error)
 	assert(result.output == 'just a test\n')
 end
+
+function test_pool()
+    core.make_pool{name='test_pool', size=2}
+    assert(not pcall(core.make_pool, {name='test_pool', size=2}))
+    assert(not pcall(core.make_pool, {name='test_pool_empty', size=0}))
+
+    local result = core.exec{'true', uses={test_pool=2}}
+    assert(not result.error)
+    assert(not pcall(core.exec, {'true', uses={test_pool=3}}))
+    assert(not pcall(core.exec, {'true', uses={test_pool_missing=1}}))
+end
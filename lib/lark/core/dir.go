@@ -0,0 +1,48 @@
+package core
+
+import (
+	"path/filepath"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// dirKey is the registry key holding the working directory of commands
+// executed by a lua.LState.
+const dirKey = "lark.core.dir"
+
+// SetDir sets the directory in which commands executed by l run.  Relative
+// values of the named value 'dir' and redirected files are resolved against
+// dir.  SetDir allows multiple projects to share the module (and its
+// scheduler) without changing the process working directory.
+func SetDir(l *lua.LState, dir string) {
+	reg := l.Get(lua.RegistryIndex).(*lua.LTable)
+	reg.RawSetString(dirKey, lua.LString(dir))
+}
+
+// Dir returns the directory set for l with SetDir, or an empty string.
+func Dir(l *lua.LState) string {
+	reg := l.Get(lua.RegistryIndex).(*lua.LTable)
+	dir, _ := reg.RawGetString(dirKey).(lua.LString)
+	return string(dir)
+}
+
+// resolve makes the directory and redirected files in opt relative to dir.
+func (opt *ExecRawOpt) resolve(dir string) {
+	if dir == "" {
+		return
+	}
+	join := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	if opt.Dir == "" {
+		opt.Dir = dir
+	} else {
+		opt.Dir = join(opt.Dir)
+	}
+	opt.StdinFile = join(opt.StdinFile)
+	opt.StdoutFile = join(opt.StdoutFile)
+	opt.StderrFile = join(opt.StderrFile)
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"github.com/bmatsuo/lark/execgroup"
+	"github.com/yuin/gopher-lua"
+)
+
+// groupsKey is the registry key holding the groups of a lua.LState.
+const groupsKey = "lark.core.groups"
+
+// groupSet contains the groups used by a lua.LState and their limits.  Each
+// state has its own groups, so projects sharing the module (e.g. subprojects)
+// do not wait on each other's groups and may reuse group names.
+type groupSet struct {
+	groups map[string]*execgroup.Group
+	limits map[string]chan struct{}
+}
+
+// stateGroups returns the groups of l, creating them if necessary.
+func stateGroups(l *lua.LState) *groupSet {
+	reg := l.Get(lua.RegistryIndex).(*lua.LTable)
+	ud, ok := reg.RawGetString(groupsKey).(*lua.LUserData)
+	if ok {
+		gs, ok := ud.Value.(*groupSet)
+		if ok {
+			return gs
+		}
+	}
+	gs := &groupSet{
+		groups: make(map[string]*execgroup.Group),
+		limits: make(map[string]chan struct{}),
+	}
+	ud = l.NewUserData()
+	ud.Value = gs
+	reg.RawSetString(groupsKey, ud)
+	return gs
+}
+
+// group returns the named group, creating it if necessary.
+func (gs *groupSet) group(name string) *execgroup.Group {
+	g, ok := gs.groups[name]
+	if !ok {
+		g = execgroup.NewGroup(nil)
+		gs.groups[name] = g
+	}
+	return g
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// pool is a named set of resource units that are claimed by commands for the
+// duration of their execution.  Unlike the global limit, commands may claim
+// more than one unit from a pool.
+type pool struct {
+	cond  *sync.Cond
+	size  int
+	avail int
+}
+
+func newPool(size int) *pool {
+	return &pool{
+		cond:  &sync.Cond{L: &sync.Mutex{}},
+		size:  size,
+		avail: size,
+	}
+}
+
+// acquire blocks until n units are available and claims them.
+func (p *pool) acquire(n int) {
+	p.cond.L.Lock()
+	for p.avail < n {
+		p.cond.Wait()
+	}
+	p.avail -= n
+	p.cond.L.Unlock()
+}
+
+// release returns n units to the pool.
+func (p *pool) release(n int) {
+	p.cond.L.Lock()
+	p.avail += n
+	p.cond.Broadcast()
+	p.cond.L.Unlock()
+}
+
+// poolClaim is a number of units required from a pool.
+type poolClaim struct {
+	name string
+	pool *pool
+	n    int
+}
+
+// acquirePools claims units from each pool in claims.  Claims are acquired in
+// a fixed (name) order so that concurrent commands cannot deadlock.
+func acquirePools(claims []*poolClaim) {
+	for _, claim := range claims {
+		claim.pool.acquire(claim.n)
+	}
+}
+
+// releasePools returns units claimed with acquirePools.
+func releasePools(claims []*poolClaim) {
+	for i := len(claims) - 1; i >= 0; i-- {
+		claims[i].pool.release(claims[i].n)
+	}
+}
+
+type byPoolName []*poolClaim
+
+func (s byPoolName) Len() int           { return len(s) }
+func (s byPoolName) Less(i, j int) bool { return s[i].name < s[j].name }
+func (s byPoolName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// LuaMakePool creates a named resource pool.  LuaMakePool expects one table
+// argument.
+func (c *core) LuaMakePool(state *lua.LState) int {
+	v1 := state.Get(1)
+	if v1.Type() != lua.LTTable {
+		state.ArgError(1, "first argument must be a table")
+		return 0
+	}
+
+	lname := state.GetField(v1, "name")
+	if lname == lua.LNil {
+		state.ArgError(1, "missing named value 'name'")
+		return 0
+	}
+	name, ok := lname.(lua.LString)
+	if !ok {
+		msg := fmt.Sprintf("named value 'name' is not a string: %s", lname.Type())
+		state.ArgError(1, msg)
+		return 0
+	}
+
+	lsize := state.GetField(v1, "size")
+	size, ok := lsize.(lua.LNumber)
+	if !ok {
+		msg := fmt.Sprintf("named value 'size' is not a number: %s", lsize.Type())
+		state.ArgError(1, msg)
+		return 0
+	}
+	if size < 1 {
+		msg := fmt.Sprintf("named value 'size' is not positive: %v", size)
+		state.ArgError(1, msg)
+		return 0
+	}
+
+	_, ok = c.pools[string(name)]
+	if ok {
+		msg := fmt.Sprintf("pool already exists: %q", name)
+		state.ArgError(1, msg)
+		return 0
+	}
+	c.pools[string(name)] = newPool(int(size))
+
+	return 0
+}
+
+// poolClaims reads the named value 'uses' from the first argument table, a
+// mapping of pool names to units.
+func (c *core) poolClaims(state *lua.LState, v1 lua.LValue) []*poolClaim {
+	luses := state.GetField(v1, "uses")
+	if luses == lua.LNil {
+		return nil
+	}
+	uses, ok := luses.(*lua.LTable)
+	if !ok {
+		msg := fmt.Sprintf("named value 'uses' is not a table: %s", luses.Type())
+		state.ArgError(1, msg)
+		return nil
+	}
+
+	var claims []*poolClaim
+	var msg string
+	uses.ForEach(func(k, v lua.LValue) {
+		if msg != "" {
+			return
+		}
+		name, ok := k.(lua.LString)
+		if !ok {
+			msg = fmt.Sprintf("named value 'uses' has a non-string key: %s", k.Type())
+			return
+		}
+		n, ok := v.(lua.LNumber)
+		if !ok {
+			msg = fmt.Sprintf("pool %q units are not a number: %s", name, v.Type())
+			return
+		}
+		p, ok := c.pools[string(name)]
+		if !ok {
+			msg = fmt.Sprintf("unknown pool: %q", name)
+			return
+		}
+		if n < 0 || int(n) > p.size {
+			msg = fmt.Sprintf("pool %q cannot provide %v units (size %d)", name, n, p.size)
+			return
+		}
+		if n > 0 {
+			claims = append(claims, &poolClaim{string(name), p, int(n)})
+		}
+	})
+	if msg != "" {
+		state.ArgError(1, msg)
+		return nil
+	}
+	sort.Sort(byPoolName(claims))
+	return claims
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+// +build !windows
+
+package core
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/mattn/go-isatty"
+)
+
+// setProcessGroup makes cmd the leader of a new process group so that
+// interrupts reach the processes it starts.  A command reading from a
+// terminal is left in the foreground process group so that it can read,
+// because the terminal delivers interrupts to the group.
+func setProcessGroup(cmd *exec.Cmd) {
+	if f, ok := cmd.Stdin.(*os.File); ok && isatty.IsTerminal(f.Fd()) {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signal sends sig to the process group of cmd, or to cmd if it does not lead
+// a process group.
+func signal(cmd *exec.Cmd, sig syscall.Signal) {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		syscall.Kill(-cmd.Process.Pid, sig)
+		return
+	}
+	cmd.Process.Signal(sig)
+}
+
+// terminate asks cmd and the processes it started to exit.
+func terminate(cmd *exec.Cmd) {
+	signal(cmd, syscall.SIGTERM)
+}
+
+// kill kills cmd and the processes it started.
+func kill(cmd *exec.Cmd) {
+	signal(cmd, syscall.SIGKILL)
+}
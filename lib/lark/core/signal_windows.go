@@ -0,0 +1,19 @@
+package core
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup does nothing because processes cannot be signaled as a
+// group.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminate kills cmd because there is no signal asking it to exit.
+func terminate(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+// kill kills cmd.
+func kill(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
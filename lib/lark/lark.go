@@ -8,6 +8,7 @@ import (
 	"github.com/bmatsuo/lark/lib/fun"
 	"github.com/bmatsuo/lark/lib/lark/core"
 	"github.com/bmatsuo/lark/lib/lark/task"
+	"github.com/bmatsuo/lark/lib/str"
 	"github.com/yuin/gopher-lua"
 )
 
@@ -16,6 +17,7 @@ var Module = gluamodule.New("lark", Loader,
 	core.Module,
 	doc.Module,
 	fun.Module,
+	str.Module,
 	task.Module,
 )
 
@@ -57,3 +57,53 @@ function test_exec()
 	assert(out == 'test output\n')
 	assert(not err)
 end
+
+function test_pool()
+    lark.pool('mem', 4)
+    assert(not pcall(lark.pool, 'mem', 4))
+
+    lark.start('true', {uses = {mem = 4}})
+    lark.start('true', {uses = {mem = 1}})
+    lark.start('true', {uses = {mem = 3}})
+    assert(pcall(lark.wait))
+
+    assert(pcall(lark.exec, 'true', {uses = {mem = 2}}))
+    assert(not pcall(lark.exec, 'true', {uses = {mem = 5}}))
+    assert(not pcall(lark.start, 'true', {uses = {cpu = 1}}))
+end
+
+function test_keep_going()
+    -- every failed group is reported by a single error.
+    for _, keep_going in ipairs({false, true}) do
+        lark.keep_going = keep_going
+        lark.start('sh', '-c', 'exit 2', {group = 'kg_a', echo = false})
+        lark.start('sh', '-c', 'exit 3', {group = 'kg_b', echo = false})
+        lark.start('true', {group = 'kg_c', echo = false})
+        local ok, err = pcall(lark.wait, 'kg_a', 'kg_b', 'kg_c')
+        assert(not ok)
+        assert(string.find(err, 'group kg_a: exit status 2', 1, true))
+        assert(keep_going == (string.find(err, 'group kg_b: exit status 3', 1, true) ~= nil))
+    end
+    lark.keep_going = false
+    assert(pcall(lark.wait))
+end
+
+function test_var()
+    assert(lark.var('CC', 'gcc', 'C compiler') == 'gcc')
+    assert(lark.vars.CC.desc == 'C compiler')
+
+    lark.overrides = {CC='clang', jobs='8', debug='true', objects='a.o,b.o', bad='x'}
+    assert(lark.var('CC', 'gcc') == 'clang')
+    assert(lark.var('jobs', 2) == 8)
+    assert(lark.var('debug', false) == true)
+    local objects = lark.var('objects', {'main.o'})
+    assert(#objects == 2)
+    assert(objects[1] == 'a.o')
+    assert(objects[2] == 'b.o')
+    assert(not pcall(lark.var, 'bad', 1))
+    assert(not pcall(lark.var, 'bad', true))
+    assert(lark.vars.jobs.value == 8)
+    assert(lark.vars.jobs.default == 2)
+    lark.overrides = {}
+    lark.vars = {}
+end
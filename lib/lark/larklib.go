@@ -8,6 +8,7 @@ require 'os'
 local core = require('lark.core')
 local task = require('lark.task')
 local fun = require('fun')
+local str = require('str')
 local doc = require('doc')
 
 local function deprecation(old, new, mod)
@@ -33,10 +34,35 @@ local lark =
     verbose boolean
     Log more information then normal if this variable is true.
     ]] ..
+    doc.var[[
+    keep_going boolean
+    When true lark continues to run the remaining tasks given on the command
+    line after a task fails, and the error raised by lark.wait() describes the
+    failure of every group instead of only the first.  This variable is set by
+    the -k flag of the ` + "`" + `` + "`" + `lark run'' command.
+    ]] ..
+    doc.var[[
+    invocation_dir string
+    The working directory lark was invoked from.  Lark changes the working
+    directory to the project root before loading task files.
+    ]] ..
+    doc.var[[
+    overrides table
+    Global variable values given on the command line with the -D flag of the
+    ` + "`" + `` + "`" + `lark run'' command, as strings.
+    ]] ..
+    doc.var[[
+    vars table
+    Variables declared with lark.var().  Each value is a table with fields
+    default, desc, and value.
+    ]] ..
     {
         default_task = nil,
         tasks = {},
         patterns  = {},
+        keep_going = false,
+        overrides = {},
+        vars = {},
     }
 
 lark.pattern = task.pattern
@@ -124,36 +150,6 @@ lark.get_param =
              ]] ..
     deprecated_alias(task.get_param, "lark.get_param()", "get_param()", "lark.task")
 
-local function shell_quote(args)
-    local q = function (s)
-        s = string.gsub(s, '\\', '\\\\')
-        s = string.gsub(s, '"', '\\"')
-        if string.find(s, '%s') then
-            s = '"' .. s .. '"'
-        end
-        return s
-    end
-
-    local str = ''
-    for i, x in pairs(args) do
-        if type(i) == 'number' then
-            if i > 1  then
-                str = str .. ' '
-            end
-            if type(x) == 'string' then
-                str = str .. q(x)
-            else if type(x) == 'table' then
-                str = str .. shell_quote(x)
-            else
-                error(string.format('cannot quote type: %s', type(x)))
-                end
-            end
-        end
-    end
-
-    return str
-end
-
 lark.environ =
     doc.sig[[() => envmap]] ..
     doc.desc[[Return a copy of the process environment as a table.]] ..
@@ -228,6 +224,11 @@ lark.exec =
              opt.ignore  boolean
              Do not terminate execution if cmd exits with an error.
              ]] ..
+    doc.param[[
+             opt.uses    table
+             Units claimed from resource pools while cmd executes, keyed by
+             pool name (e.g. {mem=4, cpu=2}).  See lark.pool().
+             ]] ..
     function (...)
         local args = {...}
         local opt = args[#args]
@@ -242,7 +243,7 @@ lark.exec =
             opt = nil
         end
 
-        cmd._str = shell_quote(cmd)
+        cmd._str = str.shell_quote(cmd)
         local result = core.exec(cmd)
         local output = result.output
         local err = result.error
@@ -284,7 +285,7 @@ lark.start =
         else
             opt = nil
         end
-        cmd._str = shell_quote(cmd) .. ' &'
+        cmd._str = str.shell_quote(cmd) .. ' &'
         core.start(cmd)
     end
 
@@ -331,10 +332,118 @@ lark.group =
         return name
     end
 
+local function split_list(s)
+    local list = {}
+    for item in string.gmatch(s, '[^,]+') do
+        table.insert(list, item)
+    end
+    return list
+end
+
+local function convert_var(name, default, s)
+    local t = type(default)
+    if t == 'number' then
+        local n = tonumber(s)
+        if n == nil then
+            error(string.format('variable %s is not a number: %q', name, s), 4)
+        end
+        return n
+    elseif t == 'boolean' then
+        if s == 'true' or s == '1' then
+            return true
+        elseif s == 'false' or s == '0' or s == '' then
+            return false
+        end
+        error(string.format('variable %s is not a boolean: %q', name, s), 4)
+    elseif t == 'table' then
+        return split_list(s)
+    end
+    return s
+end
+
+lark.var =
+    doc.sig[[(name, default, desc) => value]] ..
+    doc.desc[[
+            Declare a global variable that can be overridden on the command
+            line and return its value.  Overridden values are converted to the
+            type of default.  Numbers and booleans ("true", "false", "1", "0")
+            are parsed, and tables are split on commas.  Declared variables
+            are displayed by ` + "`" + `` + "`" + `lark list''.
+
+                > CC = lark.var('CC', 'gcc', 'C compiler')
+                > objects = lark.var('objects', {'main.o'}, 'Objects to link')
+
+            The above variables can be overridden using the -D flag.
+
+                lark run -D CC=clang -D objects=a.o,b.o build
+            ]] ..
+    doc.param[[
+             name  string
+             The name of the global variable.
+             ]] ..
+    doc.param[[
+             default  any
+             The value used when the variable is not overridden.
+             ]] ..
+    doc.param[[
+             desc  string
+             (optional) A description of the variable.
+             ]] ..
+    function (name, default, desc)
+        if type(name) ~= 'string' then
+            error('variable name is not a string', 3)
+        end
+        local value = default
+        local override = lark.overrides[name]
+        if override ~= nil then
+            value = convert_var(name, default, override)
+        end
+        lark.vars[name] = {default=default, desc=desc, value=value}
+        return value
+    end
+
+lark.pool =
+    doc.sig[[(name, size) => name]] ..
+    doc.desc[[
+            Create a named resource pool containing size units.  Commands
+            passed to lark.exec() and lark.start() claim units from pools with
+            the opt.uses table and do not execute until all their claimed
+            units are available.  Unlike the global limit a command may claim
+            several units from the same pool.
+
+                > lark.pool('mem', 16)
+                > lark.start('ld', objects, {uses={mem=8}})
+                > lark.start('lint', sources, {uses={mem=1}})
+            ]] ..
+    doc.param[[
+             name  string
+             Name of the pool.
+             ]] ..
+    doc.param[[
+             size  number
+             The number of units available in the pool.
+             ]] ..
+    function (name, size)
+        if type(name) == 'table' then
+            size = name.size or name[2]
+            name = name.name or name[1]
+        end
+        if not name then
+            error('no name given to pool')
+        end
+        core.make_pool{name=name, size=size}
+        return name
+    end
+
 lark.wait =
     doc.sig[[(group, ...) => nil]] ..
     doc.desc[[
-            Suspend execution until all processes in the specified groups have terminated.
+            Suspend execution until all processes in the specified groups have
+            terminated.  If no group is given every group used by the project
+            is waited for.  If any process failed an error is raised after
+            every group has terminated.  When lark.keep_going is true the error
+            describes the failure of each group, otherwise only the first
+            failure is described.
             ]] ..
     doc.param[[
              group  string
@@ -345,10 +454,42 @@ lark.wait =
     function (...)
         local args = fun.flatten({...})
         local result = core.wait(unpack(args))
-        if result.error then
+        if result.error and lark.keep_going then
+            error(table.concat(result.errors, '\n'))
+        elseif result.error then
             error(result.error)
         end
     end
 
+lark.subproject =
+    doc.sig[[dir => project]] ..
+    doc.desc[[
+            Load the lark project rooted at dir, a path relative to the project
+            root, and return a table with a run() function that calls
+            lark.run() in the subproject and waits for its asynchronous
+            commands.  Subprojects are loaded once into an isolated Lua state
+            that uses the modules in their own lark_modules directory.
+            Variable overrides given with -D apply to subprojects.  Commands
+            executed in a subproject share the parallelism limit and pools of
+            the caller, but a subproject has its own groups and only waits for
+            the groups it used.  The lark command changes the working directory
+            to the subproject root while the subproject is loaded and while its
+            tasks run, so relative paths (e.g. those given to path.glob(),
+            io.open(), and the fs module) are resolved as if lark were run in
+            the subproject.
+
+                > lark.subproject('svc/a').run('build')
+            ]] ..
+    doc.param[[
+             dir  string
+             The root directory of the subproject.
+             ]] ..
+    function (dir)
+        if not lark._subproject then
+            error('subprojects are not supported')
+        end
+        return lark._subproject(dir)
+    end
+
 return lark
 `
@@ -0,0 +1,235 @@
+package task
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// NamespaceSep separates a namespace from a task name (e.g. "release:publish").
+const NamespaceSep = ":"
+
+// registry contains the tables in which tasks are recorded.
+type registry struct {
+	// anon maps anonymous task values to the namespace they were created in.
+	anon *lua.LTable
+	// named maps qualified task names to task values.
+	named *lua.LTable
+	// patterns maps qualified patterns to pattern records.
+	patterns *lua.LTable
+	// namespaces maps namespace names to the environment in which their
+	// anonymous tasks are stored.
+	namespaces *lua.LTable
+	// current is the namespace in which new tasks are created.
+	current string
+}
+
+// env returns the table containing anonymous tasks in namespace ns.
+func (r *registry) env(l *lua.LState, ns string) *lua.LTable {
+	if ns != "" {
+		env, ok := r.namespaces.RawGetString(ns).(*lua.LTable)
+		if ok {
+			return env
+		}
+	}
+	return l.Get(lua.GlobalsIndex).(*lua.LTable)
+}
+
+// names returns the names of all namespaces in sorted order.
+func (r *registry) names() []string {
+	var names []string
+	r.namespaces.ForEach(func(k, _ lua.LValue) {
+		names = append(names, k.String())
+	})
+	sort.Strings(names)
+	return names
+}
+
+// split separates a qualified task name into a known namespace and a task
+// name.  If name is not qualified by a known namespace the returned namespace
+// is empty.
+func (r *registry) split(name string) (ns, short string) {
+	i := strings.LastIndex(name, NamespaceSep)
+	if i <= 0 {
+		return "", name
+	}
+	if r.namespaces.RawGetString(name[:i]) == lua.LNil {
+		return "", name
+	}
+	return name[:i], name[i+len(NamespaceSep):]
+}
+
+func qualify(ns, name string) string {
+	if ns == "" {
+		return name
+	}
+	return ns + NamespaceSep + name
+}
+
+// match is the result of a task lookup.
+type match struct {
+	fn       lua.LValue
+	name     string
+	pattern  lua.LValue
+	captures *lua.LTable
+}
+
+func (m *match) push(l *lua.LState) int {
+	l.Push(m.fn)
+	l.Push(lua.LString(m.name))
+	if m.pattern == nil {
+		return 2
+	}
+	l.Push(m.pattern)
+	l.Push(m.captures)
+	return 4
+}
+
+// lookup finds a task named name in namespace ns.
+func (r *registry) lookup(l *lua.LState, ns, name string) *match {
+	qname := qualify(ns, name)
+	val := l.GetField(r.named, qname)
+	if val != lua.LNil {
+		return &match{fn: val, name: qname}
+	}
+
+	val = r.env(l, ns).RawGetString(name)
+	if val != lua.LNil {
+		taskns, ok := l.GetTable(r.anon, val).(lua.LString)
+		if ok && string(taskns) == ns {
+			return &match{fn: val, name: qname}
+		}
+	}
+
+	for _, rec := range r.patternRecords(l, ns) {
+		patt := l.GetField(rec, "pattern")
+		syntax := lua.LVAsString(l.GetField(rec, "syntax"))
+		captures := matchPattern(l, lua.LVAsString(patt), syntax, name)
+		if captures != nil {
+			return &match{
+				fn:       l.GetField(rec, "value"),
+				name:     qname,
+				pattern:  patt,
+				captures: captures,
+			}
+		}
+	}
+
+	return nil
+}
+
+// patternRecords returns the records of patterns defined in namespace ns in
+// the order they were defined.
+func (r *registry) patternRecords(l *lua.LState, ns string) []*lua.LTable {
+	var recs []*lua.LTable
+	l.ForEach(r.patterns, func(_, v lua.LValue) {
+		rec, ok := v.(*lua.LTable)
+		if !ok {
+			return
+		}
+		recns, _ := l.GetField(rec, "namespace").(lua.LString)
+		if string(recns) == ns {
+			recs = append(recs, rec)
+		}
+	})
+	sort.Sort(byIndex(recs))
+	return recs
+}
+
+type byIndex []*lua.LTable
+
+func (s byIndex) Len() int      { return len(s) }
+func (s byIndex) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byIndex) Less(i, j int) bool {
+	return lua.LVAsNumber(s[i].RawGetString("index")) < lua.LVAsNumber(s[j].RawGetString("index"))
+}
+
+// find locates the task with the given name.  A name qualified by a known
+// namespace is looked up in that namespace before the global namespace.  An
+// unqualified name that does not match a global task matches a named or
+// anonymous task in any single namespace.
+func (r *registry) find(l *lua.LState, name string) *match {
+	ns, short := r.split(name)
+	if ns != "" {
+		m := r.lookup(l, ns, short)
+		if m != nil {
+			return m
+		}
+	}
+	m := r.lookup(l, "", name)
+	if m != nil || ns != "" {
+		return m
+	}
+
+	var matches []*match
+	for _, ns := range r.names() {
+		m := r.lookup(l, ns, name)
+		if m != nil && m.pattern == nil {
+			matches = append(matches, m)
+		}
+	}
+	if len(matches) > 1 {
+		var names []string
+		for _, m := range matches {
+			names = append(names, m.name)
+		}
+		l.RaiseError("ambiguous task name %s: %s", name, strings.Join(names, ", "))
+	}
+	if len(matches) == 1 {
+		return matches[0]
+	}
+	return nil
+}
+
+// anonName returns the qualified name of the anonymous task val.
+func (r *registry) anonName(l *lua.LState, val lua.LValue) string {
+	ns, ok := l.GetTable(r.anon, val).(lua.LString)
+	if !ok {
+		return ""
+	}
+	var name string
+	l.ForEach(r.env(l, string(ns)), func(k, v lua.LValue) {
+		if name != "" || !l.Equal(v, val) {
+			return
+		}
+		if s, ok := k.(lua.LString); ok {
+			name = string(s)
+		}
+	})
+	if name == "" {
+		return ""
+	}
+	return qualify(string(ns), name)
+}
+
+func luaNamespace(r *registry) lua.LGFunction {
+	return func(l *lua.LState) int {
+		prev := r.current
+		name := l.OptString(1, "")
+		env := l.OptTable(2, nil)
+		if strings.HasPrefix(name, NamespaceSep) || strings.HasSuffix(name, NamespaceSep) {
+			l.ArgError(1, fmt.Sprintf("invalid namespace: %q", name))
+		}
+		l.SetTop(0)
+
+		if name != "" {
+			if env == nil {
+				env, _ = r.namespaces.RawGetString(name).(*lua.LTable)
+			}
+			if env == nil {
+				env = r.env(l, prev)
+			}
+			r.namespaces.RawSetString(name, env)
+		}
+		r.current = name
+
+		if prev == "" {
+			l.Push(lua.LNil)
+		} else {
+			l.Push(lua.LString(prev))
+		}
+		return 1
+	}
+}
@@ -0,0 +1,64 @@
+package task
+
+import (
+	"github.com/yuin/gopher-lua"
+)
+
+// stackKey is the registry key holding the names of the tasks running in a
+// lua.LState.
+const stackKey = "lark.task.stack"
+
+// Stack returns the names of the tasks running in l, outermost first.
+func Stack(l *lua.LState) []string {
+	reg := l.Get(lua.RegistryIndex).(*lua.LTable)
+	stack, ok := reg.RawGetString(stackKey).(*lua.LTable)
+	if !ok {
+		return nil
+	}
+	names := make([]string, stack.Len())
+	for i := range names {
+		names[i] = lua.LVAsString(stack.RawGetInt(i + 1))
+	}
+	return names
+}
+
+// pushStack pushes name onto the task stack of l and returns a function that
+// restores the stack.  The returned function is safe to defer because lua
+// errors unwind the Go stack.
+func pushStack(l *lua.LState, name string) func() {
+	reg := l.Get(lua.RegistryIndex).(*lua.LTable)
+	stack, ok := reg.RawGetString(stackKey).(*lua.LTable)
+	if !ok {
+		stack = l.NewTable()
+		reg.RawSetString(stackKey, stack)
+	}
+	n := stack.Len()
+	stack.RawSetInt(n+1, lua.LString(name))
+	return func() {
+		for i := stack.Len(); i > n; i-- {
+			stack.RawSetInt(i, lua.LNil)
+		}
+	}
+}
+
+// cleanupKey is the registry key holding the number of task hooks running in
+// a lua.LState that are cleaning up after a task.
+const cleanupKey = "lark.task.cleanup"
+
+// Cleanup returns true if l is running the on_failure, project failure, or
+// always hooks of a task.  Commands executed by these hooks are allowed to
+// run after an interrupt.
+func Cleanup(l *lua.LState) bool {
+	reg := l.Get(lua.RegistryIndex).(*lua.LTable)
+	n, _ := reg.RawGetString(cleanupKey).(lua.LNumber)
+	return n > 0
+}
+
+// luaCleanup adds its argument to the number of cleanup hooks running in l.
+func luaCleanup(l *lua.LState) int {
+	delta := l.CheckInt(1)
+	reg := l.Get(lua.RegistryIndex).(*lua.LTable)
+	n, _ := reg.RawGetString(cleanupKey).(lua.LNumber)
+	reg.RawSetString(cleanupKey, n+lua.LNumber(delta))
+	return 0
+}
@@ -1,9 +1,14 @@
 package task
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/bmatsuo/lark/gluamodule"
 	"github.com/bmatsuo/lark/lib/decorator"
 	"github.com/bmatsuo/lark/lib/doc"
+	"github.com/bmatsuo/lark/lib/regexp"
 	"github.com/yuin/gopher-lua"
 )
 
@@ -34,6 +39,20 @@ func Loader(l *lua.LState) int {
 			`default
 				string -- The task to perform when lark.run() is given no arguments.
 				`,
+			`file_namespaces
+				boolean -- When set to true in lark.lua the tasks defined in
+				each file of the lark_tasks/ directory are created in a
+				namespace named after the file.  Each file also has its own
+				global variables.  Files in subdirectories of lark_tasks/
+				have namespaces like "ci:build".
+				`,
+			`dir_namespaces
+				boolean -- When set to true in lark.lua the tasks defined in
+				files under a subdirectory of lark_tasks/ are created in a
+				namespace named after the subdirectory.  Files in the same
+				subdirectory share global variables.  Ignored if
+				file_namespaces is true.
+				`,
 		},
 	})
 
@@ -44,6 +63,15 @@ func Loader(l *lua.LState) int {
 	anonTasks := weakTable(l, setmt, "k")
 	namedTasks := weakTable(l, setmt, "kv")
 	patterns := weakTable(l, setmt, "k")
+	namespaces := l.NewTable()
+	tasks := &registry{
+		anon:       anonTasks,
+		named:      namedTasks,
+		patterns:   patterns,
+		namespaces: namespaces,
+	}
+	hooks := weakTable(l, setmt, "k")
+	failureHooks := l.NewTable()
 
 	l.Push(l.GetGlobal("require"))
 	l.Push(lua.LString("decorator"))
@@ -59,7 +87,7 @@ func Loader(l *lua.LState) int {
 	l.Pop(1)
 
 	nameFunc := l.NewClosure(
-		luaName(decorator, namedTasks, mod),
+		luaName(decorator, tasks, mod),
 		decorator, namedTasks, mod,
 	)
 	l.Push(decorator)
@@ -88,7 +116,7 @@ func Loader(l *lua.LState) int {
 	})
 
 	patternFunc := l.NewClosure(
-		luaPattern(setmt, decorator, patterns),
+		luaPattern(setmt, decorator, tasks),
 		setmt, decorator, patterns,
 	)
 	l.Push(decorator)
@@ -97,19 +125,28 @@ func Loader(l *lua.LState) int {
 	pattern := l.Get(-1)
 	l.Pop(1)
 	doc.Go(l, pattern, &doc.Docs{
-		Sig: "patt => fn => fn",
+		Sig: "(patt, [opt]) => fn => fn",
 		Desc: `
 		Returns a decorator that associates the given patten with a function.
+		Strings captured by the pattern are available to the task function
+		through get_captures().
 		`,
 		Params: []string{
-			"patt  string -- A regular expression to match against task names",
+			"patt  string -- A Lua pattern to match against task names",
+			`opt   (optional) table
+			-- Pattern options.  The array opt.examples may contain task names
+			matching patt which are displayed by dump().  If opt.syntax is
+			"re2" patt is a regular expression with the syntax of the regexp
+			module, and named groups are also available as fields of the
+			task's captures.
+			`,
 			"fn    function -- A task function which may take a context argument",
 		},
 	})
 
 	createFunc := l.NewClosure(
-		luaCreate(anonTasks, mod),
-		anonTasks, mod,
+		luaCreate(tasks, hooks, mod),
+		anonTasks, hooks, mod,
 	)
 	l.Push(decorator)
 	l.Push(createFunc)
@@ -117,7 +154,7 @@ func Loader(l *lua.LState) int {
 	create := l.Get(-1)
 	l.Pop(1)
 	doc.Go(l, create, &doc.Docs{
-		Sig: "fn => fn",
+		Sig: "(fn, [hooks]) => fn",
 		Desc: `
 		A decorator that creates an anonymous task from a function.
 
@@ -131,22 +168,116 @@ func Loader(l *lua.LState) int {
 		`,
 		Params: []string{
 			"fn  function -- A task function",
+			`hooks (optional) table
+			-- Lifecycle hooks for the task.  See hooks() for more information.
+			`,
+		},
+	})
+
+	hooksFunc := l.NewClosure(
+		luaHooks(decorator, hooks),
+		decorator, hooks,
+	)
+	doc.Go(l, hooksFunc, &doc.Docs{
+		Sig: "hooks => fn => fn",
+		Desc: `
+		Return a decorator that attaches lifecycle hooks to a task function.
+		Hooks are called with the task context.  The on_failure and always
+		hooks receive the task error as a second argument.
+
+			> db = task.hooks{always=stop_db} .. task .. function()
+			>>     lark.start{'postgres', group='db'}
+			>>     lark.exec('./integration_test')
+			>> end
+
+		The always hook is called even if the task (or another hook) raises an
+		error, including when an interrupted run causes commands to fail.
+		Commands executed by the on_failure and always hooks run even after
+		an interrupt.
+		When the task fails the error it raised is re-raised with its
+		traceback, and the errors of any failing on_failure, project failure,
+		or always hooks are appended to the message.
+		`,
+		Params: []string{
+			`hooks.before (optional) function
+			-- Called before the task function.  An error prevents the task
+			from running.
+			`,
+			`hooks.after (optional) function
+			-- Called after the task function returns successfully.
+			`,
+			`hooks.on_failure (optional) function
+			-- Called with the task error if the task or one of its hooks
+			fails.
+			`,
+			`hooks.always (optional) function
+			-- Called last, whether or not the task succeeded.  The error
+			argument is nil when the task succeeded.
+			`,
+		},
+	})
+
+	onFailure := l.NewClosure(luaOnFailure(failureHooks), failureHooks)
+	doc.Go(l, onFailure, &doc.Docs{
+		Sig: "fn => ()",
+		Desc: `
+		Register a function that is called whenever any task fails.  Project
+		failure hooks are called after the failing task's own on_failure hook.
+		`,
+		Params: []string{
+			`fn function
+			-- A function taking the task context and the task error.
+			`,
+		},
+	})
+
+	namespace := l.NewClosure(luaNamespace(tasks), namespaces)
+	doc.Go(l, namespace, &doc.Docs{
+		Sig: "(name, [env]) => prev",
+		Desc: `
+		Create subsequent tasks in the named namespace.  A task in a namespace
+		is run using its qualified name (e.g. "release:publish").  If no task
+		in the global namespace matches an unqualified name the name will
+		match a task in any single namespace.
+
+			> task.namespace('db')
+			> migrate = task .. function() lark.exec('./migrate') end
+			> task.namespace(nil)
+			> task.run('db:migrate')
+
+		The namespace is reset after each project file is loaded.
+		`,
+		Params: []string{
+			`name string
+			-- The namespace name.  If nil tasks are created in the global
+			namespace.
+			`,
+			`env (optional) table
+			-- The table containing anonymous tasks (global variables) of the
+			namespace.  By default the environment of the current namespace
+			is used.
+			`,
+			`prev string
+			-- The previous namespace, or nil if tasks were being created in the
+			global namespace.
+			`,
 		},
 	})
 
 	find := l.NewClosure(
-		luaFind(anonTasks, namedTasks, patterns, mod),
-		anonTasks, namedTasks, patterns, mod,
+		luaFind(tasks, mod),
+		anonTasks, namedTasks, patterns, namespaces, mod,
 	)
 	doc.Go(l, find, &doc.Docs{
-		Sig: "name => (fn, match, pattern)",
+		Sig: "name => (fn, match, pattern, captures)",
 		Desc: `
 		Return the task matching the given name.  If no name is given the
 		default task is returned.
 
 		Find first looks for named tasks with the given name.  If no explicitly
 		named task matches an anonymous task stored in a global variable of the
-		same name will be used.
+		same name will be used.  A name qualified by a namespace (see
+		namespace()) is looked up in that namespace first.
 
 		When no named task matches a given name it will be tested against
 		pattern matching tasks.  The first pattern task to match the name will
@@ -168,12 +299,15 @@ func Loader(l *lua.LState) int {
 			-- The pattern which matched the task name, if a name was given and
 			no anonymous or explicitly named task could be matched.
 			`,
+			`captures array
+			-- The strings captured by pattern when it matched the task name.
+			`,
 		},
 	})
 
 	dump := l.NewClosure(
-		luaDump(anonTasks, namedTasks, patterns, mod),
-		anonTasks, namedTasks, patterns, mod,
+		luaDump(tasks, mod),
+		anonTasks, namedTasks, patterns, namespaces, mod,
 	)
 	doc.Go(l, dump, &doc.Docs{
 		Sig: "() => ()",
@@ -185,12 +319,35 @@ func Loader(l *lua.LState) int {
 	})
 
 	l.SetField(mod, "create", create)
+	l.SetField(mod, "hooks", hooksFunc)
+	l.SetField(mod, "on_failure", onFailure)
 	l.SetField(mod, "name", name)
 	l.SetField(mod, "pattern", pattern)
+	l.SetField(mod, "namespace", namespace)
+	list := l.NewClosure(
+		luaList(tasks, mod),
+		anonTasks, namedTasks, patterns, namespaces, mod,
+	)
+	doc.Go(l, list, &doc.Docs{
+		Sig: "() => tasks",
+		Desc: `
+		Return an array describing all tasks in the order they are written by
+		dump().  Each element is a table with the fields kind ("named",
+		"anonymous", or "pattern"), name (a qualified name or pattern),
+		namespace, default (true for the default task), and examples (for
+		patterns).  Like dump(), list() is computationally expensive.
+		`,
+	})
+
 	l.SetField(mod, "find", find)
 	l.SetField(mod, "dump", dump)
+	l.SetField(mod, "list", list)
 
-	run := l.NewClosure(luaRun(find), find)
+	call := loadCallTask(l)
+	run := l.NewClosure(
+		luaRun(find, call, hooks, failureHooks),
+		find, call, hooks, failureHooks,
+	)
 	l.SetField(mod, "run", run)
 	doc.Go(l, run, &doc.Docs{
 		Sig: "name => ()",
@@ -242,6 +399,31 @@ func Loader(l *lua.LState) int {
 		},
 	})
 
+	getCaptures := l.NewClosure(luaGetCaptures)
+	l.SetField(mod, "get_captures", getCaptures)
+	doc.Go(l, getCaptures, &doc.Docs{
+		Sig: "ctx => captures",
+		Desc: `
+		Retrieve the strings captured by the pattern that matched a (running)
+		task from the task's context.  If the task was not matched using a
+		pattern nil is returned.
+
+			> build_object = task.pattern[[^(.*)%.o$]] .. function(ctx)
+			>>     local c = task.get_captures(ctx)[1] .. '.c'
+			>>     lark.exec('gcc', '-c', c)
+			>> end
+		`,
+		Params: []string{
+			`context table
+			-- Task context received as the first argument to a task function.
+			`,
+			`captures array
+			-- The captures of the pattern that matched the task name passed
+			to task.run().  Position captures are numbers.
+			`,
+		},
+	})
+
 	getParam := l.NewClosure(luaGetParam)
 	l.SetField(mod, "get_param", getParam)
 	doc.Go(l, getParam, &doc.Docs{
@@ -285,166 +467,240 @@ func luaDecorator(l *lua.LState) int {
 	return l.GetTop()
 }
 
-func luaFind(anonTasks, namedTasks, patterns, mod *lua.LTable) lua.LGFunction {
+func luaFind(tasks *registry, mod *lua.LTable) lua.LGFunction {
 	return func(l *lua.LState) int {
 		var name string
 		if l.GetTop() > 0 {
 			name = l.CheckString(1)
 		} else {
-			var lname lua.LString
-			var ok bool
 			def := l.GetField(mod, "default")
-			lname, ok = def.(lua.LString)
-			if !ok {
-				l.ForEach(l.Get(lua.GlobalsIndex).(*lua.LTable), func(k, v lua.LValue) {
-					if !l.Equal(v, def) {
-						return
-					}
-					lname, ok = k.(lua.LString)
-					if !ok {
-						l.RaiseError("unexpected global index")
-					}
-				})
+			lname, ok := def.(lua.LString)
+			if ok {
+				name = string(lname)
+			} else if def != lua.LNil {
+				name = tasks.anonName(l, def)
 			}
-			name = string(lname)
 			if name == "" {
 				l.RaiseError("cannot determine name of task")
 			}
 		}
 
-		val := l.GetField(namedTasks, name)
-		if val != lua.LNil {
-			l.Push(val)
-			l.Push(lua.LString(name))
-			return 2
+		m := tasks.find(l, name)
+		if m == nil {
+			return 0
 		}
+		return m.push(l)
+	}
+}
 
-		val = l.GetGlobal(name)
-		if val != lua.LNil {
-			isTask, ok := l.GetTable(anonTasks, val).(lua.LBool)
-			if ok && bool(isTask) {
-				l.Push(val)
-				l.Push(lua.LString(name))
-				return 2
-			}
+// entry describes a task for dump() and list().
+type entry struct {
+	kind      string // "named", "anonymous", or "pattern"
+	name      string // the qualified name or pattern
+	namespace string
+	isDefault bool
+	examples  []string
+}
+
+// listTasks returns all tasks grouped by namespace, global tasks first.
+// Within a namespace named tasks are followed by anonymous tasks, each sorted
+// by name, and then patterns in the order they were defined.
+func listTasks(l *lua.LState, tasks *registry, mod *lua.LTable) []*entry {
+	def := l.GetField(mod, "default")
+	if def != lua.LNil {
+		if _, ok := def.(lua.LString); !ok {
+			def = lua.LString(tasks.anonName(l, def))
 		}
+	}
 
-		allPatterns := l.NewTable()
-		l.ForEach(patterns, func(k, v lua.LValue) {
-			allPatterns.Append(v)
-		})
-		l.Push(l.GetField(l.GetGlobal("table"), "sort"))
-		l.Push(allPatterns)
-		l.Push(l.NewClosure(func(l *lua.LState) int {
-			t1 := l.CheckTable(1)
-			t2 := l.CheckTable(2)
-			i1 := l.GetField(t1, "index")
-			i2 := l.GetField(t2, "index")
-			l.SetTop(0)
-			l.Push(lua.LBool(l.LessThan(i1, i2)))
-			return 1
-		}))
-		var found lua.LValue
-		find := l.GetField(l.GetGlobal("string"), "find")
-		l.ForEach(allPatterns, func(k, v lua.LValue) {
-			patt := l.GetField(v, "pattern")
-			l.Push(find)
-			l.Push(lua.LString(name))
-			l.Push(patt)
-			l.Call(2, 1)
-			val := l.Get(-1)
-			l.Pop(1)
-			if val != lua.LNil && found == nil {
-				found = patt
-			}
-		})
-		if found != nil {
-			rec := l.GetTable(patterns, found)
-			l.Push(l.GetField(rec, "value"))
-			l.Push(lua.LString(name))
-			l.Push(found)
-			return 3
+	set := map[string]bool{}
+	named := map[string][]string{}
+	l.ForEach(tasks.named, func(k, v lua.LValue) {
+		name := k.String()
+		ns, _ := tasks.split(name)
+		named[ns] = append(named[ns], name)
+		set[name] = true
+	})
+	anon := map[string][]string{}
+	l.ForEach(tasks.anon, func(val, _ lua.LValue) {
+		name := tasks.anonName(l, val)
+		if name == "" || set[name] {
+			return
 		}
+		ns, _ := tasks.split(name)
+		anon[ns] = append(anon[ns], name)
+	})
 
-		return 0
+	var entries []*entry
+	for _, ns := range append([]string{""}, tasks.names()...) {
+		sort.Strings(named[ns])
+		for _, name := range named[ns] {
+			isDefault := l.Equal(def, lua.LString(name))
+			entries = append(entries, &entry{"named", name, ns, isDefault, nil})
+		}
+		sort.Strings(anon[ns])
+		for _, name := range anon[ns] {
+			isDefault := l.Equal(def, lua.LString(name))
+			entries = append(entries, &entry{"anonymous", name, ns, isDefault, nil})
+		}
+		for _, rec := range tasks.patternRecords(l, ns) {
+			patt := qualify(ns, l.GetField(rec, "pattern").String())
+			var names []string
+			examples, ok := l.GetField(rec, "examples").(*lua.LTable)
+			if ok {
+				l.ForEach(examples, func(_, name lua.LValue) {
+					names = append(names, qualify(ns, name.String()))
+				})
+			}
+			entries = append(entries, &entry{"pattern", patt, ns, false, names})
+		}
 	}
+	return entries
 }
 
-func luaDump(anonTasks, namedTasks, patterns, mod *lua.LTable) lua.LGFunction {
+func luaDump(tasks *registry, mod *lua.LTable) lua.LGFunction {
 	return func(l *lua.LState) int {
 		print := l.GetGlobal("print")
-		def := l.GetField(mod, "default")
-
-		set := l.NewTable()
-		l.ForEach(namedTasks, func(k, v lua.LValue) {
+		line := func(kind, name, suffix string) {
 			l.Push(print)
-			l.Push(lua.LString("="))
-			l.Push(k)
-			if l.Equal(def, k) {
-				l.Push(lua.LString(" (default)"))
+			l.Push(lua.LString(kind))
+			l.Push(lua.LString(name))
+			if suffix != "" {
+				l.Push(lua.LString(suffix))
 				l.Call(3, 0)
 			} else {
 				l.Call(2, 0)
 			}
+		}
+		marks := map[string]string{
+			"named":     "=",
+			"anonymous": "-",
+			"pattern":   "~",
+		}
 
-			l.SetTable(set, k, lua.LBool(true))
-		})
-		l.ForEach(anonTasks, func(val, _ lua.LValue) {
-			l.ForEach(l.Get(lua.GlobalsIndex).(*lua.LTable), func(k, v lua.LValue) {
-				if !l.Equal(v, val) {
-					return
-				}
-				lname, ok := k.(lua.LString)
-				if !ok {
-					return
-				}
-				if l.GetField(set, string(lname)) == lua.LNil {
-					l.Push(print)
-					l.Push(lua.LString("-"))
-					l.Push(lname)
-					if l.Equal(def, v) {
-						l.Push(lua.LString(" (default)"))
-						l.Call(3, 0)
-					} else {
-						l.Call(2, 0)
-					}
-				}
-			})
-		})
-		l.ForEach(patterns, func(k, v lua.LValue) {
-			l.Push(print)
-			l.Push(lua.LString("~"))
-			l.Push(l.GetField(v, "pattern"))
-			l.Call(2, 0)
-		})
+		ns := ""
+		for _, e := range listTasks(l, tasks, mod) {
+			if e.namespace != ns {
+				ns = e.namespace
+				l.Push(print)
+				l.Push(lua.LString("\n[" + ns + "]"))
+				l.Call(1, 0)
+			}
+			suffix := ""
+			if e.isDefault {
+				suffix = " (default)"
+			}
+			if len(e.examples) > 0 {
+				suffix = fmt.Sprintf(" (e.g. %s)", strings.Join(e.examples, ", "))
+			}
+			line(marks[e.kind], e.name, suffix)
+		}
 
 		return 0
 	}
 }
 
-func luaCreate(t lua.LValue, mod *lua.LTable) lua.LGFunction {
+func luaList(tasks *registry, mod *lua.LTable) lua.LGFunction {
+	return func(l *lua.LState) int {
+		list := l.NewTable()
+		for _, e := range listTasks(l, tasks, mod) {
+			t := l.NewTable()
+			l.SetField(t, "kind", lua.LString(e.kind))
+			l.SetField(t, "name", lua.LString(e.name))
+			if e.namespace != "" {
+				l.SetField(t, "namespace", lua.LString(e.namespace))
+			}
+			if e.isDefault {
+				l.SetField(t, "default", lua.LTrue)
+			}
+			if e.examples != nil {
+				examples := l.NewTable()
+				for _, name := range e.examples {
+					examples.Append(lua.LString(name))
+				}
+				l.SetField(t, "examples", examples)
+			}
+			list.Append(t)
+		}
+		l.Push(list)
+		return 1
+	}
+}
+
+func luaCreate(tasks *registry, hooks lua.LValue, mod *lua.LTable) lua.LGFunction {
 	return func(l *lua.LState) int {
 		val := l.CheckAny(1)
+		if l.GetTop() > 1 && l.Get(2) != lua.LNil {
+			setHooks(l, hooks, val, l.CheckTable(2))
+		}
+		l.SetTop(1)
 		if l.GetField(mod, "default") == lua.LNil {
 			l.SetField(mod, "default", val)
 		}
-		l.SetTable(t, val, lua.LBool(true))
+		l.SetTable(tasks.anon, val, lua.LString(tasks.current))
 		return 1
 	}
 }
 
-func luaName(decorator *lua.LFunction, t lua.LValue, mod *lua.LTable) lua.LGFunction {
+// hookNames contains the valid keys of a task hooks table.
+var hookNames = map[string]bool{
+	"before":     true,
+	"after":      true,
+	"on_failure": true,
+	"always":     true,
+}
+
+func setHooks(l *lua.LState, hooks, val lua.LValue, h *lua.LTable) {
+	l.ForEach(h, func(k, v lua.LValue) {
+		name, ok := k.(lua.LString)
+		if !ok || !hookNames[string(name)] {
+			l.RaiseError("invalid task hook: %v", k)
+		}
+		if _, ok := v.(*lua.LFunction); !ok {
+			l.RaiseError("task hook %s is not a function: %s", name, v.Type())
+		}
+	})
+	l.SetTable(hooks, val, h)
+}
+
+func luaHooks(decorator *lua.LFunction, hooks lua.LValue) lua.LGFunction {
+	return func(l *lua.LState) int {
+		h := l.CheckTable(1)
+
+		fn := l.NewClosure(func(l *lua.LState) int {
+			val := l.CheckAny(1)
+			setHooks(l, hooks, val, h)
+			return 1
+		}, hooks, h)
+
+		l.Push(decorator)
+		l.Push(fn)
+		l.Call(1, 1)
+		return 1
+	}
+}
+
+func luaOnFailure(failureHooks *lua.LTable) lua.LGFunction {
+	return func(l *lua.LState) int {
+		fn := l.CheckFunction(1)
+		failureHooks.Append(fn)
+		return 0
+	}
+}
+
+func luaName(decorator *lua.LFunction, tasks *registry, mod *lua.LTable) lua.LGFunction {
 	return func(l *lua.LState) int {
 		name := l.CheckString(1)
 
 		fn := l.NewClosure(func(l *lua.LState) int {
 			val := l.CheckAny(1)
+			qname := qualify(tasks.current, name)
 			if l.GetField(mod, "default") == lua.LNil {
-				l.SetField(mod, "default", lua.LString(name))
+				l.SetField(mod, "default", lua.LString(qname))
 			}
-			l.SetField(t, name, val)
+			l.SetField(tasks.named, qname, val)
 			return 1
-		}, t, mod)
+		}, tasks.named, mod)
 
 		l.Push(decorator)
 		l.Push(fn)
@@ -453,10 +709,17 @@ func luaName(decorator *lua.LFunction, t lua.LValue, mod *lua.LTable) lua.LGFunc
 	}
 }
 
-func luaPattern(setmt, decorator *lua.LFunction, t lua.LValue) lua.LGFunction {
+func luaPattern(setmt, decorator *lua.LFunction, tasks *registry) lua.LGFunction {
 	var numPatt int64
 	return func(l *lua.LState) int {
 		patt := l.CheckString(1)
+		examples := lua.LValue(lua.LNil)
+		syntax := syntaxLua
+		if opt := l.OptTable(2, nil); opt != nil {
+			syntax = checkSyntax(l, patt, l.GetField(opt, "syntax"))
+			examples = l.GetField(opt, "examples")
+			checkExamples(l, patt, syntax, examples)
+		}
 
 		fn := l.NewClosure(func(l *lua.LState) int {
 			val := l.CheckAny(1)
@@ -464,8 +727,11 @@ func luaPattern(setmt, decorator *lua.LFunction, t lua.LValue) lua.LGFunction {
 			numPatt++
 			l.SetField(rec, "index", lua.LNumber(numPatt))
 			l.SetField(rec, "pattern", lua.LString(patt))
+			l.SetField(rec, "syntax", lua.LString(syntax))
+			l.SetField(rec, "namespace", lua.LString(tasks.current))
+			l.SetField(rec, "examples", examples)
 			l.SetField(rec, "value", val)
-			l.SetField(t, patt, rec)
+			l.SetField(tasks.patterns, qualify(tasks.current, patt), rec)
 			mt := l.NewTable()
 			l.SetField(mt, "__mode", lua.LString("v"))
 			l.Push(setmt)
@@ -473,7 +739,7 @@ func luaPattern(setmt, decorator *lua.LFunction, t lua.LValue) lua.LGFunction {
 			l.Push(mt)
 			l.Call(2, 1)
 			return 1
-		}, t)
+		}, tasks.patterns)
 
 		l.Push(decorator)
 		l.Push(fn)
@@ -482,7 +748,78 @@ func luaPattern(setmt, decorator *lua.LFunction, t lua.LValue) lua.LGFunction {
 	}
 }
 
-func luaRun(find *lua.LFunction) lua.LGFunction {
+// Pattern syntaxes.
+const (
+	syntaxLua = "lua"
+	syntaxRE2 = "re2"
+)
+
+// checkSyntax raises an error if syntax is not a known pattern syntax or if
+// patt is not a valid RE2 expression.
+func checkSyntax(l *lua.LState, patt string, syntax lua.LValue) string {
+	switch syntax {
+	case lua.LNil, lua.LString(syntaxLua):
+		return syntaxLua
+	case lua.LString(syntaxRE2):
+		_, err := regexp.Compile(patt)
+		if err != nil {
+			l.ArgError(1, err.Error())
+		}
+		return syntaxRE2
+	}
+	l.ArgError(2, fmt.Sprintf("unknown pattern syntax: %s", syntax))
+	return ""
+}
+
+// checkExamples raises an error if examples is not an array of names matching
+// patt.
+func checkExamples(l *lua.LState, patt, syntax string, examples lua.LValue) {
+	if examples == lua.LNil {
+		return
+	}
+	t, ok := examples.(*lua.LTable)
+	if !ok {
+		l.ArgError(2, fmt.Sprintf("named value 'examples' is not a table: %s", examples.Type()))
+	}
+	l.ForEach(t, func(_, v lua.LValue) {
+		name, ok := v.(lua.LString)
+		if !ok {
+			l.ArgError(2, fmt.Sprintf("example is not a string: %s", v.Type()))
+		}
+		if matchPattern(l, patt, syntax, string(name)) == nil {
+			l.ArgError(2, fmt.Sprintf("example does not match pattern: %q", name))
+		}
+	})
+}
+
+// matchPattern matches name against patt and returns the captured strings,
+// or nil if name does not match.
+func matchPattern(l *lua.LState, patt, syntax, name string) *lua.LTable {
+	if syntax == syntaxRE2 {
+		re, err := regexp.Compile(patt)
+		if err != nil {
+			l.RaiseError("%s", err.Error())
+		}
+		return regexp.Captures(l, re, name)
+	}
+
+	top := l.GetTop()
+	defer l.SetTop(top)
+	l.Push(l.GetField(l.GetGlobal("string"), "find"))
+	l.Push(lua.LString(name))
+	l.Push(lua.LString(patt))
+	l.Call(2, lua.MultRet)
+	if l.Get(top+1) == lua.LNil {
+		return nil
+	}
+	captures := l.NewTable()
+	for i := top + 3; i <= l.GetTop(); i++ {
+		captures.Append(l.Get(i))
+	}
+	return captures
+}
+
+func luaRun(find, call *lua.LFunction, hooks, failureHooks *lua.LTable) lua.LGFunction {
 	return func(l *lua.LState) int {
 		var name string
 		lname, ok := l.Get(1).(lua.LString)
@@ -500,36 +837,139 @@ func luaRun(find *lua.LFunction) lua.LGFunction {
 		if name != "" {
 			l.Push(find)
 			l.Push(lua.LString(name))
-			l.Call(1, 3)
+			l.Call(1, 4)
 			if l.Get(1) == lua.LNil {
 				l.RaiseError("no task matching name: %s", name)
 			}
 		} else {
 			var ok bool
 			l.Push(find)
-			l.Call(0, 2)
+			l.Call(0, 4)
 			lname, ok = l.Get(2).(lua.LString)
 			if !ok {
 				l.RaiseError("task name is not a string")
 			}
 			name = string(lname)
 		}
-		patt := lua.LValue(lua.LNil)
-		if l.GetTop() > 2 {
-			patt = l.Get(3)
-		}
+		patt := l.Get(3)
+		captures := l.Get(4)
 		l.SetTop(1)
 
 		ctx := l.NewTable()
 		l.SetField(ctx, "name", lua.LString(name))
 		l.SetField(ctx, "pattern", patt)
+		l.SetField(ctx, "captures", captures)
 		l.SetField(ctx, "params", params)
-		l.Push(ctx)
-		l.Call(1, 0)
+
+		defer pushStack(l, name)()
+
+		fn := l.Get(1)
+		h := l.GetTable(hooks, fn)
+		if h == lua.LNil && failureHooks.Len() == 0 {
+			l.Push(ctx)
+			l.Call(1, 0)
+			return 0
+		}
+		callTask(l, call, fn, ctx, h, failureHooks)
 		return 0
 	}
 }
 
+// callTaskLua is a Lua chunk returning a function that calls a task and its
+// hooks.  The hooks are called from Lua using xpcall because gopher-lua does
+// not restore the call stack when LState.PCall is used from Go, which breaks
+// tracebacks of errors raised afterwards.  The traceback of the first error is
+// kept, and errors raised by failure hooks are appended to its message.  The
+// chunk takes luaCleanup, which marks the hooks that run after a task so that
+// their commands can run after an interrupt.
+const callTaskLua = `
+local cleanup = ...
+return function(fn, ctx, h, failure_hooks)
+	h = h or {}
+	local function traceback(err)
+		return {err, debug.traceback('', 2)}
+	end
+	local function call(f, ...)
+		if not f then
+			return true
+		end
+		local args = {...}
+		local n = select('#', ...)
+		local ok, err = xpcall(function() return f(unpack(args, 1, n)) end, traceback)
+		if ok then
+			return true
+		end
+		return false, err[1], err[2]
+	end
+	local function hook(f, err)
+		cleanup(1)
+		local ok, hook_err, hook_trace = call(f, ctx, err)
+		cleanup(-1)
+		return ok, hook_err, hook_trace
+	end
+	local hook_errs = {}
+	local function failure_hook(name, f, err)
+		local ok, hook_err = hook(f, err)
+		if not ok then
+			table.insert(hook_errs, name .. ' hook: ' .. tostring(hook_err))
+		end
+	end
+	local ok, err, trace = call(h.before, ctx)
+	if ok then
+		ok, err, trace = call(fn, ctx)
+	end
+	if ok then
+		ok, err, trace = call(h.after, ctx)
+	end
+	if not ok then
+		failure_hook('on_failure', h.on_failure, err)
+		for _, f in ipairs(failure_hooks) do
+			failure_hook('failure', f, err)
+		end
+		failure_hook('always', h.always, err)
+	else
+		ok, err, trace = hook(h.always)
+	end
+	if ok then
+		return
+	end
+	if type(err) ~= 'string' and #hook_errs == 0 then
+		error(err, 0)
+	end
+	table.insert(hook_errs, 1, tostring(err))
+	error(table.concat(hook_errs, '\n') .. '\n' .. trace, 0)
+end
+`
+
+func loadCallTask(l *lua.LState) *lua.LFunction {
+	chunk, err := l.LoadString(callTaskLua)
+	if err != nil {
+		l.RaiseError("%s", err.Error())
+	}
+	l.Push(chunk)
+	l.Push(l.NewFunction(luaCleanup))
+	l.Call(1, 1)
+	call, ok := l.Get(-1).(*lua.LFunction)
+	if !ok {
+		l.RaiseError("unexpected type for callTaskLua")
+	}
+	l.Pop(1)
+	return call
+}
+
+// callTask calls fn with ctx and calls any hooks registered for fn using
+// call, the function returned by callTaskLua.  If the task fails the original
+// error is raised with its traceback after all hooks have been called,
+// followed by the errors of any failing failure hooks.
+func callTask(l *lua.LState, call *lua.LFunction, fn, ctx, h lua.LValue, failureHooks *lua.LTable) {
+	l.Push(call)
+	l.Push(fn)
+	l.Push(ctx)
+	l.Push(h)
+	l.Push(failureHooks)
+	l.Call(4, 0)
+}
+
 func luaGetName(l *lua.LState) int {
 	if l.GetTop() == 0 {
 		return 0
@@ -548,6 +988,15 @@ func luaGetPattern(l *lua.LState) int {
 	return 1
 }
 
+func luaGetCaptures(l *lua.LState) int {
+	if l.GetTop() == 0 {
+		return 0
+	}
+	ctx := l.CheckTable(1)
+	l.Replace(1, l.GetField(ctx, "captures"))
+	return 1
+}
+
 func luaGetParam(l *lua.LState) int {
 	ctx := l.CheckTable(1)
 	name := l.CheckString(2)
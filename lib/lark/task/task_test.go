@@ -1,9 +1,12 @@
 package task
 
 import (
+	"reflect"
 	"testing"
 
+	"github.com/bmatsuo/lark/gluamodule"
 	"github.com/bmatsuo/lark/gluatest"
+	"github.com/yuin/gopher-lua"
 )
 
 var luaTaskTest = &gluatest.File{
@@ -19,3 +22,36 @@ func BenchmarkRequireModule(b *testing.B) {
 	file := &gluatest.File{Module: Module}
 	file.BenchmarkRequireModule(b)
 }
+
+func TestStack(t *testing.T) {
+	l := lua.NewState()
+	defer l.Close()
+	gluamodule.Preload(l, gluamodule.Resolve(Module)...)
+
+	var stacks [][]string
+	l.SetGlobal("record", l.NewFunction(func(l *lua.LState) int {
+		stacks = append(stacks, Stack(l))
+		return 0
+	}))
+	err := l.DoString(`
+		local task = require('lark.task')
+		inner = task .. function() record() end
+		outer = task .. function() task.run('inner'); record() end
+		failing = task .. function() record(); error('failure') end
+		task.run('outer')
+		assert(not pcall(task.run, 'failing'))
+		record()
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := [][]string{
+		{"outer", "inner"},
+		{"outer"},
+		{"failing"},
+		{},
+	}
+	if !reflect.DeepEqual(stacks, expect) {
+		t.Errorf("stacks: %q (!= %q)", stacks, expect)
+	}
+}
@@ -88,3 +88,160 @@ function test_dump()
 	task.pattern(".*%.txt$")(function() print("PATT") end)
 	task.dump()
 end
+
+function test_list()
+	task.name("list_foo")(function() end)
+	task.pattern("list_.*%.txt$")(function() end)
+	local names = {}
+	local pattern
+	for _, t in ipairs(task.list()) do
+		names[t.name] = t
+		if t.kind == 'pattern' and t.name == 'list_.*%.txt$' then
+			pattern = t
+		end
+	end
+	assert(names.list_foo)
+	assert(names.list_foo.kind == 'named')
+	assert(pattern)
+end
+
+function test_hooks()
+	local calls = {}
+	local record = function(name)
+		return function(ctx, err)
+			table.insert(calls, name)
+			assert(task.get_name(ctx) == 'hooked')
+		end
+	end
+	hooked = task.create(function() table.insert(calls, 'task') end, {
+		before = record('before'),
+		after = record('after'),
+		on_failure = record('on_failure'),
+		always = record('always'),
+	})
+	task.run('hooked')
+	assert(table.concat(calls, ',') == 'before,task,after,always')
+	assert(not pcall(task.create, function() end, {bogus = print}))
+end
+
+function test_hooks_failure()
+	local failed = nil
+	local cleaned = false
+	local project_failed = nil
+	task.on_failure(function(ctx, err) project_failed = task.get_name(ctx) end)
+	hooked_failure =
+		task.hooks{
+			on_failure = function(ctx, err) failed = err end,
+			always = function(ctx, err) cleaned = err ~= nil end,
+		} ..
+		task ..
+		function() error('task error') end
+	local ok, err = pcall(task.run, 'hooked_failure')
+	assert(not ok)
+	assert(string.find(err, 'task error'))
+	assert(string.find(failed, 'task error'))
+	assert(cleaned)
+	assert(project_failed == 'hooked_failure')
+end
+
+function test_hooks_failure_errors()
+	hooked_hook_failure =
+		task.hooks{
+			on_failure = function(ctx, err) error('on_failure error') end,
+			always = function(ctx, err) error('always error') end,
+		} ..
+		task ..
+		function() error('task error') end
+	local ok, err = pcall(task.run, 'hooked_hook_failure')
+	assert(not ok)
+	assert(string.find(err, 'task error'))
+	assert(string.find(err, 'on_failure hook: [^\n]*on_failure error'))
+	assert(string.find(err, 'always hook: [^\n]*always error'))
+	assert(string.find(err, 'stack traceback'))
+
+	hooked_always_failure =
+		task.hooks{always = function(ctx, err) error('always error') end} ..
+		task ..
+		function() end
+	ok, err = pcall(task.run, 'hooked_always_failure')
+	assert(not ok)
+	assert(string.find(err, 'always error'))
+	assert(not string.find(err, 'always hook'))
+end
+
+function test_get_captures()
+	assert(task.get_captures() == nil)
+	assert(task.get_captures({}) == nil)
+	assert(task.get_captures({captures = {'x'}})[1] == 'x')
+end
+
+function test_run_captures()
+	local captures = nil
+	task.pattern[[^capture_(%w+)_(%w+)$]](function(ctx)
+		captures = task.get_captures(ctx)
+	end)
+	task.run('capture_foo_bar')
+	assert(captures)
+	assert(#captures == 2)
+	assert(captures[1] == 'foo')
+	assert(captures[2] == 'bar')
+end
+
+function test_pattern_examples()
+	task.pattern([[%.o$]], {examples = {'main.o'}})(function() end)
+	assert(not pcall(task.pattern, [[%.o$]], {examples = {'main.c'}}))
+	task.dump()
+end
+
+function test_pattern_re2()
+	local captures = nil
+	task.pattern([[^re2_(?P<os>linux|darwin)_(\d+)$]], {syntax = 're2'})(function(ctx)
+		captures = task.get_captures(ctx)
+	end)
+	assert(not pcall(task.run, 're2_windows_1'))
+	task.run('re2_darwin_64')
+	assert(captures)
+	assert(#captures == 2)
+	assert(captures[1] == 'darwin')
+	assert(captures[2] == '64')
+	assert(captures.os == 'darwin')
+
+	task.pattern([[\.o$]], {syntax = 're2', examples = {'main.o'}})(function() end)
+	assert(not pcall(task.pattern, [[\.o$]], {syntax = 're2', examples = {'main.c'}}))
+	assert(not pcall(task.pattern, [[(]], {syntax = 're2'}))
+	assert(not pcall(task.pattern, [[x]], {syntax = 'pcre'}))
+end
+
+function test_namespace()
+	local called = nil
+	assert(task.namespace('ns_test') == nil)
+	ns_task = task .. function() called = 'anon' end
+	task.name[[named]](function() called = 'named' end)
+	task.pattern[[^patt_(%w+)$]](function(ctx) called = task.get_captures(ctx)[1] end)
+	assert(task.namespace(nil) == 'ns_test')
+
+	task.run('ns_test:ns_task')
+	assert(called == 'anon')
+	task.run('ns_test:named')
+	assert(called == 'named')
+	task.run('ns_test:patt_foo')
+	assert(called == 'foo')
+	assert(not task.find('patt_foo'))
+
+	-- unqualified names match a task in a single namespace
+	task.run('named')
+	assert(called == 'named')
+	local _, name = task.find('named')
+	assert(name == 'ns_test:named')
+
+	task.namespace('ns_test2')
+	task.name[[named]](function() end)
+	task.namespace(nil)
+	assert(not pcall(task.find, 'named'))
+
+	-- global tasks have precedence over namespaced tasks
+	task.name[[named]](function() called = 'global' end)
+	task.run('named')
+	assert(called == 'global')
+	task.dump()
+end
@@ -5,26 +5,42 @@ package lib
 
 import (
 	"github.com/bmatsuo/lark/gluamodule"
+	"github.com/bmatsuo/lark/lib/archive"
 	"github.com/bmatsuo/lark/lib/decorator"
 	"github.com/bmatsuo/lark/lib/decorator/_intern"
 	"github.com/bmatsuo/lark/lib/doc"
+	"github.com/bmatsuo/lark/lib/fs"
 	"github.com/bmatsuo/lark/lib/fun"
+	"github.com/bmatsuo/lark/lib/hash"
+	"github.com/bmatsuo/lark/lib/json"
 	"github.com/bmatsuo/lark/lib/lark"
 	"github.com/bmatsuo/lark/lib/lark/core"
 	"github.com/bmatsuo/lark/lib/lark/task"
 	"github.com/bmatsuo/lark/lib/path"
+	"github.com/bmatsuo/lark/lib/regexp"
+	"github.com/bmatsuo/lark/lib/semver"
+	"github.com/bmatsuo/lark/lib/str"
+	"github.com/bmatsuo/lark/lib/template"
 )
 
 // Modules lists every module in the library.
 var Modules = []gluamodule.Module{
+	archive.Module,
 	decorator.Module,
 	intern.Module,
 	doc.Module,
+	fs.Module,
 	fun.Module,
+	hash.Module,
+	json.Module,
 	lark.Module,
 	core.Module,
 	task.Module,
 	path.Module,
+	regexp.Module,
+	semver.Module,
+	str.Module,
+	template.Module,
 }
 
 // InteralModules modules that are not general purpose and should not be imported by scripts.
@@ -0,0 +1,428 @@
+package path
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GlobOpt contains options for Glob.
+type GlobOpt struct {
+	// Exclude contains patterns for paths which are not matched.  Patterns
+	// containing a slash are matched against the path relative to the
+	// directory the glob pattern starts in, other patterns are matched
+	// against base names.  Excluded directories are not searched.
+	Exclude []string
+	// FilesOnly causes directories to be omitted from the matches.
+	FilesOnly bool
+	// Sort causes matches to be sorted lexically.  Otherwise matches are
+	// returned in the order they are found, which is lexical within each
+	// directory.
+	Sort bool
+	// Hidden allows wildcards to match names beginning with a dot.
+	Hidden bool
+	// Ignore is the name of ignore files (e.g. ".gitignore") which are read
+	// from each searched directory, and from directories between the current
+	// directory and the directory the glob pattern starts in.  Paths ignored
+	// by a file are not matched.
+	Ignore string
+}
+
+// Glob returns the paths matching pattern.  In addition to the syntax of
+// filepath.Match the path element "**" matches zero or more directories.
+// Symbolic links to directories are not followed by "**".
+func Glob(pattern string, opt *GlobOpt) ([]string, error) {
+	if opt == nil {
+		opt = &GlobOpt{}
+	}
+	pattern = filepath.ToSlash(pattern)
+	segs := strings.Split(pattern, "/")
+	for _, seg := range segs {
+		_, err := pathpkg.Match(seg, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the base is the longest prefix of the pattern without metacharacters.
+	var base string
+	i := 0
+	for ; i < len(segs)-1 && !hasMeta(segs[i]); i++ {
+		if i == 0 && segs[i] == "" {
+			base = "/"
+		} else {
+			base = pathpkg.Join(base, segs[i])
+		}
+	}
+	if base == "." {
+		base = ""
+	}
+
+	g := &globber{
+		opt:  opt,
+		base: base,
+		seen: make(map[string]bool),
+	}
+	for _, patt := range opt.Exclude {
+		g.exclude = append(g.exclude, newRule(filepath.ToSlash(patt), base))
+	}
+	var ignore []*rule
+	if opt.Ignore != "" {
+		var err error
+		ignore, err = g.readAncestorIgnores(base)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dir := base
+	if dir == "" {
+		dir = "."
+	}
+	err := g.globIn(dir, segs[i:], ignore)
+	if err != nil {
+		return nil, err
+	}
+	if opt.Sort {
+		sort.Strings(g.matches)
+	}
+	return g.matches, nil
+}
+
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, `*?[\`)
+}
+
+type globber struct {
+	opt     *GlobOpt
+	base    string
+	exclude []*rule
+	seen    map[string]bool
+	matches []string
+
+	cacheDir string
+	cache    []os.FileInfo
+}
+
+// join joins a directory searched by g and a name.
+func (g *globber) join(dir, name string) string {
+	if dir == "." && g.base == "" {
+		return name
+	}
+	return pathpkg.Join(dir, name)
+}
+
+// enter returns the ignore rules which apply to the contents of dir, given
+// the rules which apply to dir.
+func (g *globber) enter(dir string, ignore []*rule) ([]*rule, error) {
+	if g.opt.Ignore == "" {
+		return ignore, nil
+	}
+	// the slice is copied if rules are read so that siblings of dir do not
+	// share them.
+	return g.readIgnore(dir, ignore[:len(ignore):len(ignore)])
+}
+
+// glob matches segs against the contents of dir, a directory which has not
+// been searched.
+func (g *globber) glob(dir string, segs []string, ignore []*rule) error {
+	ignore, err := g.enter(dir, ignore)
+	if err != nil {
+		return err
+	}
+	return g.globIn(dir, segs, ignore)
+}
+
+// globIn matches segs against the contents of dir using ignore rules which
+// apply to the contents of dir.
+func (g *globber) globIn(dir string, segs []string, ignore []*rule) error {
+	seg := segs[0]
+	last := len(segs) == 1
+	if seg == "**" {
+		if last {
+			return g.walkAll(dir, ignore)
+		}
+		err := g.globIn(dir, segs[1:], ignore)
+		if err != nil {
+			return err
+		}
+		return g.eachEntry(dir, seg, ignore, func(path string, isDir, isLink bool) error {
+			if !isDir {
+				return nil
+			}
+			return g.glob(path, segs, ignore)
+		})
+	}
+
+	if !hasMeta(seg) {
+		path := g.join(dir, seg)
+		info, err := os.Stat(filepath.FromSlash(path))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if g.excluded(path, info.IsDir(), ignore) {
+			return nil
+		}
+		if last {
+			g.match(path, info.IsDir(), false)
+			return nil
+		}
+		if info.IsDir() {
+			return g.glob(path, segs[1:], ignore)
+		}
+		return nil
+	}
+
+	return g.eachEntry(dir, seg, ignore, func(path string, isDir, isLink bool) error {
+		if last {
+			g.match(path, isDir, isLink)
+			return nil
+		}
+		if isLink {
+			info, err := os.Stat(filepath.FromSlash(path))
+			if err != nil {
+				return nil
+			}
+			isDir = info.IsDir()
+		}
+		if isDir {
+			return g.glob(path, segs[1:], ignore)
+		}
+		return nil
+	})
+}
+
+// walkAll matches every path under dir (for a trailing "**").
+func (g *globber) walkAll(dir string, ignore []*rule) error {
+	return g.eachEntry(dir, "**", ignore, func(path string, isDir, isLink bool) error {
+		g.match(path, isDir, isLink)
+		if !isDir {
+			return nil
+		}
+		ignore, err := g.enter(path, ignore)
+		if err != nil {
+			return err
+		}
+		return g.walkAll(path, ignore)
+	})
+}
+
+// readDir returns the sorted entries of dir.  The entries of the last
+// directory read are cached because "**" reads each directory twice.
+func (g *globber) readDir(dir string) ([]os.FileInfo, error) {
+	if g.cacheDir == dir && g.cache != nil {
+		return g.cache, nil
+	}
+	entries, err := ioutil.ReadDir(filepath.FromSlash(dir))
+	if err != nil {
+		return nil, err
+	}
+	g.cacheDir, g.cache = dir, entries
+	return entries, nil
+}
+
+// eachEntry calls fn for each entry of dir matching seg which is not hidden,
+// excluded, or ignored.  If seg is "**" every entry is matched.  Symbolic
+// links are not followed, fn must determine whether a link is a directory.
+func (g *globber) eachEntry(dir, seg string, ignore []*rule, fn func(path string, isDir, isLink bool) error) error {
+	entries, err := g.readDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return nil
+		}
+		return err
+	}
+	for _, info := range entries {
+		name := info.Name()
+		if !g.opt.Hidden && strings.HasPrefix(name, ".") && !strings.HasPrefix(seg, ".") {
+			continue
+		}
+		if seg != "**" {
+			ok, _ := pathpkg.Match(seg, name)
+			if !ok {
+				continue
+			}
+		}
+		path := g.join(dir, name)
+		isDir := info.IsDir()
+		if g.excluded(path, isDir, ignore) {
+			continue
+		}
+		err := fn(path, isDir, info.Mode()&os.ModeSymlink != 0)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *globber) match(path string, isDir, isLink bool) {
+	if g.seen[path] {
+		return
+	}
+	if g.opt.FilesOnly {
+		if isLink {
+			info, err := os.Stat(filepath.FromSlash(path))
+			isDir = err == nil && info.IsDir()
+		}
+		if isDir {
+			return
+		}
+	}
+	g.seen[path] = true
+	g.matches = append(g.matches, filepath.FromSlash(path))
+}
+
+// excluded returns true if path is excluded or ignored.
+func (g *globber) excluded(path string, isDir bool, ignore []*rule) bool {
+	for _, r := range g.exclude {
+		if r.match(path, isDir) {
+			return true
+		}
+	}
+	ignored := false
+	for _, r := range ignore {
+		if r.match(path, isDir) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// readAncestorIgnores reads ignore files from the current directory and each
+// directory between it and base.
+func (g *globber) readAncestorIgnores(base string) ([]*rule, error) {
+	if pathpkg.IsAbs(base) {
+		return g.readIgnore(base, nil)
+	}
+	ignore, err := g.readIgnore(".", nil)
+	if err != nil {
+		return nil, err
+	}
+	dir := ""
+	for _, seg := range strings.Split(base, "/") {
+		if seg == "" || seg == "." {
+			continue
+		}
+		if seg == ".." {
+			break
+		}
+		dir = pathpkg.Join(dir, seg)
+		ignore, err = g.readIgnore(dir, ignore)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ignore, nil
+}
+
+// readIgnore appends the rules in the ignore file of dir to ignore.
+func (g *globber) readIgnore(dir string, ignore []*rule) ([]*rule, error) {
+	f, err := os.Open(filepath.Join(filepath.FromSlash(dir), g.opt.Ignore))
+	if os.IsNotExist(err) {
+		return ignore, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rbase := dir
+	if dir == "." {
+		rbase = ""
+	}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ignore = append(ignore, newRule(line, rbase))
+	}
+	return ignore, s.Err()
+}
+
+// rule is an exclusion pattern with the syntax of a .gitignore file.
+type rule struct {
+	base     string
+	segs     []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func newRule(patt, base string) *rule {
+	r := &rule{base: base}
+	if strings.HasPrefix(patt, "!") {
+		r.negate = true
+		patt = patt[1:]
+	}
+	if strings.HasSuffix(patt, "/") {
+		r.dirOnly = true
+		patt = strings.TrimRight(patt, "/")
+	}
+	if strings.Contains(patt, "/") {
+		r.anchored = true
+		patt = strings.TrimLeft(patt, "/")
+	}
+	r.segs = strings.Split(patt, "/")
+	return r
+}
+
+// match returns true if path matches r.  Because "**" matches zero elements
+// a pattern ending with "/**" also matches the directory containing the
+// matched paths, so the directory is not searched.
+func (r *rule) match(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel := path
+	switch r.base {
+	case "":
+	case "/":
+		if !strings.HasPrefix(path, "/") {
+			return false
+		}
+		rel = path[1:]
+	default:
+		if !strings.HasPrefix(path, r.base+"/") {
+			return false
+		}
+		rel = path[len(r.base)+1:]
+	}
+	if !r.anchored {
+		ok, _ := pathpkg.Match(r.segs[0], pathpkg.Base(rel))
+		return ok
+	}
+	return matchSegs(r.segs, strings.Split(rel, "/"))
+}
+
+// matchSegs matches the elements of a path against pattern elements, where
+// "**" matches zero or more elements.
+func matchSegs(patt, segs []string) bool {
+	for len(patt) > 0 {
+		if patt[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegs(patt[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		ok, _ := pathpkg.Match(patt[0], segs[0])
+		if !ok {
+			return false
+		}
+		patt, segs = patt[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
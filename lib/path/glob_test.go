@@ -0,0 +1,126 @@
+package path
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	root, err := ioutil.TempDir("", "lark-glob-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for name, content := range map[string]string{
+		"src/main.go":            "",
+		"src/main_test.go":       "",
+		"src/a/a.go":             "",
+		"src/a/b/b.go":           "",
+		"src/vendor/v/v.go":      "",
+		"src/.hidden/h.go":       "",
+		"src/gen/gen.go":         "",
+		"src/gen/keep.go":        "",
+		"src/.gitignore":         "gen/*\n!gen/keep.go\n# comment\n*.tmp\n",
+		"src/a/tmp.tmp":          "",
+		"src/a/b/.gitignore":     "b.go\n",
+		"src/a/b/notes.txt":      "",
+		"other/main.go":          "",
+		"other/nested/other.tmp": "",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		err := ioutil.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	err = os.Chdir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		patt   string
+		opt    *GlobOpt
+		expect []string
+	}{
+		{"src/*.go", nil, []string{"src/main.go", "src/main_test.go"}},
+		{"src/**/*.go", &GlobOpt{Sort: true}, []string{
+			"src/a/a.go", "src/a/b/b.go", "src/gen/gen.go", "src/gen/keep.go",
+			"src/main.go", "src/main_test.go", "src/vendor/v/v.go",
+		}},
+		{"src/**/*.go", &GlobOpt{Sort: true, Hidden: true}, []string{
+			"src/.hidden/h.go", "src/a/a.go", "src/a/b/b.go", "src/gen/gen.go",
+			"src/gen/keep.go", "src/main.go", "src/main_test.go", "src/vendor/v/v.go",
+		}},
+		{"src/**/*.go", &GlobOpt{Sort: true, Exclude: []string{"vendor/**", "*_test.go", "gen"}}, []string{
+			"src/a/a.go", "src/a/b/b.go", "src/main.go",
+		}},
+		{"src/**/*.go", &GlobOpt{Sort: true, Ignore: ".gitignore"}, []string{
+			"src/a/a.go", "src/gen/keep.go", "src/main.go", "src/main_test.go", "src/vendor/v/v.go",
+		}},
+		{"src/a/**", &GlobOpt{Sort: true, Ignore: ".gitignore"}, []string{
+			"src/a/a.go", "src/a/b", "src/a/b/notes.txt",
+		}},
+		{"src/a/**", &GlobOpt{Sort: true, FilesOnly: true}, []string{
+			"src/a/a.go", "src/a/b/b.go", "src/a/b/notes.txt", "src/a/tmp.tmp",
+		}},
+		{"**/main.go", &GlobOpt{Sort: true}, []string{"other/main.go", "src/main.go"}},
+		{"*/main.go", &GlobOpt{Sort: true, Exclude: []string{"other/"}}, []string{"src/main.go"}},
+		{"src/missing/**/*.go", nil, nil},
+	} {
+		matches, err := Glob(test.patt, test.opt)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		var expect []string
+		for _, path := range test.expect {
+			expect = append(expect, filepath.FromSlash(path))
+		}
+		if !reflect.DeepEqual(matches, expect) {
+			t.Errorf("test %d: %q (!= %q)", i, matches, expect)
+		}
+	}
+
+	_, err = Glob("src/[", nil)
+	if err == nil {
+		t.Errorf("invalid pattern did not fail")
+	}
+}
+
+func TestRule_match(t *testing.T) {
+	for i, test := range []struct {
+		patt  string
+		base  string
+		path  string
+		isDir bool
+		match bool
+	}{
+		{"*.go", "", "src/main.go", false, true},
+		{"*.go", "src", "src/a/main.go", false, true},
+		{"*.go", "src", "srcs/main.go", false, false},
+		{"a/*.go", "src", "src/a/main.go", false, true},
+		{"a/*.go", "src", "src/b/a/main.go", false, false},
+		{"tmp/", "/", "/tmp", true, true},
+		{"tmp/", "/", "/tmp", false, false},
+		{"tmp/*", "/", "/tmp/x", false, true},
+		{"tmp/*", "/", "tmp/x", false, false},
+		{"*.go", "/", "/src/main.go", false, true},
+	} {
+		r := newRule(test.patt, test.base)
+		match := r.match(test.path, test.isDir)
+		if match != test.match {
+			t.Errorf("test %d: %q in %q matches %q: %v", i, test.patt, test.base, test.path, match)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package path
 
 import (
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	"strings"
 
 	"github.com/bmatsuo/lark/gluamodule"
 	"github.com/bmatsuo/lark/lib/doc"
@@ -28,10 +30,22 @@ func Loader(l *lua.LState) int {
 
 	glob := l.NewClosure(LuaGlob)
 	doc.Go(l, glob, &doc.Docs{
-		Sig:  "patt => [string]",
-		Desc: "Returns an array of paths that match the given pattern.",
+		Sig: "(patt, opt) => [string]",
+		Desc: `
+		Returns an array of paths that match the given pattern.  The path
+		element '**' matches zero or more directories.  Wildcards do not
+		match names beginning with a dot unless opt.hidden is true.
+		`,
 		Params: []string{
 			"patt  Pattern using star '*' as a wildcard.",
+			"opt   Optional table of options.",
+		},
+		Vars: []string{
+			"opt.exclude     A pattern or array of patterns for paths that are not matched.  Patterns containing a slash are matched relative to the first directory in patt containing a wildcard, other patterns match base names.  Excluded directories are not searched.",
+			"opt.files_only  Omit directories from the result.",
+			"opt.sort        Sort the result lexically.",
+			"opt.hidden      Allow wildcards to match names beginning with a dot.",
+			"opt.ignore      The name of an ignore file (e.g. '.gitignore') read from searched directories.  Ignored paths are not matched.",
 		},
 	})
 	l.SetField(mod, "glob", glob)
@@ -96,26 +110,142 @@ func Loader(l *lua.LState) int {
 	})
 	l.SetField(mod, "is_dir", isDir)
 
+	abs := l.NewClosure(LuaAbs)
+	doc.Go(l, abs, &doc.Docs{
+		Sig:  "path => string",
+		Desc: "Returns an absolute representation of path.  Relative paths are joined with the working directory.",
+		Params: []string{
+			"path  A file path that may not exist",
+		},
+	})
+	l.SetField(mod, "abs", abs)
+
+	rel := l.NewClosure(LuaRel)
+	doc.Go(l, rel, &doc.Docs{
+		Sig: "(base, target) => string",
+		Desc: `
+		Returns a relative path that is equivalent to target when joined to
+		base.  An error is raised if target cannot be made relative to base.
+		`,
+		Params: []string{
+			"base    The directory the result is relative to",
+			"target  A file path that may not exist",
+		},
+	})
+	l.SetField(mod, "rel", rel)
+
+	clean := l.NewClosure(LuaClean)
+	doc.Go(l, clean, &doc.Docs{
+		Sig:  "path => string",
+		Desc: "Returns the shortest path equivalent to path by lexical processing.",
+		Params: []string{
+			"path  A file path that may not exist",
+		},
+	})
+	l.SetField(mod, "clean", clean)
+
+	split := l.NewClosure(LuaSplit)
+	doc.Go(l, split, &doc.Docs{
+		Sig: "path => (string, string)",
+		Desc: `
+		Splits path immediately following the final separator and returns
+		the directory and file name.  The directory is empty if path
+		contains no separator.
+		`,
+		Params: []string{
+			"path  A file path that may not exist",
+		},
+	})
+	l.SetField(mod, "split", split)
+
+	match := l.NewClosure(LuaMatch)
+	doc.Go(l, match, &doc.Docs{
+		Sig: "(patt, name) => bool",
+		Desc: `
+		Returns true if name matches the shell pattern patt.  As in
+		path.glob() the path element '**' matches zero or more directories.
+		`,
+		Params: []string{
+			"patt  Pattern using star '*' as a wildcard",
+			"name  A file path that may not exist",
+		},
+	})
+	l.SetField(mod, "match", match)
+
+	withExt := l.NewClosure(LuaWithExt)
+	doc.Go(l, withExt, &doc.Docs{
+		Sig:  "(path, ext) => string",
+		Desc: "Returns path with its file extension replaced by ext.  If ext is empty the extension is removed.",
+		Params: []string{
+			"path  A file path that may not exist",
+			"ext   The new extension, with or without a leading dot",
+		},
+	})
+	l.SetField(mod, "with_ext", withExt)
+
+	outOfDate := l.NewClosure(LuaOutOfDate)
+	doc.Go(l, outOfDate, &doc.Docs{
+		Sig: "(target, source, ...) => bool",
+		Desc: `
+		Returns true if target needs to be regenerated because it does not
+		exist or because a source was modified after target.  An error is
+		raised if a source does not exist.  If no sources are given (e.g. an
+		empty array) true is returned only if target does not exist.
+
+			> if path.out_of_date('lark', path.glob('**/*.go')) then
+			>>     lark.exec('go', 'build')
+			>> end
+		`,
+		Params: []string{
+			"target  The path of a generated file",
+			"source  The path of a file target is generated from, or an array of paths",
+		},
+	})
+	l.SetField(mod, "out_of_date", outOfDate)
+
 	l.Push(mod)
 	return 1
 }
 
 // Exports defines the exported functions in the path module.
 var Exports = map[string]lua.LGFunction{
-	"glob":   LuaGlob,
-	"base":   LuaBase,
-	"dir":    LuaDir,
-	"ext":    LuaExt,
-	"join":   LuaJoin,
-	"exists": LuaExists,
-	"is_dir": LuaIsDir,
+	"glob":        LuaGlob,
+	"base":        LuaBase,
+	"dir":         LuaDir,
+	"ext":         LuaExt,
+	"join":        LuaJoin,
+	"exists":      LuaExists,
+	"is_dir":      LuaIsDir,
+	"abs":         LuaAbs,
+	"rel":         LuaRel,
+	"clean":       LuaClean,
+	"split":       LuaSplit,
+	"match":       LuaMatch,
+	"with_ext":    LuaWithExt,
+	"out_of_date": LuaOutOfDate,
 }
 
 // LuaGlob executes a file glob.
 func LuaGlob(state *lua.LState) int {
 	pattern := state.CheckString(1)
+	opt := &GlobOpt{}
+	if state.GetTop() > 1 && state.Get(2) != lua.LNil {
+		lopt := state.CheckTable(2)
+		opt.Exclude = optStrings(state, lopt, "exclude")
+		opt.FilesOnly = lua.LVAsBool(state.GetField(lopt, "files_only"))
+		opt.Sort = lua.LVAsBool(state.GetField(lopt, "sort"))
+		opt.Hidden = lua.LVAsBool(state.GetField(lopt, "hidden"))
+		lignore := state.GetField(lopt, "ignore")
+		if lignore != lua.LNil {
+			ignore, ok := lignore.(lua.LString)
+			if !ok {
+				state.ArgError(2, "named value 'ignore' is not a string: "+lignore.Type().String())
+			}
+			opt.Ignore = string(ignore)
+		}
+	}
 
-	files, err := filepath.Glob(pattern)
+	files, err := Glob(pattern, opt)
 	if err != nil {
 		state.RaiseError("%s", err.Error())
 		return 0
@@ -128,6 +258,30 @@ func LuaGlob(state *lua.LState) int {
 	return 1
 }
 
+// optStrings returns the named value of opt, which may be a string or an
+// array of strings.
+func optStrings(state *lua.LState, opt *lua.LTable, name string) []string {
+	switch v := state.GetField(opt, name).(type) {
+	case lua.LString:
+		return []string{string(v)}
+	case *lua.LTable:
+		var strs []string
+		for i := 1; i <= v.Len(); i++ {
+			s, ok := v.RawGetInt(i).(lua.LString)
+			if !ok {
+				state.ArgError(2, "named value '"+name+"' contains a non-string value")
+			}
+			strs = append(strs, string(s))
+		}
+		return strs
+	default:
+		if v != lua.LNil {
+			state.ArgError(2, "named value '"+name+"' is not a string or table: "+v.Type().String())
+		}
+		return nil
+	}
+}
+
 // LuaBase returns the basename of the path arguent provided.
 func LuaBase(state *lua.LState) int {
 	path := state.CheckString(1)
@@ -203,3 +357,130 @@ func LuaIsDir(state *lua.LState) int {
 	state.Push(lua.LBool(info.IsDir()))
 	return 1
 }
+
+// LuaAbs returns an absolute representation of the path argument provided.
+func LuaAbs(state *lua.LState) int {
+	path := state.CheckString(1)
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	state.Push(lua.LString(abs))
+	return 1
+}
+
+// LuaRel returns the target path argument relative to the base argument.
+func LuaRel(state *lua.LState) int {
+	base := state.CheckString(1)
+	target := state.CheckString(2)
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	state.Push(lua.LString(rel))
+	return 1
+}
+
+// LuaClean returns the shortest path equivalent to the path argument.
+func LuaClean(state *lua.LState) int {
+	path := state.CheckString(1)
+	state.Push(lua.LString(filepath.Clean(path)))
+	return 1
+}
+
+// LuaSplit returns the directory and file name of the path argument.
+func LuaSplit(state *lua.LState) int {
+	path := state.CheckString(1)
+	dir, file := filepath.Split(path)
+	state.Push(lua.LString(dir))
+	state.Push(lua.LString(file))
+	return 2
+}
+
+// LuaMatch returns true if the name argument matches the pattern argument.
+func LuaMatch(state *lua.LState) int {
+	pattern := state.CheckString(1)
+	name := state.CheckString(2)
+	ok, err := Match(pattern, name)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	state.Push(lua.LBool(ok))
+	return 1
+}
+
+// Match is like filepath.Match but the path element "**" matches zero or more
+// path elements.
+func Match(pattern, name string) (bool, error) {
+	segs := strings.Split(filepath.ToSlash(pattern), "/")
+	for _, seg := range segs {
+		_, err := pathpkg.Match(seg, "")
+		if err != nil {
+			return false, err
+		}
+	}
+	return matchSegs(segs, strings.Split(filepath.ToSlash(name), "/")), nil
+}
+
+// LuaWithExt replaces the file extension of the path argument.
+func LuaWithExt(state *lua.LState) int {
+	path := state.CheckString(1)
+	ext := state.CheckString(2)
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	path = strings.TrimSuffix(path, filepath.Ext(path)) + ext
+	state.Push(lua.LString(path))
+	return 1
+}
+
+// LuaOutOfDate returns true if the target argument does not exist or is older
+// than any of the source arguments.  Without sources true is returned only if
+// the target does not exist.
+func LuaOutOfDate(state *lua.LState) int {
+	target := state.CheckString(1)
+	var sources []string
+	for i := 2; i <= state.GetTop(); i++ {
+		switch v := state.Get(i).(type) {
+		case lua.LString:
+			sources = append(sources, string(v))
+		case *lua.LTable:
+			for j := 1; j <= v.Len(); j++ {
+				s, ok := v.RawGetInt(j).(lua.LString)
+				if !ok {
+					state.ArgError(i, "source array contains a non-string value")
+				}
+				sources = append(sources, string(s))
+			}
+		default:
+			state.ArgError(i, "source is not a string or table: "+v.Type().String())
+		}
+	}
+
+	info, err := os.Stat(target)
+	if os.IsNotExist(err) {
+		state.Push(lua.LTrue)
+		return 1
+	}
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	mtime := info.ModTime()
+	outOfDate := false
+	for _, source := range sources {
+		info, err := os.Stat(source)
+		if err != nil {
+			state.RaiseError("%s", err.Error())
+			return 0
+		}
+		if info.ModTime().After(mtime) {
+			outOfDate = true
+		}
+	}
+	state.Push(lua.LBool(outOfDate))
+	return 1
+}
@@ -32,13 +32,27 @@ end
 
 function test_glob()
     local files = path.glob('./*.go')
-    assert(table.getn(files) == 2)
+    assert(table.getn(files) == 4)
     files = path.glob('../*/path.go')
     assert(table.getn(files) == 1)
     files = path.glob('x/y/*.z')
     assert(table.getn(files) == 0)
 end
 
+function test_glob_opt()
+    local files = path.glob('../**/path.go', {files_only=true, sort=true})
+    assert(table.getn(files) == 1)
+    files = path.glob('./*.go', {exclude={'*_test.go'}, sort=true})
+    assert(table.getn(files) == 2)
+    assert(files[1] == 'glob.go')
+    assert(files[2] == 'path.go')
+    files = path.glob('../*', {exclude='path'})
+    for _, f in pairs(files) do
+        assert(f ~= '../path')
+    end
+    assert(not pcall(path.glob, '*', {exclude=1}))
+end
+
 function test_is_dir()
     assert(not path.is_dir('./x/y/z'))
     assert(not path.is_dir('path_test.lua'))
@@ -53,3 +67,59 @@ function test_join()
     assert(path.join('abc', '', 'def') == 'abc/def')
     assert(path.join('abc', '/def') == 'abc/def')
 end
+
+function test_abs()
+    assert(path.abs('/abc/../def') == '/def')
+    local abs = path.abs('path_test.lua')
+    assert(string.sub(abs, 1, 1) == '/')
+    assert(path.base(abs) == 'path_test.lua')
+end
+
+function test_rel()
+    assert(path.rel('/a/b', '/a/b/c/d') == 'c/d')
+    assert(path.rel('/a/b', '/a/x') == '../x')
+    assert(path.rel('release', 'release/lark-1/README.md') == 'lark-1/README.md')
+    assert(not pcall(path.rel, '/a', 'b'))
+end
+
+function test_clean()
+    assert(path.clean('a//b/./c/..') == 'a/b')
+    assert(path.clean('') == '.')
+end
+
+function test_split()
+    local dir, file = path.split('/a/b/c.txt')
+    assert(dir == '/a/b/')
+    assert(file == 'c.txt')
+    dir, file = path.split('c.txt')
+    assert(dir == '')
+    assert(file == 'c.txt')
+end
+
+function test_match()
+    assert(path.match('*.go', 'path.go'))
+    assert(not path.match('*.go', 'a/path.go'))
+    assert(path.match('**/*.go', 'a/b/path.go'))
+    assert(path.match('src/**', 'src/a/b'))
+    assert(not path.match('src/**/*.go', 'lib/a.go'))
+    assert(not pcall(path.match, '[', 'x'))
+end
+
+function test_with_ext()
+    assert(path.with_ext('a/b.c', '.o') == 'a/b.o')
+    assert(path.with_ext('a/b.c', 'o') == 'a/b.o')
+    assert(path.with_ext('a/b', '.o') == 'a/b.o')
+    assert(path.with_ext('a/b.tar.gz', '') == 'a/b.tar')
+end
+
+function test_out_of_date()
+    assert(path.out_of_date('x/y/z', 'path.go'))
+    assert(path.out_of_date('x/y/z', {'path.go', 'path_test.go'}))
+    assert(not path.out_of_date('path.go', 'path.go'))
+    assert(not pcall(path.out_of_date, 'path.go', 'x/y/z'))
+    assert(not pcall(path.out_of_date, 'path.go', 1))
+    assert(path.out_of_date('x/y/z'))
+    assert(path.out_of_date('x/y/z', {}))
+    assert(not path.out_of_date('path.go'))
+    assert(not path.out_of_date('path.go', {}))
+end
@@ -0,0 +1,338 @@
+package regexp
+
+import (
+	goregexp "regexp"
+	"sync"
+
+	"github.com/bmatsuo/lark/gluamodule"
+	"github.com/bmatsuo/lark/lib/doc"
+	"github.com/yuin/gopher-lua"
+)
+
+// Module is a gluamodule.Module that loads the regexp module.
+var Module = gluamodule.New("regexp", Loader,
+	doc.Module,
+)
+
+// typeName is the name of the metatable of compiled expressions.
+const typeName = "regexp.Regexp"
+
+// Loader preloads the regexp module so that it can be required in lua
+// scripts.
+func Loader(l *lua.LState) int {
+	l.Pop(1) // first argument is the module name
+
+	mod := l.NewTable()
+	doc.Go(l, mod, &doc.Docs{
+		Desc: `
+		The regexp module provides regular expressions using the RE2 syntax
+		of the Go regexp package, which supports alternation, repetition
+		counts, and named groups unlike Lua patterns.
+
+		Functions taking an expression accept a string or a value returned by
+		regexp.compile().  Compiled expressions are cached, so expression
+		strings may be passed repeatedly without being recompiled.  A compiled
+		expression has methods corresponding to each function (e.g.
+		re:match(s) is equivalent to regexp.match(re, s)).
+		`,
+	})
+
+	methods := l.NewTable()
+	mt := l.NewTypeMetatable(typeName)
+	l.SetField(mt, "__index", methods)
+	l.SetField(mt, "__tostring", l.NewFunction(luaString))
+
+	set := func(name string, fn lua.LGFunction, docs *doc.Docs) {
+		lfn := l.NewClosure(fn)
+		doc.Go(l, lfn, docs)
+		l.SetField(mod, name, lfn)
+		if name != "compile" && name != "quote" {
+			l.SetField(methods, name, lfn)
+		}
+	}
+
+	set("compile", LuaCompile, &doc.Docs{
+		Sig:  "expr => re",
+		Desc: "Compiles a regular expression.  An error is raised if expr is not valid.",
+		Params: []string{
+			"expr  A regular expression",
+		},
+	})
+	set("quote", LuaQuote, &doc.Docs{
+		Sig:  "s => string",
+		Desc: "Returns an expression matching the literal text s.",
+		Params: []string{
+			"s  The text to match",
+		},
+	})
+	set("match", LuaMatch, &doc.Docs{
+		Sig:  "(re, s) => bool",
+		Desc: "Returns true if re matches any part of s.",
+		Params: []string{
+			"re  A regular expression",
+			"s   The string to search",
+		},
+	})
+	set("find", LuaFind, &doc.Docs{
+		Sig:  "(re, s) => (string, number, number)",
+		Desc: "Returns the leftmost match of re in s and its start and end positions, or nil if there is no match.",
+		Params: []string{
+			"re  A regular expression",
+			"s   The string to search",
+		},
+	})
+	set("find_all", LuaFindAll, &doc.Docs{
+		Sig:  "(re, s, n) => [string]",
+		Desc: "Returns the successive non-overlapping matches of re in s.",
+		Params: []string{
+			"re  A regular expression",
+			"s   The string to search",
+			"n   Optional maximum number of matches",
+		},
+	})
+	set("submatches", LuaSubmatches, &doc.Docs{
+		Sig: "(re, s) => table",
+		Desc: `
+		Returns the groups of the leftmost match of re in s, or nil if there
+		is no match.  Group i is at index i and the entire match is at index 0.
+		Named groups are also fields of the table.  Groups which did not
+		participate in the match are false.
+		`,
+		Params: []string{
+			"re  A regular expression",
+			"s   The string to search",
+		},
+	})
+	set("replace", LuaReplace, &doc.Docs{
+		Sig: "(re, s, repl) => string",
+		Desc: `
+		Replaces the matches of re in s.  If repl is a string, $1 or ${name}
+		within it are replaced by groups of the match.  If repl is a function
+		it is called with the match followed by its groups and returns the
+		replacement string.
+		`,
+		Params: []string{
+			"re    A regular expression",
+			"s     The string to search",
+			"repl  A string or a function",
+		},
+	})
+	set("split", LuaSplit, &doc.Docs{
+		Sig:  "(re, s, n) => [string]",
+		Desc: "Returns the substrings of s between matches of re.",
+		Params: []string{
+			"re  A regular expression",
+			"s   The string to split",
+			"n   Optional maximum number of substrings",
+		},
+	})
+
+	l.Push(mod)
+	return 1
+}
+
+// Exports defines the exported functions in the regexp module.
+var Exports = map[string]lua.LGFunction{
+	"compile":    LuaCompile,
+	"quote":      LuaQuote,
+	"match":      LuaMatch,
+	"find":       LuaFind,
+	"find_all":   LuaFindAll,
+	"submatches": LuaSubmatches,
+	"replace":    LuaReplace,
+	"split":      LuaSplit,
+}
+
+// cacheSize is the number of compiled expressions retained by Compile.
+const cacheSize = 256
+
+var cache = struct {
+	sync.Mutex
+	m map[string]*goregexp.Regexp
+}{m: make(map[string]*goregexp.Regexp)}
+
+// Compile returns the compiled form of expr.  Compiled expressions are
+// cached.
+func Compile(expr string) (*goregexp.Regexp, error) {
+	cache.Lock()
+	defer cache.Unlock()
+	re, ok := cache.m[expr]
+	if ok {
+		return re, nil
+	}
+	re, err := goregexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(cache.m) >= cacheSize {
+		cache.m = make(map[string]*goregexp.Regexp)
+	}
+	cache.m[expr] = re
+	return re, nil
+}
+
+// Captures returns a table containing the groups of the leftmost match of re
+// in s, or nil if there is no match.  Group i is at index i and the entire
+// match is at index 0.  Named groups are also fields of the table.
+func Captures(l *lua.LState, re *goregexp.Regexp, s string) *lua.LTable {
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil
+	}
+	t := l.NewTable()
+	names := re.SubexpNames()
+	for i := 0; i < len(loc)/2; i++ {
+		var v lua.LValue = lua.LFalse
+		if loc[2*i] >= 0 {
+			v = lua.LString(s[loc[2*i]:loc[2*i+1]])
+		}
+		t.RawSetInt(i, v)
+		if names[i] != "" {
+			t.RawSetString(names[i], v)
+		}
+	}
+	return t
+}
+
+// checkRegexp returns the expression at position n of the stack, which may be
+// a string or a compiled expression.
+func checkRegexp(l *lua.LState, n int) *goregexp.Regexp {
+	switch v := l.Get(n).(type) {
+	case lua.LString:
+		re, err := Compile(string(v))
+		if err != nil {
+			l.ArgError(n, err.Error())
+		}
+		return re
+	case *lua.LUserData:
+		re, ok := v.Value.(*goregexp.Regexp)
+		if ok {
+			return re
+		}
+	}
+	l.ArgError(n, "expected a string or compiled expression: "+l.Get(n).Type().String())
+	return nil
+}
+
+func luaString(l *lua.LState) int {
+	re := checkRegexp(l, 1)
+	l.Push(lua.LString(re.String()))
+	return 1
+}
+
+// LuaCompile compiles a regular expression.
+func LuaCompile(l *lua.LState) int {
+	re := checkRegexp(l, 1)
+	ud := l.NewUserData()
+	ud.Value = re
+	l.SetMetatable(ud, l.GetTypeMetatable(typeName))
+	l.Push(ud)
+	return 1
+}
+
+// LuaQuote escapes the metacharacters in a string.
+func LuaQuote(l *lua.LState) int {
+	s := l.CheckString(1)
+	l.Push(lua.LString(goregexp.QuoteMeta(s)))
+	return 1
+}
+
+// LuaMatch tests whether an expression matches a string.
+func LuaMatch(l *lua.LState) int {
+	re := checkRegexp(l, 1)
+	s := l.CheckString(2)
+	l.Push(lua.LBool(re.MatchString(s)))
+	return 1
+}
+
+// LuaFind returns the leftmost match of an expression in a string.
+func LuaFind(l *lua.LState) int {
+	re := checkRegexp(l, 1)
+	s := l.CheckString(2)
+	loc := re.FindStringIndex(s)
+	if loc == nil {
+		l.Push(lua.LNil)
+		return 1
+	}
+	l.Push(lua.LString(s[loc[0]:loc[1]]))
+	l.Push(lua.LNumber(loc[0] + 1))
+	l.Push(lua.LNumber(loc[1]))
+	return 3
+}
+
+// LuaFindAll returns all matches of an expression in a string.
+func LuaFindAll(l *lua.LState) int {
+	re := checkRegexp(l, 1)
+	s := l.CheckString(2)
+	n := l.OptInt(3, -1)
+	t := l.NewTable()
+	for _, m := range re.FindAllString(s, n) {
+		t.Append(lua.LString(m))
+	}
+	l.Push(t)
+	return 1
+}
+
+// LuaSubmatches returns the groups of the leftmost match of an expression.
+func LuaSubmatches(l *lua.LState) int {
+	re := checkRegexp(l, 1)
+	s := l.CheckString(2)
+	t := Captures(l, re, s)
+	if t == nil {
+		l.Push(lua.LNil)
+		return 1
+	}
+	l.Push(t)
+	return 1
+}
+
+// LuaReplace replaces the matches of an expression in a string.
+func LuaReplace(l *lua.LState) int {
+	re := checkRegexp(l, 1)
+	s := l.CheckString(2)
+	switch repl := l.Get(3).(type) {
+	case lua.LString:
+		l.Push(lua.LString(re.ReplaceAllString(s, string(repl))))
+	case *lua.LFunction:
+		var out []byte
+		last := 0
+		for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+			out = append(out, s[last:loc[0]]...)
+			l.Push(repl)
+			for i := 0; i < len(loc)/2; i++ {
+				if loc[2*i] < 0 {
+					l.Push(lua.LFalse)
+				} else {
+					l.Push(lua.LString(s[loc[2*i]:loc[2*i+1]]))
+				}
+			}
+			l.Call(len(loc)/2, 1)
+			v := l.Get(-1)
+			l.Pop(1)
+			str, ok := v.(lua.LString)
+			if !ok {
+				l.RaiseError("replacement is not a string: %s", v.Type())
+			}
+			out = append(out, str...)
+			last = loc[1]
+		}
+		out = append(out, s[last:]...)
+		l.Push(lua.LString(out))
+	default:
+		l.ArgError(3, "expected a string or function: "+repl.Type().String())
+	}
+	return 1
+}
+
+// LuaSplit splits a string around the matches of an expression.
+func LuaSplit(l *lua.LState) int {
+	re := checkRegexp(l, 1)
+	s := l.CheckString(2)
+	n := l.OptInt(3, -1)
+	t := l.NewTable()
+	for _, part := range re.Split(s, n) {
+		t.Append(lua.LString(part))
+	}
+	l.Push(t)
+	return 1
+}
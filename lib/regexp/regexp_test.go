@@ -0,0 +1,39 @@
+package regexp
+
+import (
+	"testing"
+
+	"github.com/bmatsuo/lark/gluatest"
+)
+
+var luaRegexpTest = &gluatest.File{
+	Module: Module,
+	Path:   "regexp_test.lua",
+}
+
+func TestModule(t *testing.T) {
+	luaRegexpTest.Test(t)
+}
+
+func BenchmarkRequireModule(b *testing.B) {
+	file := &gluatest.File{Module: Module}
+	file.BenchmarkRequireModule(b)
+}
+
+func TestCompile(t *testing.T) {
+	re1, err := Compile(`a+b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	re2, err := Compile(`a+b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if re1 != re2 {
+		t.Errorf("expression was not cached")
+	}
+	_, err = Compile(`(`)
+	if err == nil {
+		t.Errorf("invalid expression compiled")
+	}
+}
@@ -0,0 +1,66 @@
+local regexp = require('regexp')
+
+function test_match()
+    assert(regexp.match('^(foo|bar)$', 'bar'))
+    assert(not regexp.match('^(foo|bar)$', 'baz'))
+    assert(not pcall(regexp.match, '(', 'x'))
+    assert(not pcall(regexp.match, {}, 'x'))
+end
+
+function test_compile()
+    local re = regexp.compile('a{2,}')
+    assert(tostring(re) == 'a{2,}')
+    assert(re:match('baab'))
+    assert(not re:match('bab'))
+    assert(regexp.match(re, 'aaa'))
+    assert(not pcall(regexp.compile, '('))
+end
+
+function test_find()
+    local m, i, j = regexp.find('[0-9]+', 'abc 123 45')
+    assert(m == '123')
+    assert(i == 5)
+    assert(j == 7)
+    assert(regexp.find('[0-9]+', 'abc') == nil)
+end
+
+function test_find_all()
+    local all = regexp.find_all('[0-9]+', 'a1 b22 c333')
+    assert(#all == 3)
+    assert(all[3] == '333')
+    assert(#regexp.find_all('[0-9]+', 'a1 b22 c333', 2) == 2)
+    assert(#regexp.find_all('[0-9]+', 'abc') == 0)
+end
+
+function test_submatches()
+    local m = regexp.submatches([[(?P<key>\w+)=(\w+)?]], 'x key= y')
+    assert(m[0] == 'key=')
+    assert(m[1] == 'key')
+    assert(m.key == 'key')
+    assert(m[2] == false)
+    assert(regexp.submatches('x(y)', 'abc') == nil)
+end
+
+function test_replace()
+    assert(regexp.replace('a(b*)', 'ab abb', '<$1>') == '<b> <bb>')
+    assert(regexp.replace('(?P<n>[0-9]+)', 'v1.2', '[${n}]') == 'v[1].[2]')
+    local s = regexp.replace('([a-z])([0-9])', 'a1 b2 c', function(m, letter, digit)
+        return digit .. letter
+    end)
+    assert(s == '1a 2b c')
+    assert(not pcall(regexp.replace, 'a', 'a', function() return nil end))
+    assert(not pcall(regexp.replace, 'a', 'a', 1))
+end
+
+function test_split()
+    local parts = regexp.split('\\s*,\\s*', 'a , b,c')
+    assert(#parts == 3)
+    assert(parts[2] == 'b')
+    assert(#regexp.split(',', 'a,b,c', 2) == 2)
+end
+
+function test_quote()
+    assert(regexp.quote('a.b*') == 'a\\.b\\*')
+    assert(regexp.match('^' .. regexp.quote('a.b') .. '$', 'a.b'))
+    assert(not regexp.match('^' .. regexp.quote('a.b') .. '$', 'axb'))
+end
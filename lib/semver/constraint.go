@@ -0,0 +1,192 @@
+package semver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constraint is a set of version ranges.
+type Constraint struct {
+	str string
+	// ranges are alternatives.  A version satisfies a range if it satisfies
+	// every comparator in the range.
+	ranges [][]*comparator
+}
+
+type comparator struct {
+	op string // one of "=", "!=", "<", "<=", ">", ">="
+	v  *Version
+}
+
+// ParseConstraint parses a version constraint.  A constraint consists of
+// comparisons separated by white space (or commas), all of which must be
+// satisfied.  Alternative constraints are separated by "||".  Comparisons
+// have an operator ("=", "!=", "<", "<=", ">", ">=", "~", or "^") followed by
+// a version, in which trailing components may be omitted or given as the
+// wildcards "x" or "*".  A version without an operator matches any version
+// with the components given.
+//
+//	>=1.4 <2       at least 1.4.0 and below 2.0.0
+//	1.4            1.4.0 up to but not including 1.5.0
+//	~1.4.2         1.4.2 up to but not including 1.5.0
+//	^1.4.2         1.4.2 up to but not including 2.0.0
+//	^0.4.2         0.4.2 up to but not including 0.5.0
+//
+// Prerelease versions only satisfy a range containing a comparison with a
+// prerelease of the same major, minor, and patch version.
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{str: s}
+	for _, alt := range strings.Split(s, "||") {
+		var rng []*comparator
+		fields := strings.Fields(strings.Replace(alt, ",", " ", -1))
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			// allow white space between an operator and its version.
+			if strings.TrimLeft(field, "=!<>~^") == "" && i+1 < len(fields) {
+				i++
+				field += fields[i]
+			}
+			cmps, err := parseComparison(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %q: %v", s, err)
+			}
+			rng = append(rng, cmps...)
+		}
+		if len(rng) == 0 {
+			// an empty constraint matches any release.
+			rng = []*comparator{{">=", &Version{}}}
+		}
+		c.ranges = append(c.ranges, rng)
+	}
+	return c, nil
+}
+
+// parseComparison returns the comparators equivalent to a single comparison.
+func parseComparison(s string) ([]*comparator, error) {
+	op := s[:len(s)-len(strings.TrimLeft(s, "=!<>~^"))]
+	v, n, err := parse(s[len(op):], true)
+	if err != nil {
+		return nil, err
+	}
+	// next returns the lowest version above those matching the n given
+	// components.
+	next := func(n int) *Version {
+		switch n {
+		case 1:
+			return &Version{Major: v.Major + 1}
+		case 2:
+			return &Version{Major: v.Major, Minor: v.Minor + 1}
+		}
+		return &Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+	all := []*comparator{{">=", &Version{}}}
+
+	switch op {
+	case "", "=", "==":
+		switch n {
+		case 0:
+			return all, nil
+		case 3:
+			return []*comparator{{"=", v}}, nil
+		}
+		return []*comparator{{">=", v}, {"<", next(n)}}, nil
+	case "!=":
+		if n < 3 {
+			return nil, fmt.Errorf("incomplete version: %s", s)
+		}
+		return []*comparator{{"!=", v}}, nil
+	case ">", "<=":
+		if n == 0 {
+			if op == ">" {
+				return []*comparator{{"<", &Version{}}}, nil
+			}
+			return all, nil
+		}
+		if n == 3 {
+			return []*comparator{{op, v}}, nil
+		}
+		// >1.4 means >=1.5.0 and <=1.4 means <1.5.0
+		if op == ">" {
+			return []*comparator{{">=", next(n)}}, nil
+		}
+		return []*comparator{{"<", next(n)}}, nil
+	case ">=", "<":
+		if n == 0 {
+			if op == ">=" {
+				return all, nil
+			}
+			return []*comparator{{"<", &Version{}}}, nil
+		}
+		return []*comparator{{op, v}}, nil
+	case "~":
+		if n == 0 {
+			return all, nil
+		}
+		if n == 1 {
+			return []*comparator{{">=", v}, {"<", next(1)}}, nil
+		}
+		return []*comparator{{">=", v}, {"<", next(2)}}, nil
+	case "^":
+		switch {
+		case n == 0:
+			return all, nil
+		case v.Major > 0 || n == 1:
+			return []*comparator{{">=", v}, {"<", next(1)}}, nil
+		case v.Minor > 0 || n == 2:
+			return []*comparator{{">=", v}, {"<", next(2)}}, nil
+		}
+		return []*comparator{{">=", v}, {"<", next(3)}}, nil
+	}
+	return nil, fmt.Errorf("invalid operator: %s", op)
+}
+
+// String returns the constraint as it was parsed.
+func (c *Constraint) String() string {
+	return c.str
+}
+
+// Check returns true if v satisfies c.
+func (c *Constraint) Check(v *Version) bool {
+	for _, rng := range c.ranges {
+		if checkRange(rng, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkRange(rng []*comparator, v *Version) bool {
+	for _, cmp := range rng {
+		if !cmp.check(v) {
+			return false
+		}
+	}
+	if len(v.Pre) == 0 {
+		return true
+	}
+	for _, cmp := range rng {
+		if len(cmp.v.Pre) > 0 && cmp.v.Major == v.Major && cmp.v.Minor == v.Minor && cmp.v.Patch == v.Patch {
+			return true
+		}
+	}
+	return false
+}
+
+func (cmp *comparator) check(v *Version) bool {
+	c := Compare(v, cmp.v)
+	switch cmp.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
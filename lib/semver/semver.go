@@ -0,0 +1,304 @@
+package semver
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bmatsuo/lark/gluamodule"
+	"github.com/bmatsuo/lark/lib/doc"
+	"github.com/yuin/gopher-lua"
+)
+
+// Module is a gluamodule.Module that loads the semver module.
+var Module = gluamodule.New("semver", Loader,
+	doc.Module,
+)
+
+// typeName is the name of the metatable of parsed versions.
+const typeName = "semver.Version"
+
+// Loader preloads the semver module so that it can be required in lua
+// scripts.
+func Loader(l *lua.LState) int {
+	l.Pop(1) // first argument is the module name
+
+	mod := l.NewTable()
+	doc.Go(l, mod, &doc.Docs{
+		Desc: `
+		The semver module parses and compares semantic versions
+		(http://semver.org/).  A leading "v" is allowed in versions.
+		Functions taking a version accept a string or a table returned by
+		semver.parse().  Parsed versions can be compared with the relational
+		operators and converted to strings with tostring().
+		`,
+	})
+
+	mt := l.NewTypeMetatable(typeName)
+	l.SetField(mt, "__tostring", l.NewFunction(luaString))
+	l.SetField(mt, "__eq", l.NewFunction(luaCompareOp(func(c int) bool { return c == 0 })))
+	l.SetField(mt, "__lt", l.NewFunction(luaCompareOp(func(c int) bool { return c < 0 })))
+	l.SetField(mt, "__le", l.NewFunction(luaCompareOp(func(c int) bool { return c <= 0 })))
+
+	set := func(name string, fn lua.LGFunction, docs *doc.Docs) {
+		lfn := l.NewClosure(fn)
+		doc.Go(l, lfn, docs)
+		l.SetField(mod, name, lfn)
+	}
+
+	set("parse", LuaParse, &doc.Docs{
+		Sig:  "s => version",
+		Desc: "Parses a version.  An error is raised if s is not a valid semantic version.",
+		Params: []string{
+			"s  A semantic version",
+		},
+		Vars: []string{
+			"version.major       The major version number",
+			"version.minor       The minor version number",
+			"version.patch       The patch version number",
+			"version.prerelease  The prerelease version, or nil",
+			"version.build       The build metadata, or nil",
+		},
+	})
+	set("valid", LuaValid, &doc.Docs{
+		Sig:  "s => bool",
+		Desc: "Returns true if s is a valid semantic version.",
+		Params: []string{
+			"s  A string",
+		},
+	})
+	set("compare", LuaCompare, &doc.Docs{
+		Sig:  "(a, b) => number",
+		Desc: "Returns -1, 0, or 1 if a has lower, equal, or higher precedence than b.  Build metadata is ignored.",
+		Params: []string{
+			"a  A version",
+			"b  A version",
+		},
+	})
+	set("sort", LuaSort, &doc.Docs{
+		Sig:  "(versions, desc) => versions",
+		Desc: "Sorts an array of versions in place by precedence and returns it.",
+		Params: []string{
+			"versions  An array of versions",
+			"desc      Optional flag to sort in descending order",
+		},
+	})
+	set("bump", LuaBump, &doc.Docs{
+		Sig: "(version, part, id) => string",
+		Desc: `
+		Returns the version following version.  When bumping the major,
+		minor, or patch version of a prerelease which would be released by
+		the bump (e.g. bumping the patch of 1.2.3-rc.1), the prerelease is
+		removed instead.  Bumping a prerelease increments its last number,
+		or starts prerelease id.1 of the next patch version (or of the same
+		version if it is a prerelease with a different id).
+		`,
+		Params: []string{
+			"version  A version",
+			"part     One of \"major\", \"minor\", \"patch\", or \"prerelease\"",
+			"id       Optional prerelease identifier (default \"rc\" or the current identifier)",
+		},
+	})
+	set("satisfies", LuaSatisfies, &doc.Docs{
+		Sig: "(version, constraint) => bool",
+		Desc: `
+		Returns true if version satisfies constraint.  A constraint consists
+		of comparisons separated by white space or commas, all of which must
+		be satisfied.  Alternatives are separated by "||".  A comparison is
+		an operator ("=", "!=", "<", "<=", ">", ">=", "~", or "^") followed
+		by a version, in which trailing components may be omitted or given as
+		"x".  A version without an operator matches any version with the
+		components given.
+
+			>=1.4 <2    At least 1.4.0 and below 2.0.0
+			1.4         1.4.0 up to but not including 1.5.0
+			~1.4.2      1.4.2 up to but not including 1.5.0
+			^1.4.2      1.4.2 up to but not including 2.0.0
+			^0.4.2      0.4.2 up to but not including 0.5.0
+
+		Prerelease versions only satisfy constraints which compare with a
+		prerelease of the same major, minor, and patch version.  An error is
+		raised if constraint is not valid.
+		`,
+		Params: []string{
+			"version     A version",
+			"constraint  A version constraint",
+		},
+	})
+
+	l.Push(mod)
+	return 1
+}
+
+// Exports defines the exported functions in the semver module.
+var Exports = map[string]lua.LGFunction{
+	"parse":     LuaParse,
+	"valid":     LuaValid,
+	"compare":   LuaCompare,
+	"sort":      LuaSort,
+	"bump":      LuaBump,
+	"satisfies": LuaSatisfies,
+}
+
+// toVersion returns the version represented by v, which may be a string or a
+// table returned by semver.parse().
+func toVersion(l *lua.LState, v lua.LValue) (*Version, bool) {
+	switch v := v.(type) {
+	case lua.LString:
+		ver, err := Parse(string(v))
+		return ver, err == nil
+	case *lua.LTable:
+		ver := &Version{}
+		for field, x := range map[string]*int64{"major": &ver.Major, "minor": &ver.Minor, "patch": &ver.Patch} {
+			n, ok := l.GetField(v, field).(lua.LNumber)
+			if !ok || n < 0 || lua.LNumber(int64(n)) != n {
+				return nil, false
+			}
+			*x = int64(n)
+		}
+		if s, ok := l.GetField(v, "prerelease").(lua.LString); ok {
+			ver.Pre = strings.Split(string(s), ".")
+		}
+		if s, ok := l.GetField(v, "build").(lua.LString); ok {
+			ver.Build = strings.Split(string(s), ".")
+		}
+		// validate the identifiers
+		ver, err := Parse(ver.String())
+		return ver, err == nil
+	}
+	return nil, false
+}
+
+// checkVersion returns the version at position n of the stack.
+func checkVersion(l *lua.LState, n int) *Version {
+	v, ok := toVersion(l, l.Get(n))
+	if !ok {
+		l.ArgError(n, "invalid version: "+l.Get(n).String())
+	}
+	return v
+}
+
+func pushVersion(l *lua.LState, v *Version) {
+	t := l.NewTable()
+	t.RawSetString("major", lua.LNumber(v.Major))
+	t.RawSetString("minor", lua.LNumber(v.Minor))
+	t.RawSetString("patch", lua.LNumber(v.Patch))
+	if len(v.Pre) > 0 {
+		t.RawSetString("prerelease", lua.LString(strings.Join(v.Pre, ".")))
+	}
+	if len(v.Build) > 0 {
+		t.RawSetString("build", lua.LString(strings.Join(v.Build, ".")))
+	}
+	l.SetMetatable(t, l.GetTypeMetatable(typeName))
+	l.Push(t)
+}
+
+func luaString(l *lua.LState) int {
+	v := checkVersion(l, 1)
+	l.Push(lua.LString(v.String()))
+	return 1
+}
+
+func luaCompareOp(test func(int) bool) lua.LGFunction {
+	return func(l *lua.LState) int {
+		a := checkVersion(l, 1)
+		b := checkVersion(l, 2)
+		l.Push(lua.LBool(test(Compare(a, b))))
+		return 1
+	}
+}
+
+// LuaParse parses a version.
+func LuaParse(l *lua.LState) int {
+	s := l.CheckString(1)
+	v, err := Parse(s)
+	if err != nil {
+		l.RaiseError("%s", err.Error())
+		return 0
+	}
+	pushVersion(l, v)
+	return 1
+}
+
+// LuaValid tests whether a string is a valid version.
+func LuaValid(l *lua.LState) int {
+	s := l.CheckString(1)
+	_, err := Parse(s)
+	l.Push(lua.LBool(err == nil))
+	return 1
+}
+
+// LuaCompare compares two versions.
+func LuaCompare(l *lua.LState) int {
+	a := checkVersion(l, 1)
+	b := checkVersion(l, 2)
+	l.Push(lua.LNumber(Compare(a, b)))
+	return 1
+}
+
+// LuaSort sorts an array of versions.
+func LuaSort(l *lua.LState) int {
+	t := l.CheckTable(1)
+	desc := l.OptBool(2, false)
+	n := t.Len()
+	values := make([]lua.LValue, n)
+	versions := make([]*Version, n)
+	for i := range values {
+		values[i] = t.RawGetInt(i + 1)
+		v, ok := toVersion(l, values[i])
+		if !ok {
+			l.ArgError(1, "invalid version: "+values[i].String())
+		}
+		versions[i] = v
+	}
+	sort.Stable(byPrecedence{values, versions, desc})
+	for i, v := range values {
+		t.RawSetInt(i+1, v)
+	}
+	l.Push(t)
+	return 1
+}
+
+type byPrecedence struct {
+	values   []lua.LValue
+	versions []*Version
+	desc     bool
+}
+
+func (s byPrecedence) Len() int { return len(s.values) }
+func (s byPrecedence) Swap(i, j int) {
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+	s.versions[i], s.versions[j] = s.versions[j], s.versions[i]
+}
+func (s byPrecedence) Less(i, j int) bool {
+	if s.desc {
+		return Compare(s.versions[i], s.versions[j]) > 0
+	}
+	return Compare(s.versions[i], s.versions[j]) < 0
+}
+
+// LuaBump returns the next version.
+func LuaBump(l *lua.LState) int {
+	v := checkVersion(l, 1)
+	part := l.CheckString(2)
+	id := l.OptString(3, "")
+	next, err := Bump(v, part, id)
+	if err != nil {
+		l.RaiseError("%s", err.Error())
+		return 0
+	}
+	l.Push(lua.LString(next.String()))
+	return 1
+}
+
+// LuaSatisfies tests whether a version satisfies a constraint.
+func LuaSatisfies(l *lua.LState) int {
+	v := checkVersion(l, 1)
+	s := l.CheckString(2)
+	c, err := ParseConstraint(s)
+	if err != nil {
+		l.ArgError(2, err.Error())
+		return 0
+	}
+	l.Push(lua.LBool(c.Check(v)))
+	return 1
+}
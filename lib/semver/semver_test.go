@@ -0,0 +1,191 @@
+package semver
+
+import (
+	"testing"
+
+	"github.com/bmatsuo/lark/gluatest"
+)
+
+var luaSemverTest = &gluatest.File{
+	Module: Module,
+	Path:   "semver_test.lua",
+}
+
+func TestModule(t *testing.T) {
+	luaSemverTest.Test(t)
+}
+
+func BenchmarkRequireModule(b *testing.B) {
+	file := &gluatest.File{Module: Module}
+	file.BenchmarkRequireModule(b)
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{
+		"0.0.0",
+		"1.2.3",
+		"v1.2.3",
+		"1.2.3-rc.1",
+		"1.2.3-0.alpha-1",
+		"1.2.3+build.5",
+		"1.2.3-beta+exp.sha.5114f85",
+	} {
+		v, err := Parse(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		expect := s
+		if s[0] == 'v' {
+			expect = s[1:]
+		}
+		if v.String() != expect {
+			t.Errorf("%s: parsed as %s", s, v)
+		}
+	}
+	for _, s := range []string{
+		"",
+		"1",
+		"1.2",
+		"1.2.3.4",
+		"01.2.3",
+		"1.2.x",
+		"1.2.3-",
+		"1.2.3-01",
+		"1.2.3-a..b",
+		"1.2.3+",
+		"1.2.3-a_b",
+		"a.b.c",
+	} {
+		_, err := Parse(s)
+		if err == nil {
+			t.Errorf("%s: parsed", s)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// versions in order of increasing precedence (from semver.org)
+	order := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.1.0",
+		"2.0.0",
+		"10.0.0",
+	}
+	for i := range order {
+		for j := range order {
+			a, _ := Parse(order[i])
+			b, _ := Parse(order[j])
+			c := Compare(a, b)
+			expect := cmpInt(int64(i), int64(j))
+			if c != expect {
+				t.Errorf("compare(%s, %s) = %d (expected %d)", a, b, c, expect)
+			}
+		}
+	}
+	a, _ := Parse("1.0.0+a")
+	b, _ := Parse("1.0.0+b")
+	if Compare(a, b) != 0 {
+		t.Errorf("build metadata affected precedence")
+	}
+}
+
+func TestBump(t *testing.T) {
+	for _, test := range []struct {
+		v, part, id, next string
+	}{
+		{"1.2.3", "major", "", "2.0.0"},
+		{"1.2.3", "minor", "", "1.3.0"},
+		{"1.2.3", "patch", "", "1.2.4"},
+		{"1.2.3+build", "patch", "", "1.2.4"},
+		{"2.0.0-rc.1", "major", "", "2.0.0"},
+		{"1.2.0-rc.1", "major", "", "2.0.0"},
+		{"1.2.0-rc.1", "minor", "", "1.2.0"},
+		{"1.2.3-rc.1", "minor", "", "1.3.0"},
+		{"1.2.3-rc.1", "patch", "", "1.2.3"},
+		{"1.2.3", "prerelease", "", "1.2.4-rc.1"},
+		{"1.2.3", "prerelease", "beta", "1.2.4-beta.1"},
+		{"1.2.4-rc.1", "prerelease", "", "1.2.4-rc.2"},
+		{"1.2.4-rc.9", "prerelease", "rc", "1.2.4-rc.10"},
+		{"1.2.4-beta.2", "prerelease", "rc", "1.2.4-rc.1"},
+		{"1.2.4-beta", "prerelease", "", "1.2.4-beta.1"},
+	} {
+		v, _ := Parse(test.v)
+		next, err := Bump(v, test.part, test.id)
+		if err != nil {
+			t.Errorf("bump(%s, %s, %s): %v", test.v, test.part, test.id, err)
+			continue
+		}
+		if next.String() != test.next {
+			t.Errorf("bump(%s, %s, %s) = %s (expected %s)", test.v, test.part, test.id, next, test.next)
+		}
+	}
+	v, _ := Parse("1.2.3")
+	for _, test := range [][2]string{{"micro", ""}, {"prerelease", "1"}, {"prerelease", "a.b"}} {
+		_, err := Bump(v, test[0], test[1])
+		if err == nil {
+			t.Errorf("bump(1.2.3, %s, %s): no error", test[0], test[1])
+		}
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	for _, test := range []struct {
+		c     string
+		match []string
+		not   []string
+	}{
+		{">=1.4 <2", []string{"1.4.0", "1.9.9"}, []string{"1.3.9", "2.0.0", "2.0.0-rc.1", "1.5.0-rc.1"}},
+		{">=1.4, <2", []string{"1.4.0"}, []string{"2.0.0"}},
+		{">= 1.4", []string{"1.4.0", "3.0.0"}, []string{"1.3.0"}},
+		{"1.4", []string{"1.4.0", "1.4.9"}, []string{"1.5.0", "1.3.9"}},
+		{"1.4.x", []string{"1.4.0", "1.4.9"}, []string{"1.5.0"}},
+		{"1.2.3", []string{"1.2.3", "v1.2.3+build"}, []string{"1.2.4"}},
+		{"=1.2.3-rc.1", []string{"1.2.3-rc.1"}, []string{"1.2.3"}},
+		{"!=1.2.3", []string{"1.2.4"}, []string{"1.2.3"}},
+		{">1.4", []string{"1.5.0"}, []string{"1.4.9"}},
+		{">1.4.0", []string{"1.4.1"}, []string{"1.4.0"}},
+		{"<=1.4", []string{"1.4.9"}, []string{"1.5.0"}},
+		{"~1.4.2", []string{"1.4.2", "1.4.9"}, []string{"1.4.1", "1.5.0"}},
+		{"~1", []string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+		{"^1.4.2", []string{"1.4.2", "1.9.0"}, []string{"1.4.1", "2.0.0"}},
+		{"^0.4.2", []string{"0.4.2", "0.4.9"}, []string{"0.5.0"}},
+		{"^0.0.2", []string{"0.0.2"}, []string{"0.0.3"}},
+		{">=1.0.0-rc.1 <2", []string{"1.0.0-rc.2", "1.0.0"}, []string{"1.0.0-beta", "1.1.0-rc.1"}},
+		{"<1 || >=2.1", []string{"0.9.0", "2.1.0"}, []string{"1.0.0", "2.0.0"}},
+		{"*", []string{"0.0.0", "5.0.0"}, []string{"5.0.0-rc.1"}},
+		{"", []string{"1.0.0"}, nil},
+	} {
+		c, err := ParseConstraint(test.c)
+		if err != nil {
+			t.Errorf("%q: %v", test.c, err)
+			continue
+		}
+		for _, s := range test.match {
+			v, _ := Parse(s)
+			if !c.Check(v) {
+				t.Errorf("%q does not match %s", test.c, s)
+			}
+		}
+		for _, s := range test.not {
+			v, _ := Parse(s)
+			if c.Check(v) {
+				t.Errorf("%q matches %s", test.c, s)
+			}
+		}
+	}
+	for _, s := range []string{">=", "1.2.3.4", ">=<1", "!=1.2", "1.x.3", "abc"} {
+		_, err := ParseConstraint(s)
+		if err == nil {
+			t.Errorf("%q: parsed", s)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+local semver = require('semver')
+
+function test_parse()
+    local v = semver.parse('v1.2.3-rc.1+build.7')
+    assert(v.major == 1)
+    assert(v.minor == 2)
+    assert(v.patch == 3)
+    assert(v.prerelease == 'rc.1')
+    assert(v.build == 'build.7')
+    assert(tostring(v) == '1.2.3-rc.1+build.7')
+    v = semver.parse('1.2.3')
+    assert(v.prerelease == nil)
+    assert(v.build == nil)
+    assert(not pcall(semver.parse, '1.2'))
+    assert(semver.valid('1.2.3'))
+    assert(not semver.valid('1.2'))
+end
+
+function test_compare()
+    assert(semver.compare('1.2.3', '1.10.0') == -1)
+    assert(semver.compare('1.2.3', 'v1.2.3+x') == 0)
+    assert(semver.compare('1.2.3', '1.2.3-rc.1') == 1)
+    assert(semver.compare(semver.parse('2.0.0'), '1.0.0') == 1)
+    assert(semver.parse('1.2.3') < semver.parse('1.10.0'))
+    assert(semver.parse('1.2.3') <= semver.parse('1.2.3'))
+    assert(semver.parse('1.2.3') == semver.parse('1.2.3+x'))
+    assert(semver.parse('2.0.0') > semver.parse('2.0.0-rc.1'))
+    local v = semver.parse('1.2.3')
+    v.minor = 5
+    assert(tostring(v) == '1.5.3')
+    assert(not pcall(semver.compare, '1.2', '1.2.3'))
+end
+
+function test_sort()
+    local versions = {'1.10.0', 'v1.2.0', '1.2.0-rc.1', semver.parse('0.9.0')}
+    assert(semver.sort(versions) == versions)
+    assert(tostring(versions[1]) == '0.9.0')
+    assert(versions[2] == '1.2.0-rc.1')
+    assert(versions[3] == 'v1.2.0')
+    assert(versions[4] == '1.10.0')
+    semver.sort(versions, true)
+    assert(versions[1] == '1.10.0')
+    assert(not pcall(semver.sort, {'1.0.0', 'x'}))
+end
+
+function test_bump()
+    assert(semver.bump('1.2.3', 'major') == '2.0.0')
+    assert(semver.bump('1.2.3', 'minor') == '1.3.0')
+    assert(semver.bump('v1.2.3', 'patch') == '1.2.4')
+    assert(semver.bump('1.2.3', 'prerelease') == '1.2.4-rc.1')
+    assert(semver.bump('1.2.4-rc.1', 'prerelease') == '1.2.4-rc.2')
+    assert(semver.bump('1.2.4-rc.2', 'patch') == '1.2.4')
+    assert(semver.bump('1.2.3', 'prerelease', 'beta') == '1.2.4-beta.1')
+    assert(not pcall(semver.bump, '1.2.3', 'micro'))
+end
+
+function test_satisfies()
+    assert(semver.satisfies('1.4.0', '>=1.4 <2'))
+    assert(semver.satisfies('1.9.9', '>=1.4 <2'))
+    assert(not semver.satisfies('2.0.0', '>=1.4 <2'))
+    assert(not semver.satisfies('1.3.0', '>=1.4 <2'))
+    assert(semver.satisfies('0.9.0', '<1 || ^2.1'))
+    assert(semver.satisfies('2.5.0', '<1 || ^2.1'))
+    assert(semver.satisfies(semver.parse('1.4.2'), '~1.4'))
+    assert(not pcall(semver.satisfies, '1.0.0', '>=x.y'))
+end
@@ -0,0 +1,241 @@
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version as defined at http://semver.org/.
+type Version struct {
+	Major int64
+	Minor int64
+	Patch int64
+	// Pre contains the dot separated identifiers of the prerelease version.
+	Pre []string
+	// Build contains the dot separated identifiers of the build metadata.
+	Build []string
+}
+
+// Parse parses a semantic version.  A leading "v" is allowed.
+func Parse(s string) (*Version, error) {
+	v, n, err := parse(s, false)
+	if err != nil {
+		return nil, err
+	}
+	if n < 3 {
+		return nil, fmt.Errorf("invalid version: %s", s)
+	}
+	return v, nil
+}
+
+// parse parses a version in which trailing numeric components may be
+// omitted.  If partial is true the components may also be the wildcards "x",
+// "X", or "*".  The number of numeric components given is returned.
+func parse(s string, partial bool) (*Version, int, error) {
+	invalid := fmt.Errorf("invalid version: %s", s)
+	str := strings.TrimPrefix(s, "v")
+	v := &Version{}
+	if i := strings.IndexByte(str, '+'); i >= 0 {
+		v.Build = strings.Split(str[i+1:], ".")
+		str = str[:i]
+		for _, id := range v.Build {
+			if !validIdent(id) {
+				return nil, 0, invalid
+			}
+		}
+	}
+	if i := strings.IndexByte(str, '-'); i >= 0 {
+		v.Pre = strings.Split(str[i+1:], ".")
+		str = str[:i]
+		for _, id := range v.Pre {
+			if !validIdent(id) || (isNumeric(id) && len(id) > 1 && id[0] == '0') {
+				return nil, 0, invalid
+			}
+		}
+	}
+
+	parts := strings.Split(str, ".")
+	if len(parts) > 3 {
+		return nil, 0, invalid
+	}
+	nums := []*int64{&v.Major, &v.Minor, &v.Patch}
+	n := 0
+	for i, part := range parts {
+		if partial && (part == "x" || part == "X" || part == "*") {
+			if i < len(parts)-1 && !isWildcard(parts[i+1]) {
+				return nil, 0, invalid
+			}
+			break
+		}
+		if !isNumeric(part) || (len(part) > 1 && part[0] == '0') {
+			return nil, 0, invalid
+		}
+		x, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, 0, invalid
+		}
+		*nums[i] = x
+		n++
+	}
+	if n < 3 && (v.Pre != nil || v.Build != nil) {
+		return nil, 0, invalid
+	}
+	return v, n, nil
+}
+
+func isWildcard(s string) bool {
+	return s == "x" || s == "X" || s == "*"
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func validIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the version without a leading "v".
+func (v *Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Pre) > 0 {
+		s += "-" + strings.Join(v.Pre, ".")
+	}
+	if len(v.Build) > 0 {
+		s += "+" + strings.Join(v.Build, ".")
+	}
+	return s
+}
+
+// Compare returns -1, 0, or 1 if a has lower, equal, or higher precedence
+// than b.  Build metadata is ignored.
+func Compare(a, b *Version) int {
+	switch {
+	case a.Major != b.Major:
+		return cmpInt(a.Major, b.Major)
+	case a.Minor != b.Minor:
+		return cmpInt(a.Minor, b.Minor)
+	case a.Patch != b.Patch:
+		return cmpInt(a.Patch, b.Patch)
+	}
+	// a version without a prerelease has higher precedence.
+	switch {
+	case len(a.Pre) == 0 && len(b.Pre) == 0:
+		return 0
+	case len(a.Pre) == 0:
+		return 1
+	case len(b.Pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(a.Pre) && i < len(b.Pre); i++ {
+		c := cmpIdent(a.Pre[i], b.Pre[i])
+		if c != 0 {
+			return c
+		}
+	}
+	return cmpInt(int64(len(a.Pre)), int64(len(b.Pre)))
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// cmpIdent compares prerelease identifiers.  Numeric identifiers have lower
+// precedence than alphanumeric ones.
+func cmpIdent(a, b string) int {
+	anum, bnum := isNumeric(a), isNumeric(b)
+	switch {
+	case anum && bnum:
+		if len(a) != len(b) {
+			return cmpInt(int64(len(a)), int64(len(b)))
+		}
+		return strings.Compare(a, b)
+	case anum:
+		return -1
+	case bnum:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Bump returns the version following v.  Part is "major", "minor", "patch",
+// or "prerelease".  When a prerelease of the resulting version would be
+// released (e.g. bumping the patch of 1.2.3-rc.1) the prerelease is removed
+// instead.  A prerelease bump increments the last numeric identifier of the
+// prerelease, or starts the prerelease id.1 of the next patch version.  If
+// id differs from the current prerelease the prerelease id.1 of the same
+// version is started.  Build metadata is always removed.
+func Bump(v *Version, part, id string) (*Version, error) {
+	next := &Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+	pre := len(v.Pre) > 0
+	switch part {
+	case "major":
+		if !pre || v.Minor != 0 || v.Patch != 0 {
+			next.Major++
+			next.Minor, next.Patch = 0, 0
+		}
+	case "minor":
+		if !pre || v.Patch != 0 {
+			next.Minor++
+			next.Patch = 0
+		}
+	case "patch":
+		if !pre {
+			next.Patch++
+		}
+	case "prerelease":
+		if id == "" && pre {
+			id = v.Pre[0]
+		}
+		if id == "" {
+			id = "rc"
+		}
+		if !validIdent(id) || isNumeric(id) {
+			return nil, fmt.Errorf("invalid prerelease identifier: %s", id)
+		}
+		switch {
+		case !pre:
+			next.Patch++
+			next.Pre = []string{id, "1"}
+		case v.Pre[0] != id:
+			next.Pre = []string{id, "1"}
+		default:
+			next.Pre = append([]string(nil), v.Pre...)
+			last := len(next.Pre) - 1
+			if isNumeric(next.Pre[last]) {
+				x, _ := strconv.ParseInt(next.Pre[last], 10, 64)
+				next.Pre[last] = strconv.FormatInt(x+1, 10)
+			} else {
+				next.Pre = append(next.Pre, "1")
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid version part: %s", part)
+	}
+	return next, nil
+}
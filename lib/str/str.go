@@ -0,0 +1,340 @@
+package str
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/bmatsuo/lark/gluamodule"
+	"github.com/bmatsuo/lark/internal/textutil"
+	"github.com/bmatsuo/lark/lib/doc"
+	"github.com/yuin/gopher-lua"
+)
+
+// Module is a gluamodule.Module that loads the str module.
+var Module = gluamodule.New("str", Loader,
+	doc.Module,
+)
+
+// Loader preloads the str module so that it can be required in lua scripts.
+func Loader(l *lua.LState) int {
+	l.Pop(1) // first argument is the module name
+
+	mod := l.NewTable()
+	doc.Go(l, mod, &doc.Docs{
+		Desc: `
+		The str module contains string utilities, including functions to
+		quote and split shell command lines.  Separators and prefixes are
+		plain strings, not Lua patterns.
+		`,
+	})
+
+	set := func(name string, fn lua.LGFunction, docs *doc.Docs) {
+		lfn := l.NewClosure(fn)
+		doc.Go(l, lfn, docs)
+		l.SetField(mod, name, lfn)
+	}
+
+	set("shell_quote", LuaShellQuote, &doc.Docs{
+		Sig: "(args, ...) => string",
+		Desc: `
+		Returns a command line which a POSIX shell would split into args.
+		Arguments are quoted only when they contain characters special to the
+		shell.
+		`,
+		Params: []string{
+			"args  A string or an array of strings and arrays",
+		},
+	})
+	set("shell_split", LuaShellSplit, &doc.Docs{
+		Sig: "s => [string]",
+		Desc: `
+		Splits a command line into words following the quoting rules of a
+		POSIX shell.  Variables, globs, and other expansions are not
+		evaluated.  An error is raised if s contains an unterminated quote.
+		`,
+		Params: []string{
+			"s  A command line",
+		},
+	})
+	set("split", LuaSplit, &doc.Docs{
+		Sig:  "(s, sep, n) => [string]",
+		Desc: "Returns the substrings of s separated by sep.",
+		Params: []string{
+			"s    The string to split",
+			"sep  The separator",
+			"n    Optional maximum number of substrings",
+		},
+	})
+	set("trim", LuaTrim, &doc.Docs{
+		Sig:  "(s, cutset) => string",
+		Desc: "Returns s without leading and trailing white space, or characters contained in cutset.",
+		Params: []string{
+			"s       The string to trim",
+			"cutset  Optional characters to remove",
+		},
+	})
+	set("fields", LuaFields, &doc.Docs{
+		Sig:  "s => [string]",
+		Desc: "Returns the substrings of s separated by white space.",
+		Params: []string{
+			"s  The string to split",
+		},
+	})
+	set("has_prefix", LuaHasPrefix, &doc.Docs{
+		Sig:  "(s, prefix) => bool",
+		Desc: "Returns true if s begins with prefix.",
+		Params: []string{
+			"s       The string to test",
+			"prefix  The prefix",
+		},
+	})
+	set("has_suffix", LuaHasSuffix, &doc.Docs{
+		Sig:  "(s, suffix) => bool",
+		Desc: "Returns true if s ends with suffix.",
+		Params: []string{
+			"s       The string to test",
+			"suffix  The suffix",
+		},
+	})
+	set("dedent", LuaDedent, &doc.Docs{
+		Sig:  "s => string",
+		Desc: "Removes the indentation common to the non-blank lines of s.",
+		Params: []string{
+			"s  The text to dedent",
+		},
+	})
+	set("wrap", LuaWrap, &doc.Docs{
+		Sig: "(s, width) => string",
+		Desc: `
+		Wraps lines of s to width.  Indented lines are considered
+		preformatted and are not wrapped.
+		`,
+		Params: []string{
+			"s      The text to wrap",
+			"width  The maximum line width (default 80)",
+		},
+	})
+
+	l.Push(mod)
+	return 1
+}
+
+// Exports defines the exported functions in the str module.
+var Exports = map[string]lua.LGFunction{
+	"shell_quote": LuaShellQuote,
+	"shell_split": LuaShellSplit,
+	"split":       LuaSplit,
+	"trim":        LuaTrim,
+	"fields":      LuaFields,
+	"has_prefix":  LuaHasPrefix,
+	"has_suffix":  LuaHasSuffix,
+	"dedent":      LuaDedent,
+	"wrap":        LuaWrap,
+}
+
+// LuaShellQuote quotes arguments for a shell.
+func LuaShellQuote(state *lua.LState) int {
+	var args []string
+	for i := 1; i <= state.GetTop(); i++ {
+		var err error
+		args, err = appendArgs(args, state.Get(i))
+		if err != nil {
+			state.ArgError(i, err.Error())
+		}
+	}
+	state.Push(lua.LString(ShellQuote(args)))
+	return 1
+}
+
+// appendArgs appends the strings in v, which may be a string or a (nested)
+// array of strings.  Non-integer keys of tables are ignored.
+func appendArgs(args []string, v lua.LValue) ([]string, error) {
+	switch v := v.(type) {
+	case lua.LString:
+		return append(args, string(v)), nil
+	case *lua.LTable:
+		for i := 1; i <= v.Len(); i++ {
+			var err error
+			args, err = appendArgs(args, v.RawGetInt(i))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return args, nil
+	default:
+		return nil, fmt.Errorf("cannot quote type: %s", v.Type())
+	}
+}
+
+// LuaShellSplit splits a command line into words.
+func LuaShellSplit(state *lua.LState) int {
+	s := state.CheckString(1)
+	words, err := ShellSplit(s)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	state.Push(stringArray(state, words))
+	return 1
+}
+
+// LuaSplit splits a string around a separator.
+func LuaSplit(state *lua.LState) int {
+	s := state.CheckString(1)
+	sep := state.CheckString(2)
+	n := state.OptInt(3, -1)
+	state.Push(stringArray(state, strings.SplitN(s, sep, n)))
+	return 1
+}
+
+// LuaTrim removes leading and trailing characters from a string.
+func LuaTrim(state *lua.LState) int {
+	s := state.CheckString(1)
+	if state.Get(2) == lua.LNil {
+		state.Push(lua.LString(strings.TrimSpace(s)))
+		return 1
+	}
+	cutset := state.CheckString(2)
+	state.Push(lua.LString(strings.Trim(s, cutset)))
+	return 1
+}
+
+// LuaFields splits a string around white space.
+func LuaFields(state *lua.LState) int {
+	s := state.CheckString(1)
+	state.Push(stringArray(state, strings.Fields(s)))
+	return 1
+}
+
+// LuaHasPrefix tests whether a string begins with a prefix.
+func LuaHasPrefix(state *lua.LState) int {
+	s := state.CheckString(1)
+	prefix := state.CheckString(2)
+	state.Push(lua.LBool(strings.HasPrefix(s, prefix)))
+	return 1
+}
+
+// LuaHasSuffix tests whether a string ends with a suffix.
+func LuaHasSuffix(state *lua.LState) int {
+	s := state.CheckString(1)
+	suffix := state.CheckString(2)
+	state.Push(lua.LBool(strings.HasSuffix(s, suffix)))
+	return 1
+}
+
+// LuaDedent removes common indentation from text.
+func LuaDedent(state *lua.LState) int {
+	s := state.CheckString(1)
+	state.Push(lua.LString(textutil.Unindent(s)))
+	return 1
+}
+
+// LuaWrap wraps text to a line width.
+func LuaWrap(state *lua.LState) int {
+	s := state.CheckString(1)
+	width := state.OptInt(2, 80)
+	state.Push(lua.LString(textutil.Wrap(s, width)))
+	return 1
+}
+
+func stringArray(state *lua.LState, strs []string) *lua.LTable {
+	t := state.NewTable()
+	for _, s := range strs {
+		t.Append(lua.LString(s))
+	}
+	return t
+}
+
+// ShellQuote returns a command line which a POSIX shell splits into args.
+func ShellQuote(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shellQuoteArg(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, c := range s {
+		if !isShellSafe(c) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func isShellSafe(c rune) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.ContainsRune("-_./:=+,@%", c)
+}
+
+// ShellSplit splits s into words using the quoting rules of a POSIX shell.
+// Expansions are not performed.  An error is returned if s contains an
+// unterminated quote or ends with an escaping backslash.
+func ShellSplit(s string) ([]string, error) {
+	var words []string
+	var word bytes.Buffer
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case ' ', '\t', '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case '\\':
+			i++
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated escape")
+			}
+			if s[i] != '\n' {
+				word.WriteByte(s[i])
+				inWord = true
+			}
+		case '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(s[i+1 : i+1+j])
+			i += j + 1
+			inWord = true
+		case '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
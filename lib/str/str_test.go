@@ -0,0 +1,77 @@
+package str
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bmatsuo/lark/gluatest"
+)
+
+var luaStrTest = &gluatest.File{
+	Module: Module,
+	Path:   "str_test.lua",
+}
+
+func TestModule(t *testing.T) {
+	luaStrTest.Test(t)
+}
+
+func BenchmarkRequireModule(b *testing.B) {
+	file := &gluatest.File{Module: Module}
+	file.BenchmarkRequireModule(b)
+}
+
+func TestShellSplit(t *testing.T) {
+	for i, test := range []struct {
+		s     string
+		words []string
+		err   bool
+	}{
+		{"", nil, false},
+		{"  a  b\tc\n", []string{"a", "b", "c"}, false},
+		{`a 'b c' "d e"`, []string{"a", "b c", "d e"}, false},
+		{`'it'\''s'`, []string{"it's"}, false},
+		{`"a \"b\" \$HOME \x"`, []string{`a "b" $HOME \x`}, false},
+		{`a\ b c\\`, []string{"a b", `c\`}, false},
+		{"a\\\nb", []string{"ab"}, false},
+		{`'' ""`, []string{"", ""}, false},
+		{`x"y"'z'`, []string{"xyz"}, false},
+		{`$HOME *.go`, []string{"$HOME", "*.go"}, false},
+		{`'a`, nil, true},
+		{`"a`, nil, true},
+		{`a\`, nil, true},
+	} {
+		words, err := ShellSplit(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("test %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(words, test.words) {
+			t.Errorf("test %d: %q (expected %q)", i, words, test.words)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for i, args := range [][]string{
+		{"echo", "hello world"},
+		{"it's", `"quoted"`, `back\slash`},
+		{"", "$HOME", "*", "a\nb"},
+		{"-ldflags=-X main.version=1.0", "./cmd/..."},
+	} {
+		words, err := ShellSplit(ShellQuote(args))
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(words, args) {
+			t.Errorf("test %d: %q (expected %q)", i, words, args)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+local str = require('str')
+
+function test_shell_quote()
+    assert(str.shell_quote('echo') == 'echo')
+    assert(str.shell_quote('echo', 'hello world') == "echo 'hello world'")
+    assert(str.shell_quote({'a', {'b c', "it's"}}) == [[a 'b c' 'it'\''s']])
+    assert(str.shell_quote({'go', 'build', dir = 'x'}) == 'go build')
+    assert(str.shell_quote('') == "''")
+    assert(not pcall(str.shell_quote, 'a', 1))
+end
+
+function test_shell_split()
+    local words = str.shell_split([[go build -ldflags '-X main.v=1' "a b"]])
+    assert(#words == 5)
+    assert(words[4] == '-X main.v=1')
+    assert(words[5] == 'a b')
+    assert(#str.shell_split('') == 0)
+    assert(not pcall(str.shell_split, '"a'))
+end
+
+function test_split()
+    local parts = str.split('a.b.c', '.')
+    assert(#parts == 3)
+    assert(parts[2] == 'b')
+    parts = str.split('a.b.c', '.', 2)
+    assert(#parts == 2)
+    assert(parts[2] == 'b.c')
+end
+
+function test_trim()
+    assert(str.trim('  a b \n') == 'a b')
+    assert(str.trim('--a-', '-') == 'a')
+end
+
+function test_fields()
+    local fields = str.fields(' a  b\tc\n')
+    assert(#fields == 3)
+    assert(fields[3] == 'c')
+end
+
+function test_prefix_suffix()
+    assert(str.has_prefix('lark.lua', 'lark'))
+    assert(not str.has_prefix('lark.lua', '.lua'))
+    assert(str.has_suffix('lark.lua', '.lua'))
+    assert(not str.has_suffix('lark.lua', 'x.lua'))
+    assert(str.has_suffix('a.b', '.b'))
+    assert(not str.has_suffix('ab', '.b'))
+end
+
+function test_dedent()
+    assert(str.dedent('    a\n      b\n') == 'a\n  b\n')
+    assert(str.dedent('a\n  b') == 'a\n  b')
+end
+
+function test_wrap()
+    assert(str.wrap('aaa bbb ccc', 8) == 'aaa bbb\nccc')
+    assert(str.wrap('aaa bbb ccc') == 'aaa bbb ccc')
+end
@@ -0,0 +1,301 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/bmatsuo/lark/gluamodule"
+	"github.com/bmatsuo/lark/lib/doc"
+	"github.com/yuin/gopher-lua"
+)
+
+// Module is a gluamodule.Module that loads the template module.
+var Module = gluamodule.New("template", Loader,
+	doc.Module,
+)
+
+// Loader preloads the template module so that it can be required in lua
+// scripts.
+func Loader(l *lua.LState) int {
+	l.Pop(1) // first argument is the module name
+
+	mod := l.NewTable()
+	doc.Go(l, mod, &doc.Docs{
+		Desc: `
+		The template module renders Go text/template templates using Lua
+		values as data.  Tables with keys 1 through n are passed to templates
+		as lists, other tables are passed as maps with string keys.
+
+		In addition to the functions builtin to text/template, templates may
+		call the following functions.
+
+			upper s            Converts s to upper case
+			lower s            Converts s to lower case
+			trim s             Removes leading and trailing white space
+			replace old new s  Replaces each occurrence of old in s with new
+			split sep s        Splits s into a list of strings
+			join sep list      Joins a list of strings
+			default def x      Returns x, or def if x is empty or missing
+			indent n s         Indents each line of s with n spaces
+			json x             Encodes x as JSON
+		`,
+	})
+
+	set := func(name string, fn lua.LGFunction, docs *doc.Docs) {
+		lfn := l.NewClosure(fn)
+		doc.Go(l, lfn, docs)
+		l.SetField(mod, name, lfn)
+	}
+
+	set("render", LuaRender, &doc.Docs{
+		Sig:  "(tmpl, data) => string",
+		Desc: "Renders a template.",
+		Params: []string{
+			"tmpl  The template text",
+			"data  Optional value passed to the template as dot",
+		},
+	})
+	set("render_file", LuaRenderFile, &doc.Docs{
+		Sig:  "(path, data) => string",
+		Desc: "Renders the template contained in a file.",
+		Params: []string{
+			"path  The template file",
+			"data  Optional value passed to the template as dot",
+		},
+	})
+	set("render_to", LuaRenderTo, &doc.Docs{
+		Sig: "(path, tmpl, data) => bool",
+		Desc: `
+		Renders a template and writes the result to a file.  The file is only
+		written when its content changes, so its modification time is
+		preserved otherwise.  Returns true if the file was written.
+		`,
+		Params: []string{
+			"path  The file to write",
+			"tmpl  The template text",
+			"data  Optional value passed to the template as dot",
+		},
+	})
+
+	l.Push(mod)
+	return 1
+}
+
+// Exports defines the exported functions in the template module.
+var Exports = map[string]lua.LGFunction{
+	"render":      LuaRender,
+	"render_file": LuaRenderFile,
+	"render_to":   LuaRenderTo,
+}
+
+// LuaRender renders a template string.
+func LuaRender(state *lua.LState) int {
+	text := state.CheckString(1)
+	out, err := render(state, "template", text, state.Get(2))
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	state.Push(lua.LString(out))
+	return 1
+}
+
+// LuaRenderFile renders a template file.
+func LuaRenderFile(state *lua.LState) int {
+	path := state.CheckString(1)
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	out, err := render(state, filepath.Base(path), string(text), state.Get(2))
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	state.Push(lua.LString(out))
+	return 1
+}
+
+// LuaRenderTo renders a template to a file if the file content changes.
+func LuaRenderTo(state *lua.LState) int {
+	path := state.CheckString(1)
+	text := state.CheckString(2)
+	out, err := render(state, filepath.Base(path), text, state.Get(3))
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	written, err := WriteChanged(path, []byte(out))
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+		return 0
+	}
+	state.Push(lua.LBool(written))
+	return 1
+}
+
+// WriteChanged writes content to path unless the file already contains
+// content.  WriteChanged returns true if the file was written.
+func WriteChanged(path string, content []byte) (bool, error) {
+	old, err := ioutil.ReadFile(path)
+	if err == nil && bytes.Equal(old, content) {
+		return false, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	err = ioutil.WriteFile(path, content, 0644)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func render(state *lua.LState, name, text string, data lua.LValue) (string, error) {
+	tmpl, err := template.New(name).Funcs(Funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	v, err := goValue(data, make(map[*lua.LTable]bool))
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, v)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// goValue converts a lua value to the value passed to a template.
+func goValue(v lua.LValue, visited map[*lua.LTable]bool) (interface{}, error) {
+	switch v := v.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LString:
+		return string(v), nil
+	case lua.LNumber:
+		f := float64(v)
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int(f), nil
+		}
+		return f, nil
+	case *lua.LTable:
+		if visited[v] {
+			return nil, fmt.Errorf("table contains itself")
+		}
+		visited[v] = true
+		defer delete(visited, v)
+		return goTable(v, visited)
+	default:
+		return nil, fmt.Errorf("cannot pass %s to a template", v.Type())
+	}
+}
+
+func goTable(t *lua.LTable, visited map[*lua.LTable]bool) (interface{}, error) {
+	n := t.Len()
+	count := 0
+	t.ForEach(func(_, _ lua.LValue) { count++ })
+	if n > 0 && count == n {
+		list := make([]interface{}, n)
+		for i := range list {
+			x, err := goValue(t.RawGetInt(i+1), visited)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = x
+		}
+		return list, nil
+	}
+	m := make(map[string]interface{}, count)
+	var err error
+	t.ForEach(func(k, v lua.LValue) {
+		if err != nil {
+			return
+		}
+		var x interface{}
+		x, err = goValue(v, visited)
+		m[lua.LVAsString(k)] = x
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Funcs are the functions available to templates in addition to those
+// builtin to text/template.
+var Funcs = template.FuncMap{
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"trim":    strings.TrimSpace,
+	"replace": func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"split":   func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":    join,
+	"default": defaultValue,
+	"indent":  indent,
+	"json":    jsonString,
+}
+
+func join(sep string, list interface{}) (string, error) {
+	switch list := list.(type) {
+	case []string:
+		return strings.Join(list, sep), nil
+	case []interface{}:
+		s := make([]string, len(list))
+		for i, x := range list {
+			s[i] = fmt.Sprint(x)
+		}
+		return strings.Join(s, sep), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("join: not a list: %T", list)
+	}
+}
+
+func defaultValue(def, x interface{}) interface{} {
+	switch x := x.(type) {
+	case nil:
+		return def
+	case string:
+		if x == "" {
+			return def
+		}
+	case bool:
+		if !x {
+			return def
+		}
+	}
+	return x
+}
+
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func jsonString(x interface{}) (string, error) {
+	p, err := json.Marshal(x)
+	if err != nil {
+		return "", err
+	}
+	return string(p), nil
+}
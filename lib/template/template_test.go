@@ -0,0 +1,21 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/bmatsuo/lark/gluatest"
+)
+
+var luaTemplateTest = &gluatest.File{
+	Module: Module,
+	Path:   "template_test.lua",
+}
+
+func TestModule(t *testing.T) {
+	luaTemplateTest.Test(t)
+}
+
+func BenchmarkRequireModule(b *testing.B) {
+	file := &gluatest.File{Module: Module}
+	file.BenchmarkRequireModule(b)
+}
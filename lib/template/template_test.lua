@@ -0,0 +1,53 @@
+local template = require('template')
+
+local function read(path)
+    local f = io.open(path)
+    local content = f:read('*a')
+    f:close()
+    return content
+end
+
+function test_render()
+    assert(template.render('hello') == 'hello')
+    assert(template.render('{{.}}', 'x') == 'x')
+    assert(template.render('{{.name}} {{.n}}', {name = 'lark', n = 3}) == 'lark 3')
+    assert(template.render('{{if eq .n 3}}three{{end}}', {n = 3}) == 'three')
+    assert(template.render('{{range .}}[{{.}}]{{end}}', {1, 'a', true}) == '[1][a][true]')
+    assert(template.render('{{index .a 1}}', {a = {'x', 'y'}}) == 'y')
+    assert(not pcall(template.render, '{{.x'))
+    assert(not pcall(template.render, '{{.}}', print))
+end
+
+function test_funcs()
+    assert(template.render('{{upper .}}', 'abc') == 'ABC')
+    assert(template.render('{{lower .}}', 'ABC') == 'abc')
+    assert(template.render('{{trim .}}', ' a ') == 'a')
+    assert(template.render('{{replace "a" "b" .}}', 'aca') == 'bcb')
+    assert(template.render('{{join "," .}}', {1, 2}) == '1,2')
+    assert(template.render('{{split "," . | join ";"}}', 'a,b') == 'a;b')
+    assert(template.render('{{.x | default "none"}}', {}) == 'none')
+    assert(template.render('{{.x | default "none"}}', {x = 'y'}) == 'y')
+    assert(template.render('{{indent 2 .}}', 'a\nb') == '  a\n  b')
+    assert(template.render('{{json .}}', {a = {1}}) == '{"a":[1]}')
+end
+
+function test_render_file()
+    local path = os.tmpname()
+    local f = io.open(path, 'w')
+    f:write('v{{.version}}')
+    f:close()
+    assert(template.render_file(path, {version = '1.0'}) == 'v1.0')
+    os.remove(path)
+    assert(not pcall(template.render_file, path))
+end
+
+function test_render_to()
+    local path = os.tmpname()
+    os.remove(path)
+    assert(template.render_to(path, 'v{{.}}', '1.0') == true)
+    assert(read(path) == 'v1.0')
+    assert(template.render_to(path, 'v{{.}}', '1.0') == false)
+    assert(template.render_to(path, 'v{{.}}', '1.1') == true)
+    assert(read(path) == 'v1.1')
+    os.remove(path)
+end
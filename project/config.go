@@ -0,0 +1,419 @@
+package project
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ConfigFile contains possible names for the project configuration file, in
+// the project root.  Files with a .toml extension may only contain top-level
+// keys with string, integer, boolean, and string array values.
+var ConfigFile = []string{
+	".lark.toml",
+	"lark.json",
+}
+
+// UserConfigEnv is the environment variable that overrides the location of
+// the user configuration file.
+var UserConfigEnv = "LARK_CONFIG"
+
+// UserConfigFiles returns possible locations of the user configuration file.
+// If the environment variable named by UserConfigEnv is set its value is the
+// only location.
+func UserConfigFiles() []string {
+	path := os.Getenv(UserConfigEnv)
+	if path != "" {
+		return []string{path}
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return nil
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return []string{
+		filepath.Join(dir, "lark", "config.toml"),
+		filepath.Join(dir, "lark", "config.json"),
+	}
+}
+
+// Config setting types.
+const (
+	ConfigInt     = "int"
+	ConfigBool    = "bool"
+	ConfigString  = "string"
+	ConfigStrings = "strings"
+)
+
+// ConfigSetting describes a configurable setting.
+type ConfigSetting struct {
+	Name string
+	Type string
+	Desc string
+	// Env is an environment variable that overrides configuration files.
+	Env string
+}
+
+// ConfigSettings contains all configurable settings in the order they are
+// displayed.
+var ConfigSettings = []*ConfigSetting{
+	{"parallel", ConfigInt, "Number of parallel processes (0 uses the number of CPUs).", "LARK_RUN_PARALLEL"},
+	{"keep_going", ConfigBool, "Keep going after a task fails.", "LARK_RUN_KEEP_GOING"},
+	{"verbose", ConfigBool, "Enable verbose reporting of errors.", "LARK_VERBOSE"},
+	{"docs", ConfigBool, "Enable documentation of lua objects.", ""},
+	{"color", ConfigString, "Colored output: auto, always, or never.", ""},
+	{"lark_file", ConfigStrings, "Possible names of the primary lark file.", ""},
+	{"task_dir", ConfigString, "The auxiliary task directory.", ""},
+	{"module_dir", ConfigString, "The third-party module directory.", ""},
+	{"plugins", ConfigStrings, "Go plugins providing modules, relative to the project root.", ""},
+}
+
+func configSetting(name string) *ConfigSetting {
+	for _, s := range ConfigSettings {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// SourceDefault is the source of settings that were not configured.
+const SourceDefault = "default"
+
+// Config contains the effective value of each setting and the source that set
+// it.
+type Config struct {
+	values  map[string]interface{}
+	sources map[string]string
+}
+
+// NewConfig returns a Config containing default values.  Project layout
+// settings default to the current values of LarkFile, TaskDir, and ModuleDir.
+func NewConfig() *Config {
+	c := &Config{
+		values:  make(map[string]interface{}),
+		sources: make(map[string]string),
+	}
+	defaults := map[string]interface{}{
+		"parallel":   0,
+		"keep_going": false,
+		"verbose":    false,
+		"docs":       true,
+		"color":      "auto",
+		"lark_file":  append([]string(nil), LarkFile...),
+		"task_dir":   TaskDir,
+		"module_dir": ModuleDir,
+		"plugins":    []string{},
+	}
+	for name, v := range defaults {
+		c.values[name] = v
+		c.sources[name] = SourceDefault
+	}
+	return c
+}
+
+// Set sets the named value.  Values decoded from JSON or TOML are converted
+// to the setting's type.
+func (c *Config) Set(name string, v interface{}, source string) error {
+	s := configSetting(name)
+	if s == nil {
+		return fmt.Errorf("unknown setting: %s", name)
+	}
+	v, ok := convertSetting(s.Type, v)
+	if !ok {
+		return fmt.Errorf("setting %s is not of type %s", name, s.Type)
+	}
+	if name == "color" {
+		switch v {
+		case "auto", "always", "never":
+		default:
+			return fmt.Errorf("setting color is not auto, always, or never: %q", v)
+		}
+	}
+	c.values[name] = v
+	c.sources[name] = source
+	return nil
+}
+
+func convertSetting(typ string, v interface{}) (interface{}, bool) {
+	switch typ {
+	case ConfigInt:
+		switch v := v.(type) {
+		case int:
+			return v, true
+		case int64:
+			return int(v), true
+		case float64:
+			return int(v), v == float64(int(v))
+		}
+	case ConfigBool:
+		v, ok := v.(bool)
+		return v, ok
+	case ConfigString:
+		v, ok := v.(string)
+		return v, ok
+	case ConfigStrings:
+		switch v := v.(type) {
+		case []string:
+			return v, true
+		case []interface{}:
+			strs := make([]string, len(v))
+			for i := range v {
+				s, ok := v[i].(string)
+				if !ok {
+					return nil, false
+				}
+				strs[i] = s
+			}
+			return strs, true
+		}
+	}
+	return nil, false
+}
+
+// Int returns the value of an int setting.
+func (c *Config) Int(name string) int {
+	v, _ := c.values[name].(int)
+	return v
+}
+
+// Bool returns the value of a bool setting.
+func (c *Config) Bool(name string) bool {
+	v, _ := c.values[name].(bool)
+	return v
+}
+
+// String returns the value of a string setting.
+func (c *Config) String(name string) string {
+	v, _ := c.values[name].(string)
+	return v
+}
+
+// Strings returns the value of a strings setting.
+func (c *Config) Strings(name string) []string {
+	v, _ := c.values[name].([]string)
+	return v
+}
+
+// Value returns the value of the named setting formatted for display.
+func (c *Config) Value(name string) string {
+	switch v := c.values[name].(type) {
+	case []string:
+		return strings.Join(v, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Source returns the source of the named setting's value.
+func (c *Config) Source(name string) string {
+	return c.sources[name]
+}
+
+// ReadFile merges the settings in the configuration file at path into c.  The
+// file format is determined by its extension.
+func (c *Config) ReadFile(path string) error {
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var values map[string]interface{}
+	if filepath.Ext(path) == ".toml" {
+		values, err = parseTOML(p)
+	} else {
+		err = json.Unmarshal(p, &values)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for _, s := range ConfigSettings {
+		v, ok := values[s.Name]
+		if !ok {
+			continue
+		}
+		delete(values, s.Name)
+		err := c.Set(s.Name, v, path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	for name := range values {
+		return fmt.Errorf("%s: unknown setting: %s", path, name)
+	}
+	return nil
+}
+
+// ReadFirstFile merges the first existing file in paths into c.  The path of
+// the file is returned, or an empty string if no file exists.
+func (c *Config) ReadFirstFile(paths []string) (string, error) {
+	for _, path := range paths {
+		_, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return path, c.ReadFile(path)
+	}
+	return "", nil
+}
+
+// ReadEnv merges settings from their environment variables into c.
+// Environment variables with invalid values are ignored.
+func (c *Config) ReadEnv() {
+	for _, s := range ConfigSettings {
+		if s.Env == "" {
+			continue
+		}
+		env := os.Getenv(s.Env)
+		if env == "" {
+			continue
+		}
+		var v interface{}
+		var err error
+		switch s.Type {
+		case ConfigInt:
+			v, err = strconv.Atoi(env)
+		case ConfigBool:
+			v, err = strconv.ParseBool(env)
+		default:
+			v = env
+		}
+		if err == nil {
+			c.Set(s.Name, v, "$"+s.Env)
+		}
+	}
+}
+
+// Layout returns the project layout configured by c.
+func (c *Config) Layout() *Layout {
+	return &Layout{
+		LarkFile:  append([]string(nil), c.Strings("lark_file")...),
+		TaskDir:   c.String("task_dir"),
+		ModuleDir: c.String("module_dir"),
+	}
+}
+
+// ConfigFiles returns the possible locations of the configuration file of the
+// project in root.
+func ConfigFiles(root string) []string {
+	var paths []string
+	for _, name := range ConfigFile {
+		paths = append(paths, filepath.Join(root, name))
+	}
+	return paths
+}
+
+// LoadConfig returns the configuration of the project in root.  The user
+// configuration file is read first, followed by the project configuration
+// file and environment variables.
+func LoadConfig(root string) (*Config, error) {
+	c := NewConfig()
+	_, err := c.ReadFirstFile(UserConfigFiles())
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.ReadFirstFile(ConfigFiles(root))
+	if err != nil {
+		return nil, err
+	}
+	c.ReadEnv()
+	return c, nil
+}
+
+// parseTOML parses the subset of TOML used by configuration files: top-level
+// keys with string, integer, boolean, and single-line string array values.
+func parseTOML(p []byte) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	s := bufio.NewScanner(bytes.NewReader(p))
+	for lineno := 1; s.Scan(); lineno++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: tables are not supported", lineno)
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineno)
+		}
+		key := strings.TrimSpace(line[:i])
+		v, rest, err := parseTOMLValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineno, err)
+		}
+		rest = strings.TrimSpace(rest)
+		if rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("line %d: unexpected text after value: %q", lineno, rest)
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key: %s", lineno, key)
+		}
+		values[key] = v
+	}
+	return values, s.Err()
+}
+
+// parseTOMLValue parses a value at the beginning of s and returns it with the
+// remaining text.
+func parseTOMLValue(s string) (interface{}, string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+				continue
+			}
+			if s[i] == '"' {
+				str, err := strconv.Unquote(s[:i+1])
+				return str, s[i+1:], err
+			}
+		}
+		return nil, "", fmt.Errorf("unterminated string")
+	case strings.HasPrefix(s, "["):
+		var arr []interface{}
+		rest := strings.TrimSpace(s[1:])
+		for !strings.HasPrefix(rest, "]") {
+			v, r, err := parseTOMLValue(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			arr = append(arr, v)
+			rest = strings.TrimSpace(r)
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, "", fmt.Errorf("unterminated array")
+			}
+		}
+		return arr, rest[1:], nil
+	}
+
+	end := strings.IndexAny(s, " \t,]#")
+	if end < 0 {
+		end = len(s)
+	}
+	word, rest := s[:end], s[end:]
+	switch word {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	n, err := strconv.ParseInt(strings.Replace(word, "_", "", -1), 10, 64)
+	if err != nil {
+		return nil, "", fmt.Errorf("unsupported value: %q", word)
+	}
+	return n, rest, nil
+}
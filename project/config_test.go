@@ -0,0 +1,122 @@
+package project
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	values, err := parseTOML([]byte(`
+# comment
+parallel = 4 # trailing comment
+verbose = true
+color = "never"
+lark_file = ["build.lua", "x \"y\""]
+empty = []
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{
+		"parallel":  "4",
+		"verbose":   "true",
+		"color":     "never",
+		"lark_file": `[build.lua x "y"]`,
+		"empty":     "[]",
+	}
+	if len(values) != len(expect) {
+		t.Errorf("values: %v", values)
+	}
+	for k, v := range expect {
+		if fmt.Sprint(values[k]) != v {
+			t.Errorf("%s: %v (!= %v)", k, values[k], v)
+		}
+	}
+
+	for i, bad := range []string{
+		"[table]",
+		"x",
+		"x = \"unterminated",
+		"x = [1, 2",
+		"x = 1.5",
+		"x = 1 2",
+		"x = 1\nx = 2",
+	} {
+		_, err := parseTOML([]byte(bad))
+		if err == nil {
+			t.Errorf("bad %d: no error", i)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	root, err := ioutil.TempDir("", "lark-project-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"user.json":  `{"parallel": 2, "verbose": true}`,
+		".lark.toml": "parallel = 4\ntask_dir = \"tasks\"\n",
+		"bad.json":   `{"parallel": "many"}`,
+		"bad.toml":   `colour = "never"`,
+	})
+
+	conf := NewConfig()
+	if conf.Source("parallel") != SourceDefault {
+		t.Errorf("parallel source: %q", conf.Source("parallel"))
+	}
+	if conf.Strings("lark_file")[0] != LarkFile[0] {
+		t.Errorf("lark_file: %q", conf.Strings("lark_file"))
+	}
+
+	user := filepath.Join(root, "user.json")
+	path, err := conf.ReadFirstFile([]string{filepath.Join(root, "missing.json"), user})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != user {
+		t.Errorf("read file %q (!= %q)", path, user)
+	}
+	err = conf.ReadFile(filepath.Join(root, ".lark.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Int("parallel") != 4 {
+		t.Errorf("parallel: %d", conf.Int("parallel"))
+	}
+	if !conf.Bool("verbose") || conf.Source("verbose") != user {
+		t.Errorf("verbose: %v (%s)", conf.Bool("verbose"), conf.Source("verbose"))
+	}
+	if conf.String("task_dir") != "tasks" {
+		t.Errorf("task_dir: %q", conf.String("task_dir"))
+	}
+	if conf.Layout().TaskDir != "tasks" {
+		t.Errorf("layout task dir: %q", conf.Layout().TaskDir)
+	}
+	if TaskDir != "lark_tasks" {
+		t.Errorf("TaskDir modified: %q", TaskDir)
+	}
+
+	os.Setenv("LARK_RUN_PARALLEL", "8")
+	defer os.Setenv("LARK_RUN_PARALLEL", "")
+	conf.ReadEnv()
+	if conf.Int("parallel") != 8 || conf.Source("parallel") != "$LARK_RUN_PARALLEL" {
+		t.Errorf("parallel: %d (%s)", conf.Int("parallel"), conf.Source("parallel"))
+	}
+
+	for _, bad := range []string{"bad.json", "bad.toml"} {
+		err := conf.ReadFile(filepath.Join(root, bad))
+		if err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+	err = conf.Set("color", "sometimes", "test")
+	if err == nil {
+		t.Errorf("invalid color: no error")
+	}
+}
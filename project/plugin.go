@@ -0,0 +1,90 @@
+package project
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bmatsuo/lark/gluamodule"
+	"github.com/bmatsuo/lark/larkmeta"
+)
+
+// Symbols exported by plugins.  A plugin is a Go package main built with
+// "go build -buildmode=plugin" that declares the following variables.
+//
+//	var LarkVersion = larkmeta.Version
+//	var Modules = []gluamodule.Module{mymodule.Module}
+const (
+	PluginVersionSymbol = "LarkVersion"
+	PluginModulesSymbol = "Modules"
+)
+
+// LoadPlugins opens the Go plugins at paths and returns the modules they
+// export.  Relative paths are resolved against the project root dir.  An
+// error is returned if a plugin was built for an incompatible version of
+// lark.
+func LoadPlugins(dir string, paths []string) ([]gluamodule.Module, error) {
+	var modules []gluamodule.Module
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		version, mods, err := openPlugin(path)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %v", path, err)
+		}
+		if !CompatibleVersion(larkmeta.Version, version) {
+			return nil, fmt.Errorf("plugin %s: built for lark %s (running %s)", path, version, larkmeta.Version)
+		}
+		for _, m := range mods {
+			modules = append(modules, gluamodule.Resolve(m)...)
+		}
+	}
+	return modules, nil
+}
+
+// CompatibleVersion returns true if a plugin built for lark version plugin
+// can be loaded by lark version lark.  Major versions must be equal and the
+// plugin's minor version must not be greater than lark's.  Before version 1.0
+// minor versions must be equal.  Patch versions and prerelease suffixes are
+// ignored.
+func CompatibleVersion(lark, plugin string) bool {
+	lmajor, lminor, ok := parseVersion(lark)
+	if !ok {
+		return false
+	}
+	pmajor, pminor, ok := parseVersion(plugin)
+	if !ok {
+		return false
+	}
+	if lmajor != pmajor {
+		return false
+	}
+	if lmajor == 0 {
+		return lminor == pminor
+	}
+	return pminor <= lminor
+}
+
+// parseVersion returns the major and minor components of a version.
+func parseVersion(v string) (major, minor int, ok bool) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, 0, false
+	}
+	var err error
+	major, err = strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
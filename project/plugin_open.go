@@ -0,0 +1,35 @@
+//go:build (linux && cgo) || (darwin && cgo)
+// +build linux,cgo darwin,cgo
+
+package project
+
+import (
+	"fmt"
+	"plugin"
+
+	"github.com/bmatsuo/lark/gluamodule"
+)
+
+func openPlugin(path string) (string, []gluamodule.Module, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	sym, err := p.Lookup(PluginVersionSymbol)
+	if err != nil {
+		return "", nil, err
+	}
+	version, ok := sym.(*string)
+	if !ok {
+		return "", nil, fmt.Errorf("%s is not a string variable", PluginVersionSymbol)
+	}
+	sym, err = p.Lookup(PluginModulesSymbol)
+	if err != nil {
+		return "", nil, err
+	}
+	mods, ok := sym.(*[]gluamodule.Module)
+	if !ok {
+		return "", nil, fmt.Errorf("%s is not a []gluamodule.Module variable", PluginModulesSymbol)
+	}
+	return *version, *mods, nil
+}
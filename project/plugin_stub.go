@@ -0,0 +1,15 @@
+//go:build !cgo || (!linux && !darwin)
+// +build !cgo !linux,!darwin
+
+package project
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/bmatsuo/lark/gluamodule"
+)
+
+func openPlugin(path string) (string, []gluamodule.Module, error) {
+	return "", nil, fmt.Errorf("plugins are not supported on %s/%s (or without cgo)", runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,36 @@
+package project
+
+import (
+	"testing"
+)
+
+func TestCompatibleVersion(t *testing.T) {
+	for i, test := range []struct {
+		lark   string
+		plugin string
+		ok     bool
+	}{
+		{"0.5.0-dev", "0.5.0-dev", true},
+		{"0.5.1", "0.5.0", true},
+		{"0.5.0", "0.4.0", false},
+		{"0.4.0", "0.5.0", false},
+		{"1.2.0", "1.1.3", true},
+		{"1.1.0", "1.2.0", false},
+		{"2.0.0", "1.9.0", false},
+		{"v1.0", "1.0.0", true},
+		{"1.0.0", "X.Y.Z", false},
+		{"1.0.0", "", false},
+	} {
+		ok := CompatibleVersion(test.lark, test.plugin)
+		if ok != test.ok {
+			t.Errorf("test %d: CompatibleVersion(%q, %q) = %v (!= %v)", i, test.lark, test.plugin, ok, test.ok)
+		}
+	}
+}
+
+func TestLoadPlugins_missing(t *testing.T) {
+	_, err := LoadPlugins("/nonexistent", []string{"plugin.so"})
+	if err == nil {
+		t.Errorf("loaded missing plugin")
+	}
+}
@@ -1,7 +1,9 @@
 package project
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -26,10 +28,105 @@ var TaskDir = "lark_tasks"
 // a subdirectory of the project (root).
 var ModuleDir = "lark_modules"
 
+// Layout contains the names of the files and directories of a project.  The
+// package functions locating project files use DefaultLayout.
+type Layout struct {
+	// LarkFile contains possible names for the primary lark file.
+	LarkFile []string
+	// TaskDir is the auxiliary task directory.
+	TaskDir string
+	// ModuleDir is the third-party module directory.
+	ModuleDir string
+}
+
+// DefaultLayout returns the layout described by LarkFile, TaskDir, and
+// ModuleDir.
+func DefaultLayout() *Layout {
+	return &Layout{
+		LarkFile:  append([]string(nil), LarkFile...),
+		TaskDir:   TaskDir,
+		ModuleDir: ModuleDir,
+	}
+}
+
+// RootEnv is the environment variable that overrides the project root found
+// by FindRoot.
+var RootEnv = "LARK_ROOT"
+
+// ErrNoRoot is returned by FindRoot when no directory is a project root.
+var ErrNoRoot = errors.New("project root not found")
+
+// FindRoot locates the project root containing dir.  The project root is the
+// nearest directory, starting with dir and moving through its parents, that
+// contains a LarkFile or a ConfigFile.  If the environment variable named by
+// RootEnv is set its value is used as the project root instead.  The returned
+// path is absolute.
+func FindRoot(dir string) (string, error) {
+	return DefaultLayout().FindRoot(dir)
+}
+
+// FindRoot is like the package function FindRoot but looks for the lark files
+// of the layout.
+func (layout *Layout) FindRoot(dir string) (string, error) {
+	root := os.Getenv(RootEnv)
+	if root != "" {
+		return filepath.Abs(root)
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		ok, err := layout.IsRoot(dir)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrNoRoot
+		}
+		dir = parent
+	}
+}
+
+// IsRoot returns true if dir contains a LarkFile or a ConfigFile and is the
+// root of a project.
+func IsRoot(dir string) (bool, error) {
+	return DefaultLayout().IsRoot(dir)
+}
+
+// IsRoot is like the package function IsRoot but looks for the lark files of
+// the layout.
+func (layout *Layout) IsRoot(dir string) (bool, error) {
+	var names []string
+	names = append(names, layout.LarkFile...)
+	names = append(names, ConfigFile...)
+	for _, possible := range names {
+		_, err := os.Stat(filepath.Join(dir, possible))
+		if err == nil {
+			return true, nil
+		}
+		if !os.IsNotExist(err) {
+			return false, fmt.Errorf("%s: %s", possible, err)
+		}
+	}
+	return false, nil
+}
+
 // PackagePath returns the dir project LUA_PATH value, referencing only
 // ModuleDir inside dir.
 func PackagePath(dir string) string {
-	root := filepath.Join(dir, ModuleDir)
+	return DefaultLayout().PackagePath(dir)
+}
+
+// PackagePath is like the package function PackagePath but references the
+// ModuleDir of the layout.
+func (layout *Layout) PackagePath(dir string) string {
+	root := filepath.Join(dir, layout.ModuleDir)
 	luaFiles := filepath.Join(root, "?.lua")
 	luaInits := filepath.Join(root, "?", "init.lua")
 	return fmt.Sprintf("%s;%s", luaFiles, luaInits)
@@ -40,6 +137,11 @@ func SetPackagePath(l *lua.LState, dir string) error {
 	return SetPackagePathRaw(l, PackagePath(dir))
 }
 
+// SetPackagePath sets the package.path variable to layout.PackagePath(dir).
+func (layout *Layout) SetPackagePath(l *lua.LState, dir string) error {
+	return SetPackagePathRaw(l, layout.PackagePath(dir))
+}
+
 // SetPackagePathRaw sets the package.path variable to path.
 func SetPackagePathRaw(l *lua.LState, path string) error {
 	l.Push(l.NewFunction(func(l *lua.LState) int {
@@ -53,14 +155,25 @@ func SetPackagePathRaw(l *lua.LState, path string) error {
 	return l.PCall(1, 0, nil)
 }
 
-// FindTaskFiles locates task scripts in the project dir.  Task files under the
-// project TaskDir must be directly contained in the TaskDir and cannot be
-// nested in additional subdirectories.
+// FindTaskFiles locates task scripts in the project dir.  The LarkFile is
+// returned first, followed by the task files under the project TaskDir.  Task
+// files directly contained in a directory are returned in lexical order before
+// the files of its subdirectories, which are visited in lexical order.
+// Subdirectories with names beginning with "_" or "." are not visited, and
+// files with such names are excluded from subdirectories, allowing helper
+// scripts to be kept in the TaskDir.  Every lua file directly contained in
+// the TaskDir is returned.
 func FindTaskFiles(dir string) ([]string, error) {
+	return DefaultLayout().FindTaskFiles(dir)
+}
+
+// FindTaskFiles is like the package function FindTaskFiles but locates the
+// files of the layout.
+func (layout *Layout) FindTaskFiles(dir string) ([]string, error) {
 	var luaFiles []string
 	join := filepath.Join
 
-	for _, possible := range LarkFile {
+	for _, possible := range layout.LarkFile {
 		path := join(dir, possible)
 		_, err := os.Stat(path)
 		if os.IsNotExist(err) {
@@ -73,27 +186,140 @@ func FindTaskFiles(dir string) ([]string, error) {
 		break
 	}
 
-	subpatt := join(dir, TaskDir, "*.lua")
-	files, err := filepath.Glob(subpatt)
+	files, err := findTaskDirFiles(join(dir, layout.TaskDir), true, nil)
 	luaFiles = append(luaFiles, files...)
-	if err != nil {
-		return nil, fmt.Errorf("%s: %v", TaskDir, err)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %v", layout.TaskDir, err)
 	}
 
 	return luaFiles, nil
 }
 
-// FindModules locates modules in the ModuleDir of project dir.
-// The modules names returned by FindModules match what would be
-// passed to Lua's require() function.
+// findTaskDirFiles appends the task files in dir and its subdirectories to
+// luaFiles.  Names beginning with "_" or "." are excluded unless they are
+// files and top is true.
+func findTaskDirFiles(dir string, top bool, luaFiles []string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return luaFiles, err
+	}
+	var subdirs []string
+	for _, info := range infos {
+		name := info.Name()
+		hidden := strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".")
+		if hidden && (info.IsDir() || !top) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if info.IsDir() {
+			subdirs = append(subdirs, path)
+			continue
+		}
+		if filepath.Ext(name) == ".lua" {
+			luaFiles = append(luaFiles, path)
+		}
+	}
+	for _, subdir := range subdirs {
+		luaFiles, err = findTaskDirFiles(subdir, false, luaFiles)
+		if err != nil {
+			return luaFiles, err
+		}
+	}
+	return luaFiles, nil
+}
+
+// TaskNamespace returns the namespace for tasks defined in the task file at
+// path in project dir.  Files under the TaskDir are namespaced by their slash
+// separated path relative to the TaskDir without the .lua extension (e.g.
+// "ci/build").  Files outside the TaskDir (e.g. the LarkFile) have no
+// namespace and an empty string is returned.
+func TaskNamespace(dir, path string) string {
+	return DefaultLayout().TaskNamespace(dir, path)
+}
+
+// TaskNamespace is like the package function TaskNamespace but uses the
+// TaskDir of the layout.
+func (layout *Layout) TaskNamespace(dir, path string) string {
+	rel := layout.taskRel(dir, path)
+	if rel == "" {
+		return ""
+	}
+	ext := filepath.Ext(rel)
+	return filepath.ToSlash(rel[:len(rel)-len(ext)])
+}
+
+// TaskDirNamespace returns the namespace for tasks defined in the task file
+// at path in project dir when tasks are namespaced by directory.  Files in a
+// subdirectory of the TaskDir are namespaced by the slash separated path of
+// the subdirectory relative to the TaskDir (e.g. "ci").  Files directly under
+// the TaskDir and outside it have no namespace and an empty string is
+// returned.
+func TaskDirNamespace(dir, path string) string {
+	return DefaultLayout().TaskDirNamespace(dir, path)
+}
+
+// TaskDirNamespace is like the package function TaskDirNamespace but uses the
+// TaskDir of the layout.
+func (layout *Layout) TaskDirNamespace(dir, path string) string {
+	rel := layout.taskRel(dir, path)
+	if rel == "" {
+		return ""
+	}
+	reldir := filepath.Dir(rel)
+	if reldir == "." {
+		return ""
+	}
+	return filepath.ToSlash(reldir)
+}
+
+// taskRel returns path relative to the TaskDir of project dir, or an empty
+// string if path is not in the TaskDir.
+func (layout *Layout) taskRel(dir, path string) string {
+	dir, err := filepath.Abs(filepath.Join(dir, layout.TaskDir))
+	if err != nil {
+		return ""
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return rel
+}
+
+// ModuleFile is a lua file in the ModuleDir of a project.
+type ModuleFile struct {
+	// Name is the name passed to require() to load the module.  Name is empty
+	// for an init.lua file directly under the ModuleDir, which cannot be
+	// loaded.
+	Name string
+	// Path is the location of the file.
+	Path string
+}
+
+// FindModuleFiles locates all lua files in the ModuleDir of project dir,
+// sorted by path.  FindModuleFiles does not check the files for problems,
+// use ModuleProblems.
 //
 // BUG:
 // Handling of symbolic links is undefined.
-func FindModules(dir string) ([]string, error) {
-	var modules []string
-	root := filepath.Join(dir, ModuleDir)
-	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+func FindModuleFiles(dir string) ([]*ModuleFile, error) {
+	return DefaultLayout().FindModuleFiles(dir)
+}
+
+// FindModuleFiles is like the package function FindModuleFiles but searches
+// the ModuleDir of the layout.
+func (layout *Layout) FindModuleFiles(dir string) ([]*ModuleFile, error) {
+	var files []*ModuleFile
+	root := filepath.Join(dir, layout.ModuleDir)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
+			if path == root && os.IsNotExist(err) {
+				return nil
+			}
 			return err
 		}
 		if info.IsDir() {
@@ -108,23 +334,46 @@ func FindModules(dir string) ([]string, error) {
 			return err
 		}
 
+		mpath := relpath[:len(relpath)-4] // trim .lua extension
 		if filepath.Base(path) == "init.lua" {
-			if filepath.Dir(path) == root {
-				return fmt.Errorf("directory %s cannot be a module: %s", ModuleDir, path)
+			mpath = filepath.Dir(relpath)
+			if mpath == "." {
+				mpath = ""
 			}
-
-			mpath := filepath.Dir(relpath)
-			m := strings.Replace(mpath, pathSeparator, ".", -1)
-			modules = append(modules, m)
-
-			return nil
 		}
-
-		mpath := relpath[:len(relpath)-4] // trim .lua extension
 		m := strings.Replace(mpath, pathSeparator, ".", -1)
-		modules = append(modules, m)
+		files = append(files, &ModuleFile{Name: m, Path: path})
 
 		return nil
 	})
-	return nil, nil
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// ModuleProblems returns an error for each file in files which cannot be
+// loaded with require() as expected.  An init.lua file directly under the
+// ModuleDir cannot be a module, and a module foo.lua conflicts with a module
+// foo/init.lua.
+func ModuleProblems(files []*ModuleFile) []error {
+	var errs []error
+	paths := make(map[string][]string)
+	var names []string
+	for _, f := range files {
+		if f.Name == "" {
+			errs = append(errs, fmt.Errorf("directory %s cannot be a module: %s", ModuleDir, f.Path))
+			continue
+		}
+		if paths[f.Name] == nil {
+			names = append(names, f.Name)
+		}
+		paths[f.Name] = append(paths[f.Name], f.Path)
+	}
+	for _, name := range names {
+		if len(paths[name]) > 1 {
+			errs = append(errs, fmt.Errorf("module %s is defined by multiple files: %s", name, strings.Join(paths[name], ", ")))
+		}
+	}
+	return errs
 }
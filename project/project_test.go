@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
 )
 
@@ -56,6 +57,62 @@ func TestFindTaskFiles_precedence(t *testing.T) {
 	}
 }
 
+func TestFindRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "lark-project-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := filepath.Join(root, "cmd", "lark")
+	os.MkdirAll(sub, 0755)
+	err = ioutil.WriteFile(filepath.Join(root, "lark.lua"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv(RootEnv, "")
+	for _, dir := range []string{root, sub, filepath.Dir(sub)} {
+		found, err := FindRoot(dir)
+		if err != nil {
+			t.Errorf("dir %q: %v", dir, err)
+		} else if found != root {
+			t.Errorf("dir %q: root %q (!= %q)", dir, found, root)
+		}
+	}
+
+	os.Setenv(RootEnv, sub)
+	defer os.Setenv(RootEnv, "")
+	found, err := FindRoot(root)
+	if err != nil {
+		t.Error(err)
+	} else if found != sub {
+		t.Errorf("override root %q (!= %q)", found, sub)
+	}
+}
+
+func TestIsRoot_layout(t *testing.T) {
+	// IsRoot must not write into spare capacity of the layout variables.
+	larkFile := LarkFile
+	defer func() { LarkFile = larkFile }()
+	LarkFile = make([]string, 1, 4)
+	LarkFile[0] = "lark.lua"
+
+	_, err := IsRoot(os.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range LarkFile[:cap(LarkFile)] {
+		if i > 0 && name != "" {
+			t.Errorf("LarkFile backing array modified at index %d: %q", i, name)
+		}
+	}
+}
+
 func TestFindTaskFiles_TaskDir(t *testing.T) {
 	root, err := ioutil.TempDir("", "lark-project-test")
 	if err != nil {
@@ -113,3 +170,136 @@ func TestFindTaskFiles_TaskDir(t *testing.T) {
 		}
 	}
 }
+
+func TestTaskNamespace(t *testing.T) {
+	for i, test := range []struct {
+		dir  string
+		path string
+		ns   string
+	}{
+		{".", "lark.lua", ""},
+		{".", filepath.Join(TaskDir, "release.lua"), "release"},
+		{"", filepath.Join(TaskDir, "release.lua"), "release"},
+		{"x", filepath.Join("x", TaskDir, "db.lua"), "db"},
+		{"x", filepath.Join(TaskDir, "db.lua"), ""},
+		{".", filepath.Join(TaskDir, "ci", "build.lua"), "ci/build"},
+	} {
+		ns := TaskNamespace(test.dir, test.path)
+		if ns != test.ns {
+			t.Errorf("test %d: namespace %q (!= %q)", i, ns, test.ns)
+		}
+	}
+}
+
+func TestTaskDirNamespace(t *testing.T) {
+	for i, test := range []struct {
+		dir  string
+		path string
+		ns   string
+	}{
+		{".", "lark.lua", ""},
+		{".", filepath.Join(TaskDir, "release.lua"), ""},
+		{".", filepath.Join(TaskDir, "ci", "build.lua"), "ci"},
+		{"x", filepath.Join("x", TaskDir, "ci", "docker", "push.lua"), "ci/docker"},
+	} {
+		ns := TaskDirNamespace(test.dir, test.path)
+		if ns != test.ns {
+			t.Errorf("test %d: namespace %q (!= %q)", i, ns, test.ns)
+		}
+	}
+}
+
+func TestFindTaskFiles_nested(t *testing.T) {
+	root, err := ioutil.TempDir("", "lark-project-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	luaFiles := []string{
+		// files directly in the TaskDir are never excluded.
+		filepath.Join(TaskDir, ".dot.lua"),
+		filepath.Join(TaskDir, "_helper.lua"),
+		filepath.Join(TaskDir, "b.lua"),
+		filepath.Join(TaskDir, "z.lua"),
+		filepath.Join(TaskDir, "ci", "build.lua"),
+		filepath.Join(TaskDir, "ci", "docker", "push.lua"),
+		filepath.Join(TaskDir, "release", "a.lua"),
+	}
+	excluded := []string{
+		filepath.Join(TaskDir, "ci", "_helper.lua"),
+		filepath.Join(TaskDir, "ci", ".dot.lua"),
+		filepath.Join(TaskDir, "_lib", "util.lua"),
+		filepath.Join(TaskDir, ".hidden", "x.lua"),
+		filepath.Join(TaskDir, "ci", "notes.txt"),
+	}
+
+	for _, f := range append(luaFiles, excluded...) {
+		path := filepath.Join(root, f)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		err := ioutil.WriteFile(path, nil, 0644)
+		if err != nil {
+			t.Errorf("file %s: %v", f, err)
+		}
+	}
+
+	files, err := FindTaskFiles(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(luaFiles) {
+		t.Fatalf("found %d task files: %q", len(files), files)
+	}
+	for i, f := range luaFiles {
+		expect := filepath.Join(root, f)
+		if files[i] != expect {
+			t.Errorf("task file at index %d: %q (!= %q)", i, files[i], expect)
+		}
+	}
+}
+
+func TestFindModuleFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "lark-project-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"lark_modules/b.lua":          "",
+		"lark_modules/a/init.lua":     "",
+		"lark_modules/a/x.lua":        "",
+		"lark_modules/a/y/init.lua":   "",
+		"lark_modules/a/y/README.txt": "",
+	})
+
+	files, err := FindModuleFiles(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var modules []string
+	for _, f := range files {
+		modules = append(modules, f.Name)
+	}
+	sort.Strings(modules)
+	expect := []string{"a", "a.x", "a.y", "b"}
+	if fmt.Sprint(modules) != fmt.Sprint(expect) {
+		t.Errorf("modules: %q (!= %q)", modules, expect)
+	}
+	if problems := ModuleProblems(files); len(problems) != 0 {
+		t.Errorf("problems: %q", problems)
+	}
+
+	writeTestFiles(t, root, map[string]string{
+		"lark_modules/b/init.lua": "",
+		"lark_modules/init.lua":   "",
+	})
+	files, err = FindModuleFiles(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := ModuleProblems(files)
+	if len(problems) != 2 {
+		t.Errorf("problems: %q", problems)
+	}
+}
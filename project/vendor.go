@@ -0,0 +1,512 @@
+package project
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ModFile is the manifest of vendored third-party modules, a JSON file in the
+// project root.
+var ModFile = "lark_modules.json"
+
+// ModLockFile records the vendored state of the modules in ModFile, a JSON
+// file in the project root.
+var ModLockFile = "lark_modules.lock"
+
+// Module source types.
+const (
+	ModTypeDir  = "dir"
+	ModTypeFile = "file"
+	ModTypeTar  = "tar"
+	ModTypeGit  = "git"
+)
+
+// ModManifest is the content of a ModFile.
+type ModManifest struct {
+	Modules []*ModSource `json:"modules"`
+}
+
+// ModSource describes where a vendored module comes from.
+type ModSource struct {
+	// Name is the name passed to require() to load the module, Lua
+	// identifiers separated by dots (e.g. "util.strings").
+	Name string `json:"name"`
+	// Source is a local path to a directory, a lua file, a tarball (.tar,
+	// .tar.gz, or .tgz), or a git repository.  Relative paths are relative
+	// to the project root.
+	Source string `json:"source"`
+	// Type is the type of Source.  When empty the type is inferred from
+	// Source and Ref.
+	Type string `json:"type,omitempty"`
+	// Ref is the git revision to vendor.  Ref defaults to HEAD for git
+	// sources and is invalid for other types.
+	Ref string `json:"ref,omitempty"`
+	// Path is the subdirectory of the source containing the module.
+	Path string `json:"path,omitempty"`
+}
+
+// ModLock is the content of a ModLockFile.
+type ModLock struct {
+	Modules []*LockedMod `json:"modules"`
+}
+
+// LockedMod records a module vendored into the project ModuleDir.
+type LockedMod struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Type   string `json:"type"`
+	Ref    string `json:"ref,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	// Path is the vendored file or directory, relative to ModuleDir.
+	Path string `json:"path"`
+	// Hash is the content hash of Path computed by HashModule.
+	Hash string `json:"hash"`
+}
+
+// reModName matches valid module names, Lua identifiers separated by dots.
+var reModName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// ReadModManifest reads the ModFile of project dir.
+func ReadModManifest(dir string) (*ModManifest, error) {
+	m := &ModManifest{}
+	err := readJSON(filepath.Join(dir, ModFile), m)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for i, src := range m.Modules {
+		if src.Name == "" {
+			return nil, fmt.Errorf("%s: module %d: missing name", ModFile, i)
+		}
+		if !reModName.MatchString(src.Name) {
+			return nil, fmt.Errorf("%s: module %d: invalid name: %q", ModFile, i, src.Name)
+		}
+		if src.Source == "" {
+			return nil, fmt.Errorf("%s: module %s: missing source", ModFile, src.Name)
+		}
+		if seen[src.Name] {
+			return nil, fmt.Errorf("%s: module %s: duplicate name", ModFile, src.Name)
+		}
+		seen[src.Name] = true
+	}
+	return m, nil
+}
+
+// ReadModLock reads the ModLockFile of project dir.
+func ReadModLock(dir string) (*ModLock, error) {
+	lock := &ModLock{}
+	err := readJSON(filepath.Join(dir, ModLockFile), lock)
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// WriteModLock writes lock to the ModLockFile of project dir.
+func WriteModLock(dir string, lock *ModLock) error {
+	p, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	p = append(p, '\n')
+	return ioutil.WriteFile(filepath.Join(dir, ModLockFile), p, 0644)
+}
+
+func readJSON(path string, v interface{}) error {
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(p, v)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// Vendor copies the modules in m into the ModuleDir of project dir and
+// returns a lock describing the vendored modules.  Existing files for the
+// vendored modules are replaced.  Vendor does not write the ModLockFile.
+func Vendor(dir string, m *ModManifest) (*ModLock, error) {
+	return DefaultLayout().Vendor(dir, m)
+}
+
+// Vendor is like the package function Vendor but copies modules into the
+// ModuleDir of the layout.
+func (layout *Layout) Vendor(dir string, m *ModManifest) (*ModLock, error) {
+	lock := &ModLock{}
+	for _, src := range m.Modules {
+		locked, err := vendorModule(dir, layout.ModuleDir, src)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %v", src.Name, err)
+		}
+		lock.Modules = append(lock.Modules, locked)
+	}
+	return lock, nil
+}
+
+func vendorModule(dir, moduleDir string, src *ModSource) (*LockedMod, error) {
+	if !reModName.MatchString(src.Name) {
+		return nil, fmt.Errorf("invalid name: %q", src.Name)
+	}
+	typ, err := sourceType(dir, src)
+	if err != nil {
+		return nil, err
+	}
+	locked := &LockedMod{
+		Name:   src.Name,
+		Source: src.Source,
+		Type:   typ,
+		Ref:    src.Ref,
+	}
+
+	tmp, err := ioutil.TempDir("", "lark-mod-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	source := src.Source
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(dir, source)
+	}
+	fetched := filepath.Join(tmp, "src")
+	switch typ {
+	case ModTypeDir:
+		err = copyTree(source, fetched)
+	case ModTypeFile:
+		err = copyFile(source, fetched)
+	case ModTypeTar:
+		err = extractTarFile(source, fetched)
+	case ModTypeGit:
+		locked.Commit, err = fetchGit(source, src.Ref, fetched)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	modpath := filepath.Join(strings.Split(src.Name, ".")...)
+	if typ == ModTypeFile {
+		modpath += ".lua"
+	} else if src.Path != "" {
+		fetched = filepath.Join(fetched, filepath.FromSlash(src.Path))
+		_, err := os.Stat(fetched)
+		if err != nil {
+			return nil, fmt.Errorf("path %s: %v", src.Path, err)
+		}
+	}
+	locked.Path = filepath.ToSlash(modpath)
+
+	locked.Hash, err = HashModule(fetched)
+	if err != nil {
+		return nil, err
+	}
+
+	dest := filepath.Join(dir, moduleDir, modpath)
+	err = os.RemoveAll(dest)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return nil, err
+	}
+	if typ == ModTypeFile {
+		err = copyFile(fetched, dest)
+	} else {
+		err = copyTree(fetched, dest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return locked, nil
+}
+
+// sourceType returns the type of src, inferring it when necessary.
+func sourceType(dir string, src *ModSource) (string, error) {
+	typ := src.Type
+	if typ == "" {
+		typ = inferSourceType(dir, src)
+	}
+	switch typ {
+	case ModTypeDir, ModTypeFile, ModTypeTar:
+		if src.Ref != "" {
+			return "", fmt.Errorf("ref given for %s source", typ)
+		}
+	case ModTypeGit:
+	default:
+		return "", fmt.Errorf("unknown source type: %q", typ)
+	}
+	if typ == ModTypeFile && src.Path != "" {
+		return "", fmt.Errorf("path given for %s source", typ)
+	}
+	return typ, nil
+}
+
+func inferSourceType(dir string, src *ModSource) string {
+	source := src.Source
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(dir, source)
+	}
+	switch {
+	case src.Ref != "" || strings.HasSuffix(source, ".git"):
+		return ModTypeGit
+	case isTarball(source):
+		return ModTypeTar
+	case filepath.Ext(source) == ".lua":
+		return ModTypeFile
+	}
+	return ModTypeDir
+}
+
+func isTarball(path string) bool {
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyModules checks the vendored modules in the ModuleDir of project dir
+// against lock.  An error describing every module that is missing or
+// modified is returned.
+func VerifyModules(dir string, lock *ModLock) error {
+	return DefaultLayout().VerifyModules(dir, lock)
+}
+
+// VerifyModules is like the package function VerifyModules but checks the
+// ModuleDir of the layout.
+func (layout *Layout) VerifyModules(dir string, lock *ModLock) error {
+	var bad []string
+	for _, locked := range lock.Modules {
+		path := filepath.Join(dir, layout.ModuleDir, filepath.FromSlash(locked.Path))
+		hash, err := HashModule(path)
+		if os.IsNotExist(err) {
+			bad = append(bad, fmt.Sprintf("%s: missing", locked.Name))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if hash != locked.Hash {
+			bad = append(bad, fmt.Sprintf("%s: modified", locked.Name))
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("vendored modules do not match %s: %s", ModLockFile, strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+// HashModule returns the content hash of the module file or directory at
+// path.  The hash covers the relative path and content of every regular file
+// under path.
+func HashModule(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	files := []string{""}
+	if info.IsDir() {
+		files, err = treeFiles(path)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	h := sha256.New()
+	for _, rel := range files {
+		f, err := os.Open(filepath.Join(path, filepath.FromSlash(rel)))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00", rel)
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, "\x00")
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// treeFiles returns the sorted, slash separated paths of the regular files
+// under root.
+func treeFiles(root string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+func copyTree(src, dest string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		target := filepath.Join(dest, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dest string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func extractTarFile(path, dest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if !strings.HasSuffix(path, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return extractTar(r, dest)
+}
+
+func extractTar(r io.Reader, dest string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+pathSeparator) {
+			return fmt.Errorf("archive path outside of module: %s", hdr.Name)
+		}
+		target := filepath.Join(dest, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg, tar.TypeRegA:
+			err = os.MkdirAll(filepath.Dir(target), 0755)
+			if err != nil {
+				return err
+			}
+			err = writeTarFile(tr, target, os.FileMode(hdr.Mode).Perm())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeTarFile(r io.Reader, path string, mode os.FileMode) error {
+	w, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// fetchGit extracts ref from the git repository at repo into dest and returns
+// the commit ref refers to.
+func fetchGit(repo, ref, dest string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	out, err := git(repo, "rev-parse", "--verify", ref+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	commit := strings.TrimSpace(string(out))
+	out, err = git(repo, "archive", "--format=tar", commit)
+	if err != nil {
+		return "", err
+	}
+	err = extractTar(bytes.NewReader(out), dest)
+	if err != nil {
+		return "", err
+	}
+	return commit, nil
+}
+
+func git(repo string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repo
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %v", args[0], err)
+	}
+	return out, nil
+}
@@ -0,0 +1,156 @@
+package project
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		err := ioutil.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("file %s: %v", name, err)
+		}
+	}
+}
+
+func TestVendor(t *testing.T) {
+	root, err := ioutil.TempDir("", "lark-project-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"shared/init.lua":     "return {}",
+		"shared/sub/x.lua":    "return 1",
+		"single.lua":          "return 2",
+		"tarsrc/src/init.lua": "return 3",
+		"p/lark.lua":          "",
+		"p/lark_modules.json": `{"modules": [
+			{"name": "shared", "source": "../shared"},
+			{"name": "a.single", "source": "../single.lua"},
+			{"name": "tarmod", "source": "../mod.tar", "path": "src"}
+		]}`,
+	})
+
+	f, err := os.Create(filepath.Join(root, "mod.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	content := "return 3"
+	tw.WriteHeader(&tar.Header{Name: "src/init.lua", Mode: 0644, Size: int64(len(content))})
+	tw.Write([]byte(content))
+	tw.Close()
+	f.Close()
+
+	dir := filepath.Join(root, "p")
+	m, err := ReadModManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err := Vendor(dir, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WriteModLock(dir, lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]string{
+		"shared/init.lua":  "return {}",
+		"shared/sub/x.lua": "return 1",
+		"a/single.lua":     "return 2",
+		"tarmod/init.lua":  "return 3",
+	}
+	for name, content := range expect {
+		p, err := ioutil.ReadFile(filepath.Join(dir, ModuleDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if string(p) != content {
+			t.Errorf("%s: content %q (!= %q)", name, p, content)
+		}
+	}
+
+	lock, err = ReadModLock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Modules) != 3 {
+		t.Fatalf("locked %d modules", len(lock.Modules))
+	}
+	hash, err := HashModule(filepath.Join(root, "tarsrc", "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Modules[2].Hash != hash {
+		t.Errorf("tarmod hash: %q (!= %q)", lock.Modules[2].Hash, hash)
+	}
+
+	err = VerifyModules(dir, lock)
+	if err != nil {
+		t.Error(err)
+	}
+
+	writeTestFiles(t, dir, map[string]string{
+		"lark_modules/shared/sub/y.lua": "return 4",
+	})
+	os.Remove(filepath.Join(dir, ModuleDir, "a", "single.lua"))
+	err = VerifyModules(dir, lock)
+	if err == nil {
+		t.Fatalf("verified modified modules")
+	}
+	for _, msg := range []string{"shared: modified", "a.single: missing"} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("error does not contain %q: %v", msg, err)
+		}
+	}
+}
+
+func TestReadModManifest_invalid(t *testing.T) {
+	root, err := ioutil.TempDir("", "lark-project-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for i, manifest := range []string{
+		`{"modules": [{"source": "x"}]}`,
+		`{"modules": [{"name": "x"}]}`,
+		`{"modules": [{"name": "x", "source": "a"}, {"name": "x", "source": "b"}]}`,
+		`{"modules": [{"name": ".", "source": "x"}]}`,
+		`{"modules": [{"name": "..", "source": "x"}]}`,
+		`{"modules": [{"name": "a..b", "source": "x"}]}`,
+		`{"modules": [{"name": "a/b", "source": "x"}]}`,
+		`{"modules": [{"name": "1a", "source": "x"}]}`,
+		`{"modules": `,
+	} {
+		writeTestFiles(t, root, map[string]string{ModFile: manifest})
+		_, err := ReadModManifest(root)
+		if err == nil {
+			t.Errorf("manifest %d: no error", i)
+		}
+	}
+
+	// Vendor does not remove the module directory for an invalid name.
+	writeTestFiles(t, root, map[string]string{
+		"lark_modules/keep.lua": "return 1",
+		"x.lua":                 "return 2",
+	})
+	_, err = Vendor(root, &ModManifest{Modules: []*ModSource{{Name: "..", Source: "x.lua"}}})
+	if err == nil {
+		t.Errorf("vendored an invalid name")
+	}
+	_, err = os.Stat(filepath.Join(root, "lark_modules", "keep.lua"))
+	if err != nil {
+		t.Errorf("module directory modified: %v", err)
+	}
+}
@@ -0,0 +1,574 @@
+/*
+Package runner loads lark projects and runs their tasks from Go programs.
+
+	p, err := runner.Load(dir, &runner.Options{Stdout: &buf})
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+	err = p.Run(ctx, "build", map[string]string{"os": "linux"})
+
+Each Project has its own Lua state and its own instance of the lark.core
+module, so commands executed by different projects do not share a parallelism
+limit or output.  A Project does not change the working directory of the
+process.  Commands executed by tasks run in the project root, but other
+relative paths used by tasks (e.g. with io.open) are resolved against the
+working directory of the process.  Subprojects loaded with lark.subproject()
+share the lark.core instance and options of the project that loaded them.  If
+Options.Chdir is set the working directory is changed to the root of a
+subproject while it is loaded and while its tasks run.
+*/
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatsuo/lark/gluamodule"
+	"github.com/bmatsuo/lark/lib"
+	"github.com/bmatsuo/lark/lib/doc"
+	"github.com/bmatsuo/lark/lib/fs"
+	"github.com/bmatsuo/lark/lib/lark/core"
+	"github.com/bmatsuo/lark/lib/lark/task"
+	"github.com/bmatsuo/lark/project"
+	"github.com/yuin/gopher-lua"
+)
+
+// Options configure a Project.
+type Options struct {
+	// Stdout receives the output of the Lua print function and of commands
+	// that is not redirected.  If nil os.Stdout is used.
+	Stdout io.Writer
+	// Stderr receives the error output of commands that is not redirected.
+	// If nil os.Stderr is used.
+	Stderr io.Writer
+	// Log receives messages logged by lark (e.g. commands as they are
+	// executed).  If nil os.Stderr is used.
+	Log io.Writer
+
+	// Parallel is the number of commands that may execute concurrently.  If
+	// zero the number of CPUs is used.
+	Parallel int
+	// Modules are preloaded into the Lua state in addition to the builtin
+	// modules.
+	Modules []gluamodule.Module
+	// Plugins contains the paths of Go plugins whose modules are preloaded
+	// (see project.LoadPlugins).  Relative paths are resolved against the
+	// project root.  Subprojects use the plugins configured by their own
+	// configuration files.
+	Plugins []string
+	// Overrides contains global variable values that are set after project
+	// files are loaded (see lark.var).  Overrides also apply to subprojects.
+	Overrides map[string]string
+	// InvocationDir is the value of lark.invocation_dir.  If empty the
+	// working directory of the process is used.
+	InvocationDir string
+	// Layout is the layout of the project.  If nil Load uses the layout
+	// configured by the project configuration files (see project.LoadConfig)
+	// and Init uses project.DefaultLayout.  Subprojects use the layout
+	// configured by their own configuration files.
+	Layout *project.Layout
+	// Color is "always" or "never" to override the detection of a terminal
+	// for colored log output.
+	Color string
+	// Chdir changes the working directory of the process to the root of a
+	// subproject while it is loaded and while lark.subproject() runs its
+	// tasks, so relative paths are resolved as if lark ran in the subproject.
+	// The working directory is shared by every goroutine, so Chdir should
+	// only be set by programs that run one project at a time.
+	Chdir bool
+
+	Verbose     bool
+	KeepGoing   bool
+	DisableDocs bool
+}
+
+// Project is a lark project loaded into a Lua state.  A Project is not safe
+// for concurrent use.
+type Project struct {
+	// Root is the absolute path of the project root directory.
+	Root string
+	// Lua is the state the project is loaded into.
+	Lua *lua.LState
+
+	core *core.Instance
+	opt  *Options
+
+	// subprojects maps the root directory of each subproject loaded with
+	// lark.subproject() to its Project.  The map is shared by all
+	// subprojects.
+	subprojects map[string]*Project
+}
+
+// Load loads the project with root directory dir.  The project root is not
+// searched for, use project.FindRoot to locate the root of a directory.  If
+// the project has a module lock file its vendored modules are verified.
+func Load(dir string, opt *Options) (*Project, error) {
+	if opt == nil {
+		opt = &Options{}
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	inst := core.New(&core.Config{
+		Log:    opt.Log,
+		Stdout: opt.Stdout,
+		Stderr: opt.Stderr,
+		Limit:  opt.Parallel,
+		Color:  opt.Color,
+	})
+	return load(root, opt, inst, make(map[string]*Project))
+}
+
+// load loads the project with absolute root directory root which executes
+// commands with inst.
+func load(root string, opt *Options, inst *core.Instance, subprojects map[string]*Project) (*Project, error) {
+	if opt.Layout == nil {
+		conf, err := project.LoadConfig(root)
+		if err != nil {
+			return nil, err
+		}
+		lopt := *opt
+		lopt.Layout = conf.Layout()
+		opt = &lopt
+	}
+	layout := opt.Layout
+
+	lock, err := project.ReadModLock(root)
+	if err == nil {
+		err = layout.VerifyModules(root, lock)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := layout.FindTaskFiles(root)
+	if err != nil {
+		return nil, err
+	}
+
+	l := lua.NewState()
+	p := &Project{
+		Root:        root,
+		Lua:         l,
+		core:        inst,
+		opt:         opt,
+		subprojects: subprojects,
+	}
+	err = layout.SetPackagePath(l, root)
+	if err == nil {
+		iopt := *opt
+		iopt.Modules = append([]gluamodule.Module{inst.Module()}, opt.Modules...)
+		err = Init(l, root, files, &iopt, p.subproject)
+	}
+	if err != nil {
+		fs.Cleanup(l)
+		l.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// subproject returns the state of the subproject in dir, loading the
+// subproject if necessary.  Subprojects share the lark.core instance and
+// options of p, except for the layout and plugins which are read from the
+// configuration files of the subproject.
+func (p *Project) subproject(dir string) (*lua.LState, error) {
+	root := dir
+	if !filepath.IsAbs(root) {
+		root = filepath.Join(p.Root, dir)
+	}
+	root = filepath.Clean(root)
+	sub, ok := p.subprojects[root]
+	if ok {
+		return sub.Lua, nil
+	}
+
+	conf, err := project.LoadConfig(root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", dir, err)
+	}
+	opt := *p.opt
+	opt.Layout = conf.Layout()
+	opt.Plugins = conf.Strings("plugins")
+	ok, err = opt.Layout.IsRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s: not a lark project", dir)
+	}
+	if p.opt.Chdir {
+		restore, err := Chdir(root)
+		if err != nil {
+			return nil, err
+		}
+		defer restore()
+	}
+	sub, err = load(root, &opt, p.core, p.subprojects)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", dir, err)
+	}
+	p.subprojects[root] = sub
+	return sub.Lua, nil
+}
+
+// SubprojectFunc returns the Lua state of the subproject in dir, a directory
+// given to lark.subproject() that is relative to the project root.
+type SubprojectFunc func(dir string) (*lua.LState, error)
+
+// Init initializes the lark library in l for the project with root directory
+// root and loads files.  Load calls Init for the states it creates.  Programs
+// managing their own Lua state (such as the lark command) call Init after
+// setting the state's package path.  The lark.core module in lib.Modules is
+// preloaded unless opt.Modules contains a replacement.  If sub is nil
+// lark.subproject() raises an error.
+func Init(l *lua.LState, root string, files []string, opt *Options, sub SubprojectFunc) error {
+	if opt == nil {
+		opt = &Options{}
+	}
+	core.SetDir(l, root)
+
+	gluamodule.Preload(l, lib.Modules...)
+	plugins, err := project.LoadPlugins(root, opt.Plugins)
+	if err != nil {
+		return err
+	}
+	gluamodule.Preload(l, plugins...)
+	for _, m := range opt.Modules {
+		gluamodule.Preload(l, gluamodule.Resolve(m)...)
+	}
+
+	if opt.Stdout != nil {
+		l.SetGlobal("print", l.NewFunction(luaPrint(opt.Stdout)))
+	}
+	if opt.DisableDocs {
+		err := doc.Disable(l, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = l.CallByParam(lua.P{
+		Fn:      l.GetGlobal("require"),
+		NRet:    1,
+		Protect: true,
+		Handler: l.NewFunction(Traceback),
+	}, lua.LString("lark"))
+	if err != nil {
+		return err
+	}
+	lark := l.Get(-1)
+	l.Pop(1)
+	l.SetGlobal("lark", lark)
+
+	if opt.DisableDocs {
+		doc.Disable(l, l.NewClosure(func(l *lua.LState) int {
+			msg := l.NewTable()
+			msg.Append(lua.LString("documentation is disabled"))
+			msg.RawSetString("color", lua.LString("yellow"))
+			l.Push(l.GetField(lark, "log"))
+			l.Push(msg)
+			l.Call(1, 0)
+			return 0
+		}, lark))
+	}
+	l.SetField(lark, "verbose", lua.LBool(opt.Verbose))
+	l.SetField(lark, "keep_going", lua.LBool(opt.KeepGoing))
+	invocationDir := opt.InvocationDir
+	if invocationDir == "" {
+		invocationDir, err = os.Getwd()
+		if err != nil {
+			return err
+		}
+	}
+	l.SetField(lark, "invocation_dir", lua.LString(invocationDir))
+	if sub != nil {
+		l.SetField(lark, "_subproject", l.NewFunction(luaSubproject(sub, opt.Chdir)))
+	}
+	overrides := l.NewTable()
+	for name, v := range opt.Overrides {
+		overrides.RawSetString(name, lua.LString(v))
+	}
+	l.SetField(lark, "overrides", overrides)
+
+	layout := opt.Layout
+	if layout == nil {
+		layout = project.DefaultLayout()
+	}
+	err = LoadFiles(l, layout, root, files)
+	if err != nil {
+		return err
+	}
+	SetOverrides(l, opt.Overrides)
+	return nil
+}
+
+// Close removes temporary directories created by the project and its
+// subprojects and closes their Lua states.
+func (p *Project) Close() {
+	for root, sub := range p.subprojects {
+		fs.Cleanup(sub.Lua)
+		sub.Lua.Close()
+		delete(p.subprojects, root)
+	}
+	fs.Cleanup(p.Lua)
+	p.Lua.Close()
+}
+
+// Task describes a task defined by a project.
+type Task struct {
+	// Name is the qualified name of the task, or its pattern.
+	Name      string
+	Namespace string
+	Pattern   bool
+	Default   bool
+	// Examples contains example names matching a pattern.
+	Examples []string
+}
+
+// Tasks returns the tasks defined by the project in the order they are
+// displayed by “lark list”.
+func (p *Project) Tasks() ([]*Task, error) {
+	l := p.Lua
+	mod, err := require(l, task.Module.Name())
+	if err != nil {
+		return nil, err
+	}
+	err = l.CallByParam(lua.P{
+		Fn:      l.GetField(mod, "list"),
+		NRet:    1,
+		Protect: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	list, ok := l.Get(-1).(*lua.LTable)
+	l.Pop(1)
+	if !ok {
+		return nil, fmt.Errorf("task list is not a table")
+	}
+
+	var tasks []*Task
+	for i := 1; i <= list.Len(); i++ {
+		lt := list.RawGetInt(i)
+		t := &Task{
+			Name:    lua.LVAsString(l.GetField(lt, "name")),
+			Pattern: lua.LVAsString(l.GetField(lt, "kind")) == "pattern",
+			Default: lua.LVAsBool(l.GetField(lt, "default")),
+		}
+		t.Namespace = lua.LVAsString(l.GetField(lt, "namespace"))
+		examples, ok := l.GetField(lt, "examples").(*lua.LTable)
+		if ok {
+			for j := 1; j <= examples.Len(); j++ {
+				t.Examples = append(t.Examples, lua.LVAsString(examples.RawGetInt(j)))
+			}
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
+// Run runs the named task with params and waits for the commands it started
+// asynchronously.  If name is empty the default task is run.  If ctx is
+// canceled before the task completes the running commands are killed (or the
+// next command executed fails), which allows the task's cleanup hooks to run,
+// and ctx.Err() is returned.
+func (p *Project) Run(ctx context.Context, name string, params map[string]string) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+	p.core.ResetInterrupt()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			p.core.Interrupt()
+		case <-done:
+		}
+	}()
+
+	l := p.Lua
+	lark := l.GetGlobal("lark")
+	trace := l.NewFunction(Traceback)
+
+	var args []lua.LValue
+	if name == "" {
+		args = append(args, lua.LNil)
+	} else {
+		args = append(args, lua.LString(name))
+	}
+	if len(params) > 0 {
+		lparams := l.NewTable()
+		for k, v := range params {
+			l.SetField(lparams, k, lua.LString(v))
+		}
+		args = append(args, lparams)
+	}
+	err = l.CallByParam(lua.P{
+		Fn:      l.GetField(lark, "run"),
+		Protect: true,
+		Handler: trace,
+	}, args...)
+
+	wait := l.GetField(lark, "wait")
+	for {
+		errwait := l.CallByParam(lua.P{
+			Fn:      wait,
+			Protect: true,
+			Handler: trace,
+		})
+		if errwait == nil {
+			break
+		}
+		if err == nil {
+			err = errwait
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Failures returns the commands executed by the project which failed.
+func (p *Project) Failures() []*core.Failure {
+	return p.core.Failures()
+}
+
+func require(l *lua.LState, name string) (lua.LValue, error) {
+	err := l.CallByParam(lua.P{
+		Fn:      l.GetGlobal("require"),
+		NRet:    1,
+		Protect: true,
+	}, lua.LString(name))
+	if err != nil {
+		return nil, err
+	}
+	mod := l.Get(-1)
+	l.Pop(1)
+	return mod, nil
+}
+
+// Traceback is a Lua error handler that adds a stack traceback to error
+// messages.  Messages that already contain a traceback, like those of failed
+// tasks with hooks, are returned unchanged.
+func Traceback(l *lua.LState) int {
+	msg := l.Get(1)
+	if s, ok := msg.(lua.LString); ok && strings.Contains(string(s), "\nstack traceback:") {
+		return 1
+	}
+	l.SetTop(0)
+	l.Push(l.GetField(l.GetGlobal("debug"), "traceback"))
+	l.Push(msg)
+	l.Push(lua.LNumber(2))
+	l.Call(2, 1)
+	return 1
+}
+
+// luaPrint returns a Lua print function that writes to w.
+func luaPrint(w io.Writer) lua.LGFunction {
+	return func(l *lua.LState) int {
+		n := l.GetTop()
+		strs := make([]string, n)
+		for i := 1; i <= n; i++ {
+			strs[i-1] = l.ToStringMeta(l.Get(i)).String()
+		}
+		fmt.Fprintln(w, strings.Join(strs, "\t"))
+		return 0
+	}
+}
+
+// LoadFiles loads the given files of the project in dir, which has the given
+// layout, into state.  If the lark.task module variable file_namespaces is
+// true after a file is loaded then each subsequent file in the project task
+// directory is loaded into its own namespace and global environment.
+// Otherwise, if the variable dir_namespaces is true, files in a subdirectory
+// of the task directory share a namespace and global environment named after
+// the subdirectory.
+func LoadFiles(state *lua.LState, layout *project.Layout, dir string, files []string) error {
+	mod, err := require(state, task.Module.Name())
+	if err != nil {
+		return err
+	}
+
+	envs := make(map[string]*lua.LTable)
+	for _, file := range files {
+		fn, err := state.LoadFile(file)
+		if err != nil {
+			return err
+		}
+
+		ns := ""
+		if lua.LVAsBool(state.GetField(mod, "file_namespaces")) {
+			ns = layout.TaskNamespace(dir, file)
+		} else if lua.LVAsBool(state.GetField(mod, "dir_namespaces")) {
+			ns = layout.TaskDirNamespace(dir, file)
+		}
+		ns = strings.Replace(ns, "/", task.NamespaceSep, -1)
+		if ns != "" {
+			env, ok := envs[ns]
+			if !ok {
+				env = state.NewTable()
+				mt := state.NewTable()
+				state.SetField(mt, "__index", state.Get(lua.GlobalsIndex))
+				state.SetMetatable(env, mt)
+				envs[ns] = env
+			}
+			fn.Env = env
+			err = state.CallByParam(lua.P{
+				Fn:      state.GetField(mod, "namespace"),
+				Protect: true,
+			}, lua.LString(ns), env)
+			if err != nil {
+				return err
+			}
+		}
+
+		state.Push(fn)
+		err = state.PCall(0, 0, nil)
+		if err != nil {
+			return err
+		}
+
+		err = state.CallByParam(lua.P{
+			Fn:      state.GetField(mod, "namespace"),
+			Protect: true,
+		}, lua.LNil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetOverrides sets global variables in state to the values in overrides.
+// Variables declared with lark.var() are set to their typed value, other
+// variables are set to strings.
+func SetOverrides(state *lua.LState, overrides map[string]string) {
+	lark := state.GetGlobal("lark")
+	vars := state.GetField(lark, "vars")
+	for name, v := range overrides {
+		var lv lua.LValue = lua.LString(v)
+		decl := state.GetField(vars, name)
+		if decl != lua.LNil {
+			lv = state.GetField(decl, "value")
+		}
+		state.SetGlobal(name, lv)
+	}
+}
@@ -0,0 +1,300 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/lark/project"
+	"github.com/yuin/gopher-lua"
+)
+
+const testLarkFile = `
+local task = require('lark.task')
+
+greeting = lark.var('greeting', 'hello', 'The greeting to print')
+
+build = task .. function(ctx)
+	print(greeting .. ' ' .. (task.get_param(ctx, 'who') or 'world'))
+end
+
+echo = task .. function()
+	lark.exec{'echo', 'from', 'echo'}
+end
+
+fail = task .. function()
+	error('broken')
+end
+
+sleep = task .. function()
+	lark.exec{'sleep', '10'}
+end
+`
+
+func testProject(t *testing.T, opt *Options) (*Project, func()) {
+	root, err := ioutil.TempDir("", "lark-runner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(root, "lark.lua"), []byte(testLarkFile), 0644)
+	if err != nil {
+		os.RemoveAll(root)
+		t.Fatal(err)
+	}
+	p, err := Load(root, opt)
+	if err != nil {
+		os.RemoveAll(root)
+		t.Fatal(err)
+	}
+	return p, func() {
+		p.Close()
+		os.RemoveAll(root)
+	}
+}
+
+func TestProject_Tasks(t *testing.T) {
+	p, cleanup := testProject(t, &Options{Stdout: ioutil.Discard, Log: ioutil.Discard})
+	defer cleanup()
+
+	tasks, err := p.Tasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, task := range tasks {
+		names = append(names, task.Name)
+		if task.Default != (task.Name == "build") {
+			t.Errorf("task %s: default %v", task.Name, task.Default)
+		}
+	}
+	expect := "build echo fail sleep"
+	if strings.Join(names, " ") != expect {
+		t.Errorf("tasks: %q (!= %q)", names, expect)
+	}
+}
+
+func TestProject_Run(t *testing.T) {
+	var stdout bytes.Buffer
+	p, cleanup := testProject(t, &Options{
+		Stdout:    &stdout,
+		Log:       ioutil.Discard,
+		Overrides: map[string]string{"greeting": "hi"},
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+	err := p.Run(ctx, "", map[string]string{"who": "runner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Run(ctx, "echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "hi runner\nfrom echo\n"
+	if stdout.String() != expect {
+		t.Errorf("stdout: %q (!= %q)", stdout.String(), expect)
+	}
+
+	err = p.Run(ctx, "fail", nil)
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("task fail: %v", err)
+	}
+	err = p.Run(ctx, "missing", nil)
+	if err == nil {
+		t.Errorf("unknown task did not fail")
+	}
+}
+
+func TestProject_Run_canceled(t *testing.T) {
+	p, cleanup := testProject(t, &Options{Stdout: ioutil.Discard, Log: ioutil.Discard})
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := p.Run(ctx, "build", nil)
+	if err != context.Canceled {
+		t.Errorf("canceled context: %v", err)
+	}
+}
+
+func TestProject_Run_cancelRunning(t *testing.T) {
+	var stdout bytes.Buffer
+	p, cleanup := testProject(t, &Options{Stdout: &stdout, Log: ioutil.Discard})
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	timer := time.AfterFunc(100*time.Millisecond, cancel)
+	defer timer.Stop()
+	start := time.Now()
+	err := p.Run(ctx, "sleep", nil)
+	if err != context.Canceled {
+		t.Errorf("canceled context: %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("command was not killed")
+	}
+
+	// the cancellation does not affect later runs.
+	err = p.Run(context.Background(), "echo", nil)
+	if err != nil {
+		t.Errorf("run after cancel: %v", err)
+	}
+	if stdout.String() != "from echo\n" {
+		t.Errorf("stdout: %q", stdout.String())
+	}
+}
+
+func TestProject_subproject(t *testing.T) {
+	var stdout bytes.Buffer
+	p, cleanup := testProject(t, &Options{
+		Stdout:    &stdout,
+		Log:       ioutil.Discard,
+		Overrides: map[string]string{"greeting": "hi"},
+	})
+	defer cleanup()
+
+	sub := filepath.Join(p.Root, "sub")
+	err := os.Mkdir(sub, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(sub, "lark.lua"), []byte(testLarkFile), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Lua.DoString(`lark.subproject('sub').run('build')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "hi world\n" {
+		t.Errorf("stdout: %q", stdout.String())
+	}
+}
+
+func TestProject_subprojectChdir(t *testing.T) {
+	p, cleanup := testProject(t, &Options{
+		Stdout: ioutil.Discard,
+		Log:    ioutil.Discard,
+		Chdir:  true,
+	})
+	defer cleanup()
+
+	sub := filepath.Join(p.Root, "sub")
+	err := os.Mkdir(sub, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(sub, "lark.lua"), []byte(`
+local f = io.open('marker.txt')
+loaded_in_sub = f ~= nil
+
+check = require('lark.task') .. function()
+	local f = io.open('marker.txt')
+	ran_in_sub = f ~= nil
+end
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(sub, "marker.txt"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Lua.DoString(`lark.subproject('sub').run('check')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subl := p.subprojects[sub].Lua
+	for _, name := range []string{"loaded_in_sub", "ran_in_sub"} {
+		if subl.GetGlobal(name).String() != "true" {
+			t.Errorf("%s: %v", name, subl.GetGlobal(name))
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cwd != wd {
+		t.Errorf("working directory was not restored: %s", cwd)
+	}
+}
+
+func TestLoad_layout(t *testing.T) {
+	root, err := ioutil.TempDir("", "lark-runner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	err = os.Mkdir(filepath.Join(root, "tasks"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"lark.lua":    testLarkFile,
+		".lark.toml":  `task_dir = "tasks"`,
+		"tasks/a.lua": "a = require('lark.task') .. function() end",
+	}
+	for name, content := range files {
+		err = ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		layout *project.Layout
+		expect string
+	}{
+		{nil, "a build echo fail sleep"},
+		{project.DefaultLayout(), "build echo fail sleep"},
+	} {
+		p, err := Load(root, &Options{Layout: test.layout})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tasks, err := p.Tasks()
+		p.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, task := range tasks {
+			names = append(names, task.Name)
+		}
+		if strings.Join(names, " ") != test.expect {
+			t.Errorf("layout %v: tasks %q (!= %q)", test.layout, names, test.expect)
+		}
+	}
+}
+
+func TestCopyValue_cycle(t *testing.T) {
+	src := lua.NewState()
+	defer src.Close()
+	l := lua.NewState()
+	defer l.Close()
+
+	v := src.NewTable()
+	v.RawSetString("self", v)
+	v.RawSetString("f", src.NewFunction(func(*lua.LState) int { return 0 }))
+	c, ok := copyValue(l, v, make(map[*lua.LTable]*lua.LTable)).(*lua.LTable)
+	if !ok || c == v {
+		t.Fatalf("table was not copied: %v", c)
+	}
+	if c.RawGetString("self") != c {
+		t.Errorf("cycle was not copied: %v", c.RawGetString("self"))
+	}
+	if c.RawGetString("f") != lua.LNil {
+		t.Errorf("function was copied")
+	}
+}
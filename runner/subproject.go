@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/bmatsuo/lark/lib/lark/core"
+	"github.com/yuin/gopher-lua"
+)
+
+// luaSubproject implements lark.subproject() using sub to load subprojects.
+// If chdir is true the working directory is changed to the subproject root
+// while its tasks run.  The function is stored in the lark module as
+// _subproject.
+func luaSubproject(sub SubprojectFunc, chdir bool) lua.LGFunction {
+	return func(l *lua.LState) int {
+		dir := l.CheckString(1)
+		subl, err := sub(dir)
+		if err != nil {
+			l.RaiseError("%v", err)
+		}
+
+		t := l.NewTable()
+		l.SetField(t, "dir", lua.LString(dir))
+		l.SetField(t, "run", l.NewFunction(func(l *lua.LState) int {
+			args := make([]lua.LValue, l.GetTop())
+			copied := make(map[*lua.LTable]*lua.LTable)
+			for i := range args {
+				args[i] = copyValue(subl, l.Get(i+1), copied)
+			}
+			if chdir {
+				restore, err := Chdir(core.Dir(subl))
+				if err != nil {
+					l.RaiseError("%s: %v", dir, err)
+				}
+				defer restore()
+			}
+			err := runSubproject(subl, args)
+			if err != nil {
+				l.RaiseError("%s: %v", dir, err)
+			}
+			return 0
+		}))
+		l.Push(t)
+		return 1
+	}
+}
+
+// wdmut serializes changes to the working directory made by Chdir.
+var wdmut sync.Mutex
+
+// Chdir changes the working directory of the process to dir and returns a
+// function that restores the previous working directory.  Chdir implements
+// Options.Chdir and may be used by programs which load and run subprojects
+// themselves.
+func Chdir(dir string) (restore func() error, err error) {
+	wdmut.Lock()
+	defer wdmut.Unlock()
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		return nil, err
+	}
+	restore = func() error {
+		wdmut.Lock()
+		defer wdmut.Unlock()
+		return os.Chdir(wd)
+	}
+	return restore, nil
+}
+
+// runSubproject calls lark.run in the subproject state l with args and waits
+// for asynchronous tasks to complete.
+func runSubproject(l *lua.LState, args []lua.LValue) error {
+	lark := l.GetGlobal("lark")
+	err := l.CallByParam(lua.P{
+		Fn:      l.GetField(lark, "run"),
+		Protect: true,
+	}, args...)
+	errwait := l.CallByParam(lua.P{
+		Fn:      l.GetField(lark, "wait"),
+		Protect: true,
+	})
+	if err == nil {
+		err = errwait
+	}
+	if apierr, ok := err.(*lua.ApiError); ok {
+		// the traceback of the subproject state is not useful to the caller.
+		return fmt.Errorf("%s", apierr.Object)
+	}
+	return err
+}
+
+// copyValue copies v into state l.  Functions and userdata cannot be shared
+// between states and are copied as nil.  Tables which have already been
+// copied are found in copied, so cyclic tables can be copied.
+func copyValue(l *lua.LState, v lua.LValue, copied map[*lua.LTable]*lua.LTable) lua.LValue {
+	switch v := v.(type) {
+	case lua.LString, lua.LNumber, lua.LBool:
+		return v
+	case *lua.LTable:
+		t, ok := copied[v]
+		if ok {
+			return t
+		}
+		t = l.NewTable()
+		copied[v] = t
+		v.ForEach(func(k, v lua.LValue) {
+			k = copyValue(l, k, copied)
+			if k != lua.LNil {
+				t.RawSet(k, copyValue(l, v, copied))
+			}
+		})
+		return t
+	default:
+		return lua.LNil
+	}
+}